@@ -50,10 +50,7 @@ func runExport(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// if subgraph specified
-	if globalFlags.subgraph != "" {
-		engine = engine.WithSubgraph(globalFlags.subgraph)
-	}
+	engine = withSubgraphFlag(cmd, engine)
 
 	var writer io.Writer = os.Stdout
 	if exportFlags.output != "" {
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"context"
+	"io"
+
+	"github.com/aprksy/knitknot/pkg/graph"
+)
+
+// Session runs REPL lines against an engine the way the REPL does
+type Session struct {
+	s *replSession
+}
+
+func NewSession(engine *graph.GraphEngine) *Session {
+	return &Session{s: newReplSession(engine)}
+}
+
+// Run handles one line, writing what it prints to out
+func (s *Session) Run(ctx context.Context, line string, out io.Writer) error {
+	return s.s.handleLine(ctx, line, out)
+}
+
+// Complete returns what tab completion offers to append to line, with the
+// cursor at its end
+func Complete(engine *graph.GraphEngine, line string) []string {
+	c := &replCompleter{engine: engine}
+	got, _ := c.Do([]rune(line), len([]rune(line)))
+	var words []string
+	for _, w := range got {
+		words = append(words, string(w))
+	}
+	return words
+}
+
+// Output returns where the session writes a statement, paged or not
+func (s *Session) Output(out io.Writer) io.WriteCloser {
+	return s.s.output(out)
+}
+
+var (
+	NeedsMore = needsMore
+	Highlight = highlight
+)
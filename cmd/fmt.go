@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aprksy/knitknot/pkg/dsl"
+	"github.com/spf13/cobra"
+)
+
+var fmtCmd = &cobra.Command{
+	Use:   "fmt [file...]",
+	Short: "Format KnitKnot query files",
+	Long: `Rewrite query files in canonical form.
+
+Each file holds a single DSL query. With no files, the query is read from
+stdin and the formatted result written to stdout. With --check, files are
+left untouched and the command fails if any of them is not formatted.`,
+	SilenceUsage: true,
+	RunE:         runFmt,
+}
+
+var fmtFlags struct {
+	check bool
+}
+
+func init() {
+	fmtCmd.Flags().BoolVar(&fmtFlags.check, "check", false, "List unformatted files and fail instead of rewriting them")
+	RootCmd.AddCommand(fmtCmd)
+}
+
+func runFmt(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		src, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		formatted, err := formatQuery(string(src))
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(cmd.OutOrStdout(), formatted)
+		return nil
+	}
+
+	unformatted := 0
+	for _, filename := range args {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		formatted, err := formatQuery(string(src))
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+
+		if formatted == string(src) {
+			continue
+		}
+
+		if fmtFlags.check {
+			fmt.Fprintln(cmd.OutOrStdout(), filename)
+			unformatted++
+			continue
+		}
+
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filename, []byte(formatted), info.Mode().Perm()); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "-- Formatted %s\n", filename)
+	}
+
+	if unformatted > 0 {
+		return fmt.Errorf("%d file(s) not formatted", unformatted)
+	}
+	return nil
+}
+
+// formatQuery parses src and returns its canonical form, newline-terminated
+func formatQuery(src string) (string, error) {
+	ast, err := dsl.NewParser(strings.TrimSpace(src)).Parse()
+	if err != nil {
+		return "", fmt.Errorf("parse error: %w", err)
+	}
+	return dsl.Format(ast) + "\n", nil
+}
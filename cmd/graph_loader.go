@@ -2,16 +2,29 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 
 	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/idgen"
+	"github.com/aprksy/knitknot/pkg/ports/storage"
 	"github.com/aprksy/knitknot/pkg/storage/inmem"
+	"github.com/spf13/cobra"
 )
 
-// LoadGraph initializes the graph engine from file or creates new
+// LoadGraph initializes the graph engine from file or creates new. A
+// loaded graph keeps the ID scheme it was saved with.
 func LoadGraph(filename string) (*graph.GraphEngine, error) {
-	storage := inmem.New()
-	engine := graph.NewGraphEngine(storage)
+	ids, err := idgen.New(globalFlags.idScheme)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := graph.ParseVerbMode(globalFlags.verbMode)
+	if err != nil {
+		return nil, err
+	}
+	storage := inmem.New().WithIDGenerator(ids)
+	engine := graph.NewGraphEngine(storage).WithVerbMode(mode).WithLogger(warnings)
 
 	if filename == "" {
 		return engine, nil
@@ -22,7 +35,10 @@ func LoadGraph(filename string) (*graph.GraphEngine, error) {
 		return engine, nil
 	}
 
-	if err := storage.Load(filename, engine); err != nil {
+	if err := storage.Load(filename); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", filename, err)
+	}
+	if err := engine.LoadMetadata(); err != nil {
 		return nil, fmt.Errorf("failed to load %s: %w", filename, err)
 	}
 
@@ -30,18 +46,40 @@ func LoadGraph(filename string) (*graph.GraphEngine, error) {
 		len(storage.GetAllNodes()),
 		len(storage.GetAllEdges()),
 		filename)
+	if name := engine.DefaultSubgraph(); name != "" {
+		fmt.Fprintf(os.Stderr, "-- Default subgraph: %s (--subgraph= to clear)\n", name)
+	}
 
 	return engine, nil
 }
 
-// SaveGraph saves the engine's graph to file
+// withSubgraphFlag applies --subgraph. Given, even empty, it replaces the
+// default subgraph saved with the graph.
+func withSubgraphFlag(cmd *cobra.Command, engine *graph.GraphEngine) *graph.GraphEngine {
+	if cmd.Flags().Changed("subgraph") {
+		return engine.WithSubgraph(globalFlags.subgraph)
+	}
+	return engine
+}
+
+// warnings prints engine warnings to stderr, without timestamps
+var warnings = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+	ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		if a.Key == slog.TimeKey && len(groups) == 0 {
+			return slog.Attr{}
+		}
+		return a
+	},
+}))
+
+// SaveGraph saves the engine's graph to file, if its storage can
 func SaveGraph(engine *graph.GraphEngine, filename string) error {
-	storage, ok := engine.Storage().(*inmem.Storage)
+	persister, ok := engine.Storage().(storage.Persister)
 	if !ok {
 		return fmt.Errorf("storage does not support saving")
 	}
 
-	if err := storage.Save(filename, engine); err != nil {
+	if err := persister.Save(filename); err != nil {
 		return fmt.Errorf("save failed: %w", err)
 	}
 
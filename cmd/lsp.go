@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/aprksy/knitknot/pkg/lsp"
+	"github.com/spf13/cobra"
+)
+
+var lspCmd = &cobra.Command{
+	Use:   "lsp",
+	Short: "Start the KnitKnot language server",
+	Long: `Speak the Language Server Protocol over stdio.
+
+Offers diagnostics from the DSL parser, and completion and hover drawn
+from the graph loaded with -f (labels, property keys and verbs).`,
+	SilenceUsage: true,
+	RunE:         runLsp,
+}
+
+func init() {
+	RootCmd.AddCommand(lspCmd)
+}
+
+func runLsp(cmd *cobra.Command, args []string) error {
+	// LoadGraph only logs to stderr, so stdout stays clean for the protocol
+	engine, err := LoadGraph(globalFlags.file)
+	if err != nil {
+		return err
+	}
+
+	return lsp.NewServer(engine).Serve(os.Stdin, os.Stdout)
+}
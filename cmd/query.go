@@ -63,10 +63,7 @@ func runQuery(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// if subgraph specified
-	if globalFlags.subgraph != "" {
-		engine = engine.WithSubgraph(globalFlags.subgraph)
-	}
+	engine = withSubgraphFlag(cmd, engine)
 
 	builder, err := ApplyAST(engine, ast)
 	if err != nil {
@@ -74,18 +71,19 @@ func runQuery(cmd *cobra.Command, args []string) error {
 	}
 
 	ctx := context.Background()
-	result, err := builder.Exec(ctx)
+	it, err := builder.Iterate(ctx)
 	if err != nil {
 		return err
 	}
+	defer it.Close()
 
-	// Output result
+	// Output result, a row at a time
 	switch queryFlags.format {
 	case "text":
 		fmt.Println("RESULT (text):")
-		for _, row := range result.Items() {
+		for it.Next(ctx) {
 			index := 0
-			for k, n := range row {
+			for k, n := range it.Row() {
 				name := n.Props["name"]
 				if name == nil {
 					name = "?"
@@ -94,21 +92,28 @@ func runQuery(cmd *cobra.Command, args []string) error {
 				if index == 0 {
 					prefix = "  - "
 				}
-				fmt.Printf("%s%s: %v (%s)\n", prefix, k, name, n.Label)
+				fmt.Printf("%s%s: %v (%s)\n", prefix, k, name, n.LabelString())
 				index++
 			}
 		}
 	case "json":
 		fmt.Println("RESULT (json):")
-		data, err := json.Marshal(result)
-		if err != nil {
-			return err
+		sep := "["
+		for it.Next(ctx) {
+			data, err := json.Marshal(it.Row())
+			if err != nil {
+				return err
+			}
+			fmt.Print(sep, string(data))
+			sep = ","
 		}
-		fmt.Println(string(data))
-		return nil
+		if sep == "[" {
+			fmt.Print(sep)
+		}
+		fmt.Println("]")
 	}
 
-	return nil
+	return it.Err()
 }
 
 func printExplain(queryStr string, ast *dsl.Query) {
@@ -121,9 +126,19 @@ func printExplain(queryStr string, ast *dsl.Query) {
 			arg := method.Arguments[0].(*dsl.StringLiteral)
 			fmt.Printf("    %d. Match nodes with label '%s'\n", i+1, arg.Value)
 		case "Has":
-			rel := method.Arguments[0].(*dsl.StringLiteral)
-			val := method.Arguments[1].(*dsl.StringLiteral)
-			fmt.Printf("    %d. Follow '%s' edges to nodes with value '%s'\n", i+1, rel.Value, val.Value)
+			args := method.Arguments
+			switch {
+			case len(args) == 4:
+				fmt.Printf("    %d. Follow %s edges to nodes where %s %s %s\n", i+1, args[0], unquoted(args[1]), unquoted(args[2]), args[3])
+			case len(args) != 2:
+				fmt.Printf("    %d. Has with %d arguments\n", i+1, len(args))
+			default:
+				if _, ok := args[1].(*dsl.MapLiteral); ok {
+					fmt.Printf("    %d. Follow %s edges to nodes matching %s\n", i+1, args[0], args[1])
+				} else {
+					fmt.Printf("    %d. Follow %s edges to nodes with value %s\n", i+1, args[0], args[1])
+				}
+			}
 		case "Where", "WhereEdge":
 			field := method.Arguments[0].(*dsl.StringLiteral)
 			op := method.Arguments[1].(*dsl.StringLiteral)
@@ -134,10 +149,15 @@ func printExplain(queryStr string, ast *dsl.Query) {
 				valStr = fmt.Sprintf("%q", v.Value)
 			case *dsl.NumberLiteral:
 				valStr = fmt.Sprintf("%v", v.Value)
+			case *dsl.VarRef:
+				valStr = v.TokenLiteral()
 			default:
 				valStr = "???"
 			}
 			fmt.Printf("    %d. Filter where %s %s %s\n", i+1, field.Value, op.Value, valStr)
+		case "In":
+			name := method.Arguments[0].(*dsl.StringLiteral)
+			fmt.Printf("    %d. Restrict to subgraph '%s'\n", i+1, name.Value)
 		case "Limit":
 			n := method.Arguments[0].(*dsl.NumberLiteral)
 			fmt.Printf("    %d. Limit result to %d items\n", i+1, n.Value)
@@ -147,94 +167,16 @@ func printExplain(queryStr string, ast *dsl.Query) {
 	}
 }
 
-func ApplyAST(engine *graph.GraphEngine, q *dsl.Query) (*graph.Builder, error) {
-	var builder *graph.Builder
-
-	for _, method := range q.Methods {
-		switch method.Name.Value {
-		case "Find":
-			if len(method.Arguments) != 1 {
-				return nil, fmt.Errorf("find takes 1 arg")
-			}
-			if str, ok := method.Arguments[0].(*dsl.StringLiteral); ok {
-				builder = engine.Find(str.Value)
-			} else {
-				return nil, fmt.Errorf("find requires string")
-			}
-
-		case "Has":
-			if len(method.Arguments) != 2 {
-				return nil, fmt.Errorf("has takes 2 args")
-			}
-			rel, ok1 := method.Arguments[0].(*dsl.StringLiteral)
-			val, ok2 := method.Arguments[1].(*dsl.StringLiteral)
-			if !ok1 || !ok2 {
-				return nil, fmt.Errorf("has requires two strings")
-			}
-			if builder != nil {
-				builder = builder.Has(rel.Value, val.Value)
-			}
-
-		case "Where":
-			if len(method.Arguments) != 3 {
-				return nil, fmt.Errorf("where takes 3 args")
-			}
-			field, ok1 := method.Arguments[0].(*dsl.StringLiteral)
-			op, ok2 := method.Arguments[1].(*dsl.StringLiteral)
-			var value any
-			if str, ok := method.Arguments[2].(*dsl.StringLiteral); ok {
-				value = str.Value
-			} else if num, ok := method.Arguments[2].(*dsl.NumberLiteral); ok {
-				value = num.Value
-			} else {
-				return nil, fmt.Errorf("where value must be string or number")
-			}
-			if !ok1 || !ok2 {
-				return nil, fmt.Errorf("where field and op must be strings")
-			}
-			if builder != nil {
-				builder = builder.Where(field.Value, op.Value, value)
-			}
-
-		case "WhereEdge":
-			if len(method.Arguments) != 3 {
-				return nil, fmt.Errorf("where takes 3 args")
-			}
-			field, ok1 := method.Arguments[0].(*dsl.StringLiteral)
-			op, ok2 := method.Arguments[1].(*dsl.StringLiteral)
-			var value any
-			if str, ok := method.Arguments[2].(*dsl.StringLiteral); ok {
-				value = str.Value
-			} else if num, ok := method.Arguments[2].(*dsl.NumberLiteral); ok {
-				value = num.Value
-			} else {
-				return nil, fmt.Errorf("where value must be string or number")
-			}
-			if !ok1 || !ok2 {
-				return nil, fmt.Errorf("where field and op must be strings")
-			}
-			if builder != nil {
-				builder = builder.WhereEdge(field.Value, op.Value, value)
-			}
-
-		case "Limit":
-			if len(method.Arguments) != 1 {
-				return nil, fmt.Errorf("limit takes 1 arg")
-			}
-			if num, ok := method.Arguments[0].(*dsl.NumberLiteral); ok && builder != nil {
-				builder = builder.Limit(num.Value)
-			} else {
-				return nil, fmt.Errorf("limit requires number")
-			}
-
-		default:
-			return nil, fmt.Errorf("unknown method: %s", method.Name.Value)
-		}
-	}
-
-	if builder == nil {
-		return nil, fmt.Errorf("empty query")
+// unquoted returns the value of a string argument, and other arguments
+// as written
+func unquoted(e dsl.Expression) string {
+	if str, ok := e.(*dsl.StringLiteral); ok {
+		return str.Value
 	}
+	return fmt.Sprint(e)
+}
 
-	return builder, nil
+// ApplyAST builds a query from a parsed DSL query
+func ApplyAST(engine *graph.GraphEngine, q *dsl.Query) (*graph.Builder, error) {
+	return engine.Compile(q)
 }
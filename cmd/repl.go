@@ -2,12 +2,15 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 
 	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/script"
 	"github.com/chzyer/readline"
 	"github.com/spf13/cobra"
 )
@@ -19,17 +22,35 @@ var replCmd = &cobra.Command{
 	RunE:  runRepl,
 }
 
+const (
+	prompt         = "knitknot> "
+	continuePrompt = "     ...> "
+)
+
+// errQuit is returned by handleLine when the user asks to leave the shell
+var errQuit = errors.New("quit")
+
 func init() {
 	replCmd.Flags().StringVar(&globalFlags.subgraph, "subgraph", "", "Run query within a subgraph context")
 	RootCmd.AddCommand(replCmd)
 }
 
 func runRepl(cmd *cobra.Command, args []string) error {
+	// Initialize engine
+	// Load graph from -f
+	engine, err := LoadGraph(globalFlags.file)
+	if err != nil {
+		return err
+	}
+
+	engine = withSubgraphFlag(cmd, engine)
+
 	// Setup readline
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt:          "knitknot> ",
+		Prompt:          prompt,
 		HistoryFile:     ".knitknot_history",
-		AutoComplete:    nil,
+		AutoComplete:    &replCompleter{engine: engine},
+		Painter:         newReplPainter(readline.DefaultIsTerminal()),
 		InterruptPrompt: "^C",
 		EOFPrompt:       "exit",
 	})
@@ -52,35 +73,60 @@ func runRepl(cmd *cobra.Command, args []string) error {
 	}
 	fmt.Println("Press Ctrl+C to exit.")
 
-	// Initialize engine
-	// Load graph from -f
-	engine, err := LoadGraph(globalFlags.file)
-	if err != nil {
-		return err
-	}
-
-	if globalFlags.subgraph != "" {
-		engine = engine.WithSubgraph(globalFlags.subgraph)
-	}
-
 	ctx := context.Background()
+	session := newReplSession(engine)
+
+	// Lines of a statement that continues on the next line
+	var pending []string
 
 	for {
+		if len(pending) > 0 {
+			rl.SetPrompt(continuePrompt)
+		} else {
+			rl.SetPrompt(prompt)
+		}
+
 		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) && len(pending) > 0 {
+			pending = nil // Ctrl+C drops the unfinished statement
+			continue
+		}
 		if err != nil { // io.EOF or interrupt
 			break
 		}
 
-		line = strings.TrimSpace(line)
-		if line == "" {
+		if strings.TrimSpace(line) == "" && len(pending) == 0 {
+			continue
+		}
+
+		pending = append(pending, line)
+		input := strings.TrimSpace(strings.Join(pending, "\n"))
+		if needsMore(input) {
 			continue
 		}
+		pending = nil
 
-		if err := handleLine(ctx, line, engine, rl.Stdout()); err != nil {
+		out := session.output(rl.Stdout())
+		err = session.handleLine(ctx, input, out)
+		_ = out.Close()
+		if errors.Is(err, errPagerClosed) {
+			err = nil
+		}
+		if err != nil {
+			if errors.Is(err, errQuit) {
+				break
+			}
 			fmt.Fprintf(rl.Stderr(), "Error: %v\n", err)
 		}
 	}
 
+	// Uncommitted changes are not saved
+	if session.inTx() {
+		if err := session.execRollback(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to roll back: %v\n", err)
+		}
+	}
+
 	// Autosave on exit if file was specified
 	if globalFlags.file != "" {
 		if err := SaveGraph(engine, globalFlags.file); err != nil {
@@ -91,65 +137,210 @@ func runRepl(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func handleLine(ctx context.Context, input string, engine *graph.GraphEngine, out io.Writer) error {
+// replSession is the state of one shell: the engine it works on and the
+// display settings changed with backslash commands
+type replSession struct {
+	engine *graph.GraphEngine
+	pager  bool
+
+	format    string   // one of outputFormats
+	props     []string // properties shown as result columns
+	showProps bool     // show every property instead of props
+
+	vars map[string][]string // LET bindings and $_, as node IDs
+
+	journal []journalEntry // changes UNDO can revert, oldest first
+	redo    []journalEntry // changes reverted by UNDO, most recent last
+
+	tx       storage.Tx   // open from BEGIN to COMMIT or ROLLBACK
+	txMark   int          // journal length at BEGIN, -1 outside a transaction
+	restored []membership // subgraph members UNDO and REDO put back on COMMIT
+}
+
+func newReplSession(engine *graph.GraphEngine) *replSession {
+	return &replSession{
+		engine: engine,
+		format: outputTable,
+		props:  []string{"name"},
+		vars:   make(map[string][]string),
+		txMark: -1,
+	}
+}
+
+// execMutation runs CONNECT, UPDATE and DELETE once variables are expanded
+func execMutation(tx storage.Tx, input string, touch touchFunc, out io.Writer) error {
+	lower := strings.ToLower(input)
+	switch {
+	case strings.HasPrefix(lower, "connect "):
+		return execConnect(tx, input[8:], touch, out)
+	case strings.HasPrefix(lower, "update "):
+		return execUpdate(tx, input[7:], touch, out)
+	default:
+		return execDelete(tx, input[7:], touch, out)
+	}
+}
+
+// needsMore reports whether a query typed so far continues on the next
+// line. REPL commands always fit on one line.
+func needsMore(input string) bool {
+	first := strings.ToUpper(strings.Fields(input)[0])
+	if isKeyword(first) && first != "EXPLAIN" {
+		return false
+	}
+	return script.Incomplete(input)
+}
+
+func (s *replSession) handleLine(ctx context.Context, input string, out io.Writer) error {
 	var filename string
+	engine := s.engine
 	input = strings.TrimSpace(input)
 	lower := strings.ToLower(input)
 
 	switch {
 	case lower == "exit", lower == "quit":
 		fmt.Fprintln(out, "Goodbye!")
-		os.Exit(0)
+		return errQuit
 
 	case lower == "help":
 		printHelp(out)
 
+	case strings.HasPrefix(lower, `\`):
+		return s.execSetting(input[1:], out)
+
 	case strings.HasPrefix(lower, "explain "):
 		return execExplain(ctx, input[8:], engine, out)
 
+	case lower == "begin":
+		return s.execBegin(out)
+
+	case lower == "commit":
+		return s.execCommit(out)
+
+	case lower == "rollback":
+		return s.execRollback(out)
+
+	case lower == "undo", strings.HasPrefix(lower, "undo "):
+		return s.execUndo(input[4:], out)
+
+	case lower == "redo", strings.HasPrefix(lower, "redo "):
+		return s.execRedo(input[4:], out)
+
 	case matchesCommand(lower, "save ", &filename):
+		if s.inTx() {
+			return fmt.Errorf("cannot SAVE inside a transaction; COMMIT or ROLLBACK first")
+		}
 		return execSave(engine, filename, out)
 
 	case matchesCommand(lower, "load ", &filename):
+		if s.inTx() {
+			return fmt.Errorf("cannot LOAD inside a transaction; COMMIT or ROLLBACK first")
+		}
+		s.journal, s.redo = nil, nil
 		return execLoad(engine, filename, out)
 
+	case strings.HasPrefix(lower, "source "):
+		return execSource(ctx, s, input[7:], out)
+
 	case strings.HasPrefix(lower, "define "):
 		return execDefine(engine, input, out)
 
+	case lower == "constraints", lower == "list constraints":
+		return execListConstraints(engine, out)
+
+	case strings.HasPrefix(lower, "constraint "):
+		return execConstraint(engine, input[11:], out)
+
+	case strings.HasPrefix(lower, "describe "):
+		return execDescribe(engine, strings.TrimSpace(input[9:]), out)
+
 	case lower == "list verbs", lower == "verbs":
 		return execListVerbs(engine, out)
 
-	case strings.HasPrefix(lower, "addnode "):
-		return execAddNode(engine, input[8:], out)
+	case lower == "subgraphs", lower == "list subgraphs":
+		return execListSubgraphs(s, out)
 
-	case strings.HasPrefix(lower, "connect "):
-		return execConnect(engine, input[8:], out)
+	case strings.HasPrefix(lower, "view "):
+		return s.execView(input, out)
 
-	case strings.HasPrefix(lower, "update "):
-		return execUpdate(engine, input[7:], out)
+	case strings.HasPrefix(lower, "subgraph "):
+		return s.execSubgraph(ctx, input[9:], out)
+
+	case lower == "let", strings.HasPrefix(lower, "let "):
+		return s.execLet(ctx, input, out)
 
-	case strings.HasPrefix(lower, "delete "):
-		return execDelete(engine, input[7:], out)
+	case strings.HasPrefix(lower, "addnode "):
+		return s.record(input, func(tx storage.Tx, _ touchFunc) ([]string, error) {
+			id, err := execAddNode(engine, tx, input[8:], out)
+			if err != nil {
+				return nil, err
+			}
+			s.setLast([]string{id})
+			return []string{id}, nil
+		})
+
+	case strings.HasPrefix(lower, "connect "),
+		strings.HasPrefix(lower, "update "),
+		strings.HasPrefix(lower, "delete "):
+		expanded, err := s.expandVars(input)
+		if err != nil {
+			return err
+		}
+		return s.record(expanded, func(tx storage.Tx, touch touchFunc) ([]string, error) {
+			return nil, execMutation(tx, expanded, touch, out)
+		})
 
 	default:
-		return execQuery(ctx, input, engine, out)
+		return s.execQuery(ctx, input, out)
 	}
 	return nil
 }
 
 func printHelp(out io.Writer) {
 	fmt.Fprintln(out, "KnitKnot REPL Commands:")
-	fmt.Fprintln(out, "  ADDNODE Label key=value ...          - Create a new node")
+	fmt.Fprintln(out, "  ADDNODE Label[:Label] key=value ...  - Create a new node")
 	fmt.Fprintln(out, "  CONNECT A --rel--> B                 - Connect two nodes")
 	fmt.Fprintln(out, "    Optional: --rel prop=123-->        - With edge properties")
+	fmt.Fprintln(out, "  UPDATE NODE id [:L|+:L|-:L] k=v -k   - Set/remove properties and labels")
+	fmt.Fprintln(out, "  UPDATE EDGE id|A --rel--> B k=v -k   - Set/remove edge properties")
+	fmt.Fprintln(out, "  DELETE NODE id [DETACH]              - Delete a node (DETACH: with its edges)")
+	fmt.Fprintln(out, "  DELETE EDGE id | A --rel--> B        - Delete an edge")
 	fmt.Fprintln(out, "  Find('Label').Where(...)             - Run a query")
+	fmt.Fprintln(out, "  LET name = <query>                   - Bind the result's nodes to $name")
+	fmt.Fprintln(out, "  LET                                  - List variables ($_ = last result)")
 	fmt.Fprintln(out, "  EXPLAIN Find(...)                    - Show query plan")
 	fmt.Fprintln(out, "  explain <query>                      - Same, case-insensitive")
 	fmt.Fprintln(out, "  SAVE \"filename\"                      - Save graph to disk")
 	fmt.Fprintln(out, "  LOAD \"filename\"                      - Load graph from disk")
 	fmt.Fprintln(out, "  DEFINE <verb> TO <Label> VIA <prop>  - Register a relationship type")
+	fmt.Fprintln(out, "    Optional: FROM <Label> before TO   - Required label of the source node")
+	fmt.Fprintln(out, "    Optional: ... UNIQUE               - At most one such edge per node pair")
+	fmt.Fprintln(out, "    Optional: ... MANY TO ONE          - Cardinality (ONE|MANY TO ONE|MANY)")
+	fmt.Fprintln(out, "    Optional: ... INVERSE <name>       - Name of the edges seen from the target")
+	fmt.Fprintln(out, "    Optional: ... SYMMETRIC            - Edges mean the same both ways")
+	fmt.Fprintln(out, "    Optional: ... PROPS a,b            - Only these edge properties")
+	fmt.Fprintln(out, "  DEFINE LABEL L (p type [REQUIRED] [UNIQUE] [DEFAULT v], ...)")
+	fmt.Fprintln(out, "                                       - Declare typed properties of a label")
+	fmt.Fprintln(out, "  DESCRIBE Label                       - Show a label's schema and constraints")
+	fmt.Fprintln(out, "  CONSTRAINT UNIQUE|EXISTS|NODE KEY Label.prop[,prop] [AS name]")
+	fmt.Fprintln(out, "                                       - Enforce a constraint, checking existing nodes")
+	fmt.Fprintln(out, "  CONSTRAINT DROP name                 - Stop enforcing a constraint")
+	fmt.Fprintln(out, "  CONSTRAINTS                          - List constraints")
+	fmt.Fprintln(out, "  SUBGRAPH CREATE name [\"desc\"]        - Create a named subgraph")
+	fmt.Fprintln(out, "    Optional: ... EXPLICIT             - Only edges added to it, not all between its nodes")
+	fmt.Fprintln(out, "  SUBGRAPH MODE name INDUCED|EXPLICIT  - Change which edges belong to a subgraph")
+	fmt.Fprintln(out, "  SUBGRAPH ADD|REMOVE name <query|ids> - Add or remove nodes (or EDGE id)")
+	fmt.Fprintln(out, "  SUBGRAPH DROP name                   - Delete a subgraph, keeping its nodes")
+	fmt.Fprintln(out, "  VIEW name AS <query>                 - Subgraph of a query's results, kept in sync")
+	fmt.Fprintln(out, "  SUBGRAPHS                            - List subgraphs and views")
+	fmt.Fprintln(out, "  BEGIN / COMMIT / ROLLBACK            - Group changes; uncommitted ones are not saved")
+	fmt.Fprintln(out, "  UNDO [n] / REDO [n]                  - Revert or re-apply the last n changes")
+	fmt.Fprintln(out, "  SOURCE \"file\" [CONTINUE]             - Run a script of commands")
 	fmt.Fprintln(out, "  LIST VERBS                           - Show all defined verbs")
 	fmt.Fprintln(out, "  VERBS                                - Short alias")
+	fmt.Fprintln(out, "  \\format table|vertical|json|csv      - Set the result output format")
+	fmt.Fprintln(out, "  \\props name,age,...                  - Choose property columns")
+	fmt.Fprintln(out, "  \\show props [on|off]                 - Show all properties of each node")
+	fmt.Fprintln(out, "  \\pager on|off                        - Page long output through $PAGER")
 	fmt.Fprintln(out, "  help                                 - Show this message")
 	fmt.Fprintln(out, "  exit / quit                          - Leave the shell")
 	fmt.Fprintln(out, "")
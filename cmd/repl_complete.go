@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/lsp"
+	"github.com/chzyer/readline"
+)
+
+var _ readline.AutoCompleter = (*replCompleter)(nil)
+
+// replCommands are offered for the first word of a line
+var replCommands = []string{
+	"ADDNODE", "CONNECT", "DEFINE", "DESCRIBE", "DELETE", "UPDATE", "EXPLAIN", "LET",
+	"BEGIN", "COMMIT", "ROLLBACK", "UNDO", "REDO",
+	"SUBGRAPH", "SUBGRAPHS", "VIEW", "CONSTRAINT", "CONSTRAINTS", "SAVE", "LOAD", "SOURCE", "VERBS", "help", "exit", "quit",
+}
+
+// replCompleter completes REPL commands and DSL queries from the live
+// graph: labels, verbs, property keys and node IDs
+type replCompleter struct {
+	engine *graph.GraphEngine
+}
+
+func (c *replCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+	start, words := c.candidates(text)
+	typed := text[start:]
+
+	var out [][]rune
+	for _, w := range words {
+		// Keywords are case-insensitive; follow the case the user typed
+		if isKeyword(w) && typed != "" && strings.ToLower(typed) == typed {
+			w = strings.ToLower(w)
+		}
+		if strings.HasPrefix(w, typed) {
+			out = append(out, []rune(w[len(typed):]))
+		}
+	}
+	return out, len([]rune(typed))
+}
+
+// candidates returns where the word being completed starts, and the words
+// that may replace it
+func (c *replCompleter) candidates(text string) (int, []string) {
+	fields := strings.Fields(text)
+	newWord := text == "" || strings.HasSuffix(text, " ")
+	argIndex := len(fields) // index of the word under the cursor
+	if !newWord {
+		argIndex--
+	}
+	start := len(text)
+	if !newWord {
+		start = strings.LastIndexAny(text, " \t") + 1
+	}
+
+	if argIndex == 0 {
+		if strings.ContainsAny(text, "('.") {
+			return lsp.Candidates(c.engine, text, len(text))
+		}
+		return start, append(append([]string{}, replCommands...), "Find")
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "DELETE", "UPDATE":
+		switch {
+		case argIndex == 1:
+			return start, []string{"NODE", "EDGE"}
+		case argIndex == 2:
+			return start, c.nodeIDs()
+		case argIndex == 3 && strings.EqualFold(fields[0], "DELETE") && strings.EqualFold(fields[1], "NODE"):
+			return start, []string{"DETACH"}
+		case strings.EqualFold(fields[1], "EDGE"):
+			return c.completeEdge(text, start, argIndex)
+		}
+
+	case "CONNECT":
+		return c.completeEdge(text, start, argIndex)
+
+	case "ADDNODE":
+		if argIndex == 1 {
+			return start, c.labels()
+		}
+		var keys []string
+		for _, k := range c.propKeys() {
+			keys = append(keys, k+"=")
+		}
+		return start, keys
+
+	case "DEFINE":
+		if argIndex == 1 {
+			return start, append([]string{"LABEL"}, c.verbs()...)
+		}
+		if strings.EqualFold(fields[1], "LABEL") {
+			if argIndex == 2 {
+				return start, c.labels()
+			}
+			return start, []string{"string", "int", "float", "bool", "REQUIRED", "UNIQUE", "DEFAULT"}
+		}
+		switch prev := strings.ToUpper(fields[argIndex-1]); {
+		case argIndex == 2:
+			return start, []string{"FROM", "TO"}
+		case prev == "FROM", prev == "TO" && !slices.Contains([]string{"ONE", "MANY"}, strings.ToUpper(fields[argIndex-2])):
+			return start, c.labels()
+		case prev == "TO":
+			return start, []string{"ONE", "MANY"}
+		case prev == "ONE", prev == "MANY":
+			return start, []string{"TO"}
+		case prev == "VIA":
+			return start, c.propKeys()
+		case prev == "INVERSE", prev == "PROPS":
+			return start, nil
+		}
+		return start, []string{"VIA", "UNIQUE", "ONE", "MANY", "INVERSE", "SYMMETRIC", "PROPS"}
+
+	case "CONSTRAINT":
+		switch {
+		case argIndex == 1:
+			return start, []string{"UNIQUE", "EXISTS", "NODE", "DROP"}
+		case argIndex == 2 && strings.EqualFold(fields[1], "DROP"):
+			var names []string
+			for _, c := range c.engine.Constraints() {
+				names = append(names, c.Name)
+			}
+			return start, names
+		case argIndex == 2 && strings.EqualFold(fields[1], "NODE"):
+			return start, []string{"KEY"}
+		case argIndex == 2, argIndex == 3 && strings.EqualFold(fields[1], "NODE"):
+			return start, c.labelProps()
+		}
+		return start, []string{"AS"}
+
+	case "DESCRIBE":
+		if argIndex == 1 {
+			return start, c.labels()
+		}
+		return start, nil
+
+	case "SUBGRAPH":
+		switch {
+		case argIndex == 1:
+			return start, []string{"CREATE", "DROP", "MODE", "ADD", "REMOVE"}
+		case strings.EqualFold(fields[1], "CREATE"):
+			if argIndex == 2 {
+				return start, nil
+			}
+			return start, []string{"INDUCED", "EXPLICIT"}
+		case argIndex == 2:
+			return start, c.subgraphs()
+		case argIndex == 3 && strings.EqualFold(fields[1], "MODE"):
+			return start, []string{"INDUCED", "EXPLICIT"}
+		case strings.ContainsAny(text[fieldOffset(text, 3):], "('."):
+			// A query, from its first word on
+			i := fieldOffset(text, 3)
+			s, words := lsp.Candidates(c.engine, text[i:], len(text)-i)
+			return i + s, words
+		case argIndex == 3 && (strings.EqualFold(fields[1], "ADD") || strings.EqualFold(fields[1], "REMOVE")):
+			return start, append([]string{"EDGE", "Find"}, c.nodeIDs()...)
+		case argIndex == 3:
+			return start, nil
+		}
+		return start, c.nodeIDs()
+
+	case "VIEW":
+		switch argIndex {
+		case 1:
+			return start, nil
+		case 2:
+			return start, []string{"AS"}
+		}
+		i := fieldOffset(text, 3)
+		s, words := lsp.Candidates(c.engine, text[i:], len(text)-i)
+		return i + s, words
+
+	case "EXPLAIN":
+		rest := text[len(fields[0]):]
+		offset := len(text) - len(strings.TrimLeft(rest, " \t"))
+		s, words := lsp.Candidates(c.engine, text[offset:], len(text)-offset)
+		return offset + s, words
+	}
+
+	// Anything else is a query typed after some leading word
+	return lsp.Candidates(c.engine, text, len(text))
+}
+
+// completeEdge handles "A --rel--> B": node IDs around the arrow and the
+// relationship name inside it
+func (c *replCompleter) completeEdge(text string, start, argIndex int) (int, []string) {
+	word := text[start:]
+	switch {
+	case strings.HasPrefix(word, "--"):
+		var rels []string
+		for _, v := range c.verbs() {
+			rels = append(rels, "--"+v+"-->")
+		}
+		return start, rels
+	case strings.Contains(text[:start], "-->") || argIndex <= 2:
+		return start, c.nodeIDs()
+	}
+	return start, nil
+}
+
+func (c *replCompleter) nodeIDs() []string {
+	var ids []string
+	for _, n := range c.engine.Storage().GetAllNodes() {
+		ids = append(ids, n.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (c *replCompleter) labels() []string {
+	seen := map[string]bool{}
+	for _, n := range c.engine.Storage().GetAllNodes() {
+		for _, l := range n.Labels {
+			seen[l] = true
+		}
+	}
+	for l := range c.engine.Schemas().All() {
+		seen[l] = true
+	}
+	return sortedSet(seen)
+}
+
+// labelProps lists "Label.prop" for the properties nodes of a label have
+// or its schema declares
+func (c *replCompleter) labelProps() []string {
+	seen := map[string]bool{}
+	for _, n := range c.engine.Storage().GetAllNodes() {
+		for _, l := range n.Labels {
+			for k := range n.Props {
+				seen[l+"."+k] = true
+			}
+		}
+	}
+	for l, schema := range c.engine.Schemas().All() {
+		for _, p := range schema.Properties {
+			seen[l+"."+p.Name] = true
+		}
+	}
+	return sortedSet(seen)
+}
+
+func (c *replCompleter) propKeys() []string {
+	seen := map[string]bool{}
+	for _, n := range c.engine.Storage().GetAllNodes() {
+		for k := range n.Props {
+			seen[k] = true
+		}
+	}
+	return sortedSet(seen)
+}
+
+func (c *replCompleter) verbs() []string {
+	seen := map[string]bool{}
+	for name := range c.engine.Verbs().All() {
+		seen[name] = true
+	}
+	for _, e := range c.engine.Storage().GetAllEdges() {
+		seen[e.Kind] = true
+	}
+	return sortedSet(seen)
+}
+
+func (c *replCompleter) subgraphs() []string {
+	var names []string
+	for _, sg := range c.engine.ListSubgraphs() {
+		names = append(names, sg.Name)
+	}
+	return names
+}
+
+// fieldOffset returns where the nth (from 0) whitespace-separated field
+// of text starts
+func fieldOffset(text string, n int) int {
+	i := 0
+	for ; n >= 0; n-- {
+		i = len(text) - len(strings.TrimLeft(text[i:], " \t"))
+		if n > 0 {
+			i += strings.IndexAny(text[i:]+" ", " \t")
+		}
+	}
+	return i
+}
+
+func isKeyword(w string) bool {
+	switch w {
+	case "NODE", "EDGE", "TO", "VIA", "DETACH", "UNIQUE", "CREATE", "DROP", "MODE", "ADD", "REMOVE", "AS", "INDUCED", "EXPLICIT", "LABEL", "REQUIRED", "DEFAULT", "EXISTS", "KEY", "FROM", "ONE", "MANY", "INVERSE", "SYMMETRIC", "PROPS":
+		return true
+	}
+	for _, c := range replCommands {
+		if c == w {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedSet(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,64 @@
+package cmd_test
+
+import (
+	"github.com/aprksy/knitknot/cmd"
+	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+	"github.com/aprksy/knitknot/pkg/storage/inmem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REPL completion", func() {
+	var engine *graph.GraphEngine
+
+	BeforeEach(func() {
+		engine = graph.NewGraphEngine(inmem.New())
+		Expect(engine.AddNodeWithID("u1", "User", map[string]any{"name": "Alice", "age": 30})).To(Succeed())
+		Expect(engine.AddNodeWithID("s1", "Skill", map[string]any{"name": "Go"})).To(Succeed())
+		_, err := engine.AddEdge("u1", "s1", "HAS_SKILL", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(engine.CreateSubgraph("team", "")).To(Succeed())
+		Expect(engine.DefineLabel(types.LabelSchema{
+			Label:      "Team",
+			Properties: []types.PropertyDef{{Name: "code", Type: types.PropString}},
+		})).To(Succeed())
+	})
+
+	DescribeTable("offers what fits the cursor",
+		func(line string, want []string) {
+			Expect(cmd.Complete(engine, line)).To(ContainElements(want))
+		},
+		Entry("commands", "ADD", []string{"NODE"}),
+		Entry("commands in the case typed", "con", []string{"nect"}),
+		Entry("labels in Find", "Find('", []string{"User", "Skill"}),
+		Entry("methods after a dot", "Find('User').W", []string{"here"}),
+		Entry("verbs in Has", "Find('User').Has('", []string{"HAS_SKILL"}),
+		Entry("property keys after n.", "Find('User').Where('n.", []string{"name", "age"}),
+		Entry("node IDs to delete", "DELETE NODE ", []string{"s1", "u1"}),
+		Entry("DETACH after a node ID", "DELETE NODE u1 ", []string{"DETACH"}),
+		Entry("node IDs to update", "UPDATE NODE u", []string{"1"}),
+		Entry("relationships in CONNECT", "CONNECT u1 --", []string{"HAS_SKILL-->"}),
+		Entry("labels for ADDNODE", "ADDNODE S", []string{"kill"}),
+		Entry("property keys for ADDNODE", "ADDNODE User a", []string{"ge="}),
+		Entry("subgraph names", "SUBGRAPH ADD ", []string{"team"}),
+		Entry("queries after EXPLAIN", "EXPLAIN Find('U", []string{"ser"}),
+		Entry("queries in SUBGRAPH ADD", "SUBGRAPH ADD team Find('U", []string{"ser"}),
+		Entry("properties in a SUBGRAPH REMOVE query", "SUBGRAPH REMOVE team Find('User').Where('n.", []string{"name"}),
+		Entry("subgraph modes", "SUBGRAPH MODE team ", []string{"INDUCED", "EXPLICIT"}),
+		Entry("queries in VIEW", "VIEW seniors AS Find('User').Where('n.", []string{"age"}),
+		Entry("what DEFINE defines", "DEFINE ", []string{"LABEL", "HAS_SKILL"}),
+		Entry("property types in DEFINE LABEL", "DEFINE LABEL User name ", []string{"string", "REQUIRED"}),
+		Entry("labels after FROM", "DEFINE HAS_SKILL FROM ", []string{"User", "Skill"}),
+		Entry("cardinality after TO", "DEFINE HAS_SKILL FROM User TO Skill ", []string{"VIA", "ONE", "MANY"}),
+		Entry("label properties in CONSTRAINT", "CONSTRAINT UNIQUE ", []string{"User.name", "User.age", "Skill.name", "Team.code"}),
+		Entry("label properties in a node key", "CONSTRAINT NODE KEY S", []string{"kill.name"}),
+		Entry("labels for DESCRIBE", "DESCRIBE U", []string{"ser"}),
+	)
+
+	It("should offer nothing that does not fit", func() {
+		Expect(cmd.Complete(engine, "DELETE NODE x")).To(BeEmpty())
+		Expect(cmd.Complete(engine, "Find('Nope")).To(BeEmpty())
+		Expect(cmd.Complete(engine, "CONSTRAINT UNIQUE Skill.")).To(ConsistOf("name"))
+	})
+})
@@ -1,60 +1,81 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 
-	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/ports/storage"
 )
 
-func execDelete(engine *graph.GraphEngine, input string, out io.Writer) error {
+func execDelete(tx storage.Tx, input string, touch touchFunc, out io.Writer) error {
 	input = strings.TrimSpace(input)
 	if !strings.HasPrefix(input, "NODE ") && !strings.HasPrefix(input, "EDGE ") {
-		return fmt.Errorf("usage: DELETE NODE <id> | DELETE EDGE A --rel--> B")
+		return fmt.Errorf("usage: DELETE NODE <id> [DETACH] | DELETE EDGE <id>|A --rel--> B")
 	}
 
 	if strings.HasPrefix(input, "NODE ") {
-		id := strings.TrimSpace(input[5:])
-		if id == "" {
-			return fmt.Errorf("missing node ID")
-		}
-
-		err := engine.DeleteNode(id)
-		if err != nil {
-			return err
-		}
-		fmt.Fprintf(out, "-- Deleted node %s\n", id)
-		return nil
+		return execDeleteNode(tx, input[5:], touch, out)
 	}
 
 	if strings.HasPrefix(input, "EDGE ") {
-		return execDeleteEdge(engine, input[5:], out)
+		return execDeleteEdge(tx, input[5:], touch, out)
 	}
 
 	return fmt.Errorf("invalid DELETE syntax")
 }
 
-func execDeleteEdge(engine *graph.GraphEngine, input string, out io.Writer) error {
-	arrowStart := strings.Index(input, "--")
-	arrowEnd := strings.LastIndex(input, "-->")
-	if arrowStart == -1 || arrowEnd == -1 || arrowEnd <= arrowStart {
-		return fmt.Errorf("invalid edge format")
+// execDeleteNode deletes a node; with DETACH its edges go too, otherwise
+// a connected node is kept
+func execDeleteNode(tx storage.Tx, input string, touch touchFunc, out io.Writer) error {
+	fields := strings.Fields(input)
+	detach := len(fields) == 2 && strings.EqualFold(fields[1], "DETACH")
+	if len(fields) == 0 || (len(fields) > 1 && !detach) {
+		return fmt.Errorf("usage: DELETE NODE <id> [DETACH]")
 	}
+	id := fields[0]
+	touch(id)
 
-	fromID := strings.TrimSpace(input[:arrowStart])
-	rel := strings.TrimSpace(input[arrowStart+2 : arrowEnd])
-	toID := strings.TrimSpace(input[arrowEnd+3:])
+	if !detach {
+		err := tx.DeleteNode(id)
+		if errors.Is(err, storage.ErrNodeHasEdges) {
+			return fmt.Errorf("%w; use DELETE NODE %s DETACH to delete them too", err, id)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "-- Deleted node %s\n", id)
+		return nil
+	}
 
-	if fromID == "" || toID == "" || rel == "" {
-		return fmt.Errorf("invalid edge spec")
+	edges := len(tx.GetEdgesFrom(id))
+	for _, e := range tx.GetEdgesTo(id) {
+		if e.From != id { // self-loops were counted above
+			edges++
+		}
 	}
+	if err := tx.DetachDeleteNode(id); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "-- Deleted node %s and %d edge(s)\n", id, edges)
+	return nil
+}
 
-	err := engine.DeleteEdge(fromID, toID, rel)
+func execDeleteEdge(tx storage.Tx, input string, touch touchFunc, out io.Writer) error {
+	edge, rest, err := edgeRef(tx, input)
 	if err != nil {
 		return err
 	}
+	if rest != "" {
+		return fmt.Errorf("usage: DELETE EDGE <id> | DELETE EDGE A --rel--> B")
+	}
+
+	touch(edge.From, edge.To)
+	if err := tx.DeleteEdgeByID(edge.ID); err != nil {
+		return err
+	}
 
-	fmt.Fprintf(out, "-- Deleted edge %s --%s--> %s\n", fromID, rel, toID)
+	fmt.Fprintf(out, "-- Deleted edge %s --%s--> %s (%s)\n", edge.From, edge.Kind, edge.To, edge.ID)
 	return nil
 }
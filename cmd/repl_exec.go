@@ -5,48 +5,93 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/aprksy/knitknot/pkg/dsl"
 	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/ports/query"
 )
 
-func execQuery(ctx context.Context, queryStr string, engine *graph.GraphEngine, out io.Writer) error {
-	parser := dsl.NewParser(queryStr)
-	ast, err := parser.Parse()
+func (s *replSession) execQuery(ctx context.Context, queryStr string, out io.Writer) error {
+	if s.format == outputJSON || s.format == outputCSV {
+		return s.streamQuery(ctx, queryStr, out)
+	}
+
+	start := time.Now()
+	result, err := s.runQuery(ctx, queryStr)
 	if err != nil {
-		return fmt.Errorf("parse error: %w", err)
+		return err
 	}
+	elapsed := time.Since(start)
+
+	s.setLast(resultIDs(result))
+	return s.printResult(result, elapsed, out)
+}
 
-	builder, err := ApplyAST(engine, ast)
+// streamQuery writes the rows of a query as they come, for the formats
+// that do not need to see every row first
+func (s *replSession) streamQuery(ctx context.Context, queryStr string, out io.Writer) error {
+	start := time.Now()
+	builder, err := s.buildQuery(queryStr)
 	if err != nil {
-		return fmt.Errorf("build error: %w", err)
+		return err
 	}
+	var it query.ResultIterator
+	if s.inTx() {
+		it, err = builder.IterateTx(ctx, s.tx)
+	} else {
+		it, err = builder.Iterate(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	defer it.Close()
 
-	result, err := builder.Exec(ctx)
+	ids := newIDCollector()
+	count, err := s.streamResult(ctx, it, ids.add, out)
 	if err != nil {
 		return err
 	}
+	elapsed := time.Since(start)
+
+	s.setLast(ids.ids)
+	if count == 0 {
+		fmt.Fprint(out, "(no results)\n")
+	}
+	fmt.Fprintf(out, "-- %d result(s) in %s\n", count, formatDuration(elapsed))
+	return nil
+}
+
+// runQuery parses, resolves session variables in, and executes a query,
+// within the open transaction if there is one
+func (s *replSession) runQuery(ctx context.Context, queryStr string) (query.ResultSet, error) {
+	builder, err := s.buildQuery(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	if s.inTx() {
+		return builder.ExecTx(ctx, s.tx)
+	}
+	return builder.Exec(ctx)
+}
 
-	// Pretty-print result
-	if result.Empty() {
-		fmt.Fprintln(out, "(no results)")
-		return nil
+// buildQuery parses a query and resolves the session variables in it
+func (s *replSession) buildQuery(queryStr string) (*graph.Builder, error) {
+	parser := dsl.NewParser(queryStr)
+	ast, err := parser.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("parse error: %w", err)
 	}
 
-	for _, row := range result.Items() {
-		var parts []string
-		for varName, node := range row {
-			name, _ := node.Props["name"].(string)
-			if name == "" {
-				name = "<unknown>"
-			}
-			parts = append(parts, fmt.Sprintf("%s=%s(%s)", varName, name, node.Label))
-		}
-		fmt.Fprintln(out, strings.Join(parts, ", "))
+	if err := s.resolveVars(ast); err != nil {
+		return nil, err
 	}
 
-	fmt.Fprintf(out, "-- %d result(s)\n", result.Len())
-	return nil
+	builder, err := ApplyAST(s.engine, ast)
+	if err != nil {
+		return nil, fmt.Errorf("build error: %w", err)
+	}
+	return builder, nil
 }
 
 func execExplain(ctx context.Context, queryStr string, engine *graph.GraphEngine, out io.Writer) error {
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aprksy/knitknot/pkg/dsl"
+	"github.com/chzyer/readline"
+)
+
+// ANSI colors used by the REPL highlighter
+const (
+	colorReset   = "\033[0m"
+	colorKeyword = "\033[35m" // REPL commands
+	colorMethod  = "\033[36m" // DSL methods
+	colorString  = "\033[32m"
+	colorNumber  = "\033[33m"
+	colorIllegal = "\033[31m"
+)
+
+var _ readline.Painter = (*replPainter)(nil)
+
+// replPainter highlights the line being edited: the leading REPL command,
+// and DSL tokens as produced by dsl.Lexer
+type replPainter struct {
+	enabled bool
+}
+
+func newReplPainter(enabled bool) *replPainter {
+	return &replPainter{enabled: enabled}
+}
+
+func (p *replPainter) Paint(line []rune, pos int) []rune {
+	if !p.enabled || len(line) == 0 {
+		return line
+	}
+	return []rune(highlight(string(line)))
+}
+
+// highlight returns text with ANSI color codes around its tokens
+func highlight(text string) string {
+	var sb strings.Builder
+
+	// A REPL command is colored as a whole word; only EXPLAIN is followed
+	// by a query worth highlighting
+	trimmed := strings.TrimLeft(text, " \t")
+	lead := text[:len(text)-len(trimmed)]
+	if first := strings.Fields(trimmed); len(first) > 0 && isKeyword(strings.ToUpper(first[0])) {
+		word := first[0]
+		sb.WriteString(lead + colorKeyword + word + colorReset)
+		rest := trimmed[len(word):]
+		if strings.EqualFold(word, "explain") {
+			sb.WriteString(highlightQuery(rest))
+		} else {
+			sb.WriteString(rest)
+		}
+		return sb.String()
+	}
+
+	return highlightQuery(text)
+}
+
+func highlightQuery(text string) string {
+	var tokens []dsl.Token
+	l := dsl.NewLexer(text)
+	for tok := l.NextToken(); tok.Type != dsl.EOF; tok = l.NextToken() {
+		tokens = append(tokens, tok)
+	}
+
+	var sb strings.Builder
+	last := 0
+	for i, tok := range tokens {
+		start, end := clamp(tok.PosX, len(text)), clamp(tok.End, len(text))
+		if start < last {
+			continue
+		}
+		sb.WriteString(text[last:start])
+
+		color := ""
+		switch tok.Type {
+		case dsl.Ident:
+			if i+1 < len(tokens) && tokens[i+1].Type == dsl.LParen {
+				color = colorMethod
+			}
+		case dsl.String:
+			color = colorString
+		case dsl.Number:
+			color = colorNumber
+		case dsl.Illegal:
+			// Multi-byte chars come out as one Illegal token per byte
+			if text[start] < utf8.RuneSelf {
+				color = colorIllegal
+			}
+		}
+
+		if color != "" {
+			sb.WriteString(color + text[start:end] + colorReset)
+		} else {
+			sb.WriteString(text[start:end])
+		}
+		last = end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+func clamp(n, max int) int {
+	if n > max {
+		return max
+	}
+	return n
+}
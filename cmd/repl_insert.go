@@ -4,10 +4,12 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/ports/storage"
 )
 
 // parseProps converts "name=Alice age=35" to map[string]any
@@ -27,10 +29,10 @@ func parseProps(input string) map[string]any {
 	return props
 }
 
-func execAddNode(engine *graph.GraphEngine, input string, out io.Writer) error {
+func execAddNode(engine *graph.GraphEngine, tx storage.Tx, input string, out io.Writer) (string, error) {
 	input = strings.TrimSpace(input)
 	if input == "" {
-		return fmt.Errorf("usage: ADDNODE Label [key=value ...]")
+		return "", fmt.Errorf("usage: ADDNODE Label[:Label...] [key=value ...]")
 	}
 
 	fields := strings.Fields(input)
@@ -40,16 +42,20 @@ func execAddNode(engine *graph.GraphEngine, input string, out io.Writer) error {
 		props = parseProps(strings.Join(fields[1:], " "))
 	}
 
-	id, err := engine.AddNode(label, props)
+	labels := strings.Split(label, ":")
+	if slices.Contains(labels, "") {
+		return "", fmt.Errorf("invalid labels %q", label)
+	}
+	id, err := engine.AddNodeWithLabelsTx(tx, labels, props)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	fmt.Fprintf(out, "-- Created node: %s (%s)\n", id, label)
-	return nil
+	return id, nil
 }
 
-func execConnect(engine *graph.GraphEngine, input string, out io.Writer) error {
+func execConnect(tx storage.Tx, input string, touch touchFunc, out io.Writer) error {
 	input = strings.TrimSpace(input)
 	// Simple format: fromID --rel--> toID
 	// Or: fromID --rel prop=123--> toID
@@ -86,11 +92,16 @@ func execConnect(engine *graph.GraphEngine, input string, out io.Writer) error {
 		return fmt.Errorf("invalid connect syntax")
 	}
 
-	err := engine.AddEdge(fromID, toID, rel, props)
+	touch(fromID, toID)
+	id, err := tx.AddEdge(fromID, toID, rel, props)
 	if err != nil {
 		return err
 	}
+	// An inverse name is stored as its verb
+	if e, ok := tx.GetEdge(id); ok {
+		fromID, rel, toID = e.From, e.Kind, e.To
+	}
 
-	fmt.Fprintf(out, "-- Connected %s --%s--> %s\n", fromID, rel, toID)
+	fmt.Fprintf(out, "-- Connected %s --%s--> %s (%s)\n", fromID, rel, toID, id)
 	return nil
 }
@@ -0,0 +1,531 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// maxJournal bounds how many commands UNDO can go back
+const maxJournal = 1000
+
+// journalEntry records what one command (or one committed transaction)
+// changed, so it can be undone and redone
+type journalEntry struct {
+	command string
+	changes []change
+}
+
+// change is the state of one node or edge before and after a command;
+// nil means the record did not exist
+type change struct {
+	id                    string
+	nodeBefore, nodeAfter *types.Node
+	edgeBefore, edgeAfter *types.Edge
+	edge                  bool
+}
+
+// touchFunc is passed the IDs of the nodes a data command resolved,
+// before it changes them, so that their state can be journaled
+type touchFunc func(ids ...string)
+
+// writeTx returns the transaction a data command writes in: the session's
+// between BEGIN and COMMIT, or else a new one that the caller commits
+func (s *replSession) writeTx() (tx storage.Tx, own bool, err error) {
+	if s.tx != nil {
+		return s.tx, false, nil
+	}
+	tx, err = s.engine.Begin(context.Background())
+	return tx, true, err
+}
+
+// record runs a data command in a transaction and journals the nodes and
+// edges it changed: the nodes it touched and those it created, with all
+// their edges. A command failing inside BEGIN leaves the transaction as
+// it was before the command.
+func (s *replSession) record(command string, run func(tx storage.Tx, touch touchFunc) (created []string, err error)) error {
+	tx, own, err := s.writeTx()
+	if err != nil {
+		return err
+	}
+	if own {
+		defer func() { _ = tx.Rollback() }()
+	}
+
+	before := newGraphState()
+	var ids []string
+	touch := func(touched ...string) {
+		for _, id := range touched {
+			if _, seen := before.nodes[id]; !seen {
+				before.capture(tx, id)
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	created, err := run(tx, touch)
+	ids = append(ids, created...)
+	if err != nil {
+		if !own {
+			undo := diffState(before, captureState(tx, ids))
+			if _, undoErr := apply(tx, undo, true); undoErr != nil {
+				return fmt.Errorf("%w (reverting it: %v)", err, undoErr)
+			}
+		}
+		return err
+	}
+
+	changes := diffState(before, captureState(tx, ids))
+	if own {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	s.journalChanges(command, changes)
+	return nil
+}
+
+// recordMembers runs a command changing subgraph members, which is not
+// transactional, and journals the nodes it names and their edges
+func (s *replSession) recordMembers(command string, ids []string, run func() error) error {
+	store := s.engine.Storage()
+	before := captureState(store, ids)
+	if err := run(); err != nil {
+		return err
+	}
+	s.journalChanges(command, diffState(before, captureState(store, ids)))
+	return nil
+}
+
+func (s *replSession) journalChanges(command string, changes []change) {
+	if len(changes) == 0 {
+		return
+	}
+	s.journal = append(s.journal, journalEntry{command: command, changes: changes})
+	s.trimJournal()
+	s.redo = nil
+}
+
+// trimJournal drops the oldest entries past maxJournal, but none of an
+// open transaction
+func (s *replSession) trimJournal() {
+	if !s.inTx() && len(s.journal) > maxJournal {
+		s.journal = s.journal[len(s.journal)-maxJournal:]
+	}
+}
+
+// execBegin opens a transaction: the commands that follow write in it, and
+// only COMMIT makes their changes visible outside the session. ROLLBACK,
+// or leaving the shell without COMMIT, discards them.
+func (s *replSession) execBegin(out io.Writer) error {
+	if s.inTx() {
+		return fmt.Errorf("transaction already open")
+	}
+	tx, err := s.engine.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	s.tx, s.txMark = tx, len(s.journal)
+	fmt.Fprintln(out, "-- Transaction started")
+	return nil
+}
+
+// execCommit commits the transaction and folds its commands into one
+// journal entry, so a later UNDO reverts it as a whole
+func (s *replSession) execCommit(out io.Writer) error {
+	if !s.inTx() {
+		return fmt.Errorf("no transaction open")
+	}
+
+	entries := s.journal[s.txMark:]
+	restored := s.restored
+	if err := s.tx.Commit(); err != nil {
+		s.endTx()
+		return fmt.Errorf("commit failed, transaction rolled back: %w", err)
+	}
+	changes := foldChanges(entries)
+	s.journal = s.journal[:s.txMark]
+	s.tx, s.txMark, s.restored = nil, -1, nil
+	if len(changes) > 0 {
+		command := fmt.Sprintf("transaction (%d command(s))", len(entries))
+		s.journal = append(s.journal, journalEntry{command: command, changes: changes})
+		s.trimJournal()
+	}
+
+	fmt.Fprintf(out, "-- Committed %d command(s)\n", len(entries))
+	return s.restoreSubgraphs(restored)
+}
+
+func (s *replSession) execRollback(out io.Writer) error {
+	if !s.inTx() {
+		return fmt.Errorf("no transaction open")
+	}
+
+	n := len(s.journal) - s.txMark
+	err := s.tx.Rollback()
+	s.endTx()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "-- Rolled back %d command(s)\n", n)
+	return nil
+}
+
+// endTx forgets the transaction and everything journaled since BEGIN
+func (s *replSession) endTx() {
+	s.journal = s.journal[:s.txMark]
+	s.tx, s.txMark, s.restored, s.redo = nil, -1, nil, nil
+}
+
+func (s *replSession) inTx() bool {
+	return s.tx != nil
+}
+
+// foldChanges merges the changes of several entries into one per record,
+// from its first before state to its last after state
+func foldChanges(entries []journalEntry) []change {
+	var folded []change
+	index := make(map[string]int)
+	for _, e := range entries {
+		for _, c := range e.changes {
+			key := c.id
+			if c.edge {
+				key = "edge " + c.id
+			}
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(folded)
+				folded = append(folded, c)
+				continue
+			}
+			folded[i].nodeAfter, folded[i].edgeAfter = c.nodeAfter, c.edgeAfter
+		}
+	}
+	return slices.DeleteFunc(folded, func(c change) bool {
+		return reflect.DeepEqual(c.nodeBefore, c.nodeAfter) && reflect.DeepEqual(c.edgeBefore, c.edgeAfter)
+	})
+}
+
+// execUndo reverts the last n journaled commands. Inside a transaction it
+// cannot go back past BEGIN.
+func (s *replSession) execUndo(args string, out io.Writer) error {
+	n, err := parseCount(args)
+	if err != nil {
+		return err
+	}
+
+	floor := 0
+	if s.inTx() {
+		floor = s.txMark
+	}
+	if len(s.journal)-floor == 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+
+	for i := 0; i < n && len(s.journal) > floor; i++ {
+		last := s.journal[len(s.journal)-1]
+		if err := s.replay(last.changes, true); err != nil {
+			return err
+		}
+		s.journal = s.journal[:len(s.journal)-1]
+		s.redo = append(s.redo, last)
+		fmt.Fprintf(out, "-- Undone: %s\n", last.command)
+	}
+	return nil
+}
+
+// execRedo re-applies commands reverted by UNDO, until a new change is made
+func (s *replSession) execRedo(args string, out io.Writer) error {
+	n, err := parseCount(args)
+	if err != nil {
+		return err
+	}
+	if len(s.redo) == 0 {
+		return fmt.Errorf("nothing to redo")
+	}
+
+	for i := 0; i < n && len(s.redo) > 0; i++ {
+		next := s.redo[len(s.redo)-1]
+		if err := s.replay(next.changes, false); err != nil {
+			return err
+		}
+		s.redo = s.redo[:len(s.redo)-1]
+		s.journal = append(s.journal, next)
+		fmt.Fprintf(out, "-- Redone: %s\n", next.command)
+	}
+	return nil
+}
+
+// replay puts the records of a journal entry back in their before (undo)
+// or after (redo) state, through the same checked transactions commands
+// write in
+func (s *replSession) replay(changes []change, undo bool) error {
+	tx, own, err := s.writeTx()
+	if err != nil {
+		return err
+	}
+	if own {
+		defer func() { _ = tx.Rollback() }()
+	}
+
+	restored, err := apply(tx, changes, undo)
+	if err != nil {
+		return err
+	}
+	if !own {
+		// Subgraph members are not transactional; they follow on COMMIT
+		s.restored = append(s.restored, restored...)
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return s.restoreSubgraphs(restored)
+}
+
+// membership is the subgraphs a restored node or edge belongs to
+type membership struct {
+	id        string
+	edge      bool
+	subgraphs []string
+}
+
+// apply writes the before (undo) or after (redo) state of the changes in
+// tx: edges and nodes that did not exist are deleted first, then the
+// others are created or updated, nodes before the edges between them. It
+// returns the subgraphs the records belong to, for restoreSubgraphs.
+func apply(tx storage.Tx, changes []change, undo bool) ([]membership, error) {
+	target := func(c change) (*types.Node, *types.Edge) {
+		if undo {
+			return c.nodeBefore, c.edgeBefore
+		}
+		return c.nodeAfter, c.edgeAfter
+	}
+
+	for _, c := range changes {
+		if _, e := target(c); c.edge && e == nil {
+			if _, ok := tx.GetEdge(c.id); ok {
+				if err := tx.DeleteEdgeByID(c.id); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for _, c := range changes {
+		if n, _ := target(c); !c.edge && n == nil {
+			if _, ok := tx.GetNode(c.id); ok {
+				if err := tx.DetachDeleteNode(c.id); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var restored []membership
+	for _, c := range changes {
+		if n, _ := target(c); !c.edge && n != nil {
+			if err := putNode(tx, n); err != nil {
+				return nil, err
+			}
+			restored = append(restored, membership{id: n.ID, subgraphs: n.Subgraphs})
+		}
+	}
+	for _, c := range changes {
+		if _, e := target(c); c.edge && e != nil {
+			if err := putEdge(tx, e); err != nil {
+				return nil, err
+			}
+			restored = append(restored, membership{id: e.ID, edge: true, subgraphs: e.Subgraphs})
+		}
+	}
+	return restored, nil
+}
+
+// putNode creates or updates a node to have the labels and props of n
+func putNode(tx storage.Tx, n *types.Node) error {
+	current, ok := tx.GetNode(n.ID)
+	if !ok {
+		if err := tx.AddNodeWithID(n.ID, n.Labels[0], n.Props); err != nil {
+			return err
+		}
+		current, _ = tx.GetNode(n.ID)
+	}
+
+	if !slices.Equal(current.Labels, n.Labels) {
+		if err := tx.SetLabel(n.ID, n.Labels[0]); err != nil {
+			return err
+		}
+		for _, l := range n.Labels[1:] {
+			if err := tx.AddLabel(n.ID, l); err != nil {
+				return err
+			}
+		}
+	}
+	if !propsEqual(current.Props, n.Props) {
+		return tx.UpdateNode(n.ID, n.Props)
+	}
+	return nil
+}
+
+// putEdge creates an edge under its ID, or updates its props
+func putEdge(tx storage.Tx, e *types.Edge) error {
+	current, ok := tx.GetEdge(e.ID)
+	if !ok {
+		return tx.AddEdgeWithID(e.ID, e.From, e.To, e.Kind, e.Props)
+	}
+	if !propsEqual(current.Props, e.Props) {
+		return tx.UpdateEdge(e.ID, e.Props)
+	}
+	return nil
+}
+
+func propsEqual(a, b map[string]any) bool {
+	return len(a) == 0 && len(b) == 0 || reflect.DeepEqual(a, b)
+}
+
+// restoreSubgraphs puts restored nodes and edges back in the subgraphs
+// they belonged to, and out of the others. Views are left alone, as they
+// follow the graph by themselves.
+func (s *replSession) restoreSubgraphs(restored []membership) error {
+	var names []string
+	for _, sg := range s.engine.ListSubgraphs() {
+		if !sg.IsView() {
+			names = append(names, sg.Name)
+		}
+	}
+
+	for _, m := range restored {
+		var current []string
+		if m.edge {
+			e, ok := s.engine.GetEdge(m.id)
+			if !ok {
+				continue
+			}
+			current = e.Subgraphs
+		} else {
+			n, ok := s.engine.GetNode(m.id)
+			if !ok {
+				continue
+			}
+			current = n.Subgraphs
+		}
+
+		for _, name := range names {
+			want, has := slices.Contains(m.subgraphs, name), slices.Contains(current, name)
+			var err error
+			switch {
+			case want && !has && m.edge:
+				err = s.engine.AddEdgeToSubgraph(name, m.id)
+			case want && !has:
+				err = s.engine.AddNodesToSubgraph(name, []string{m.id})
+			case has && !want && m.edge:
+				err = s.engine.RemoveEdgeFromSubgraph(name, m.id)
+			case has && !want:
+				err = s.engine.RemoveNodesFromSubgraph(name, []string{m.id})
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// graphState is a copy of some nodes and the edges attached to them
+type graphState struct {
+	nodes map[string]*types.Node
+	edges map[string]*types.Edge
+}
+
+func newGraphState() graphState {
+	return graphState{
+		nodes: make(map[string]*types.Node),
+		edges: make(map[string]*types.Edge),
+	}
+}
+
+func captureState(r storage.Reader, ids []string) graphState {
+	state := newGraphState()
+	for _, id := range ids {
+		state.capture(r, id)
+	}
+	return state
+}
+
+// capture copies a node, nil if it does not exist, and its edges
+func (state graphState) capture(r storage.Reader, id string) {
+	if n, ok := r.GetNode(id); ok {
+		cp := *n
+		cp.Labels = slices.Clone(n.Labels)
+		cp.Props = copyProps(n.Props)
+		cp.Subgraphs = slices.Clone(n.Subgraphs)
+		state.nodes[id] = &cp
+	} else {
+		state.nodes[id] = nil
+	}
+
+	for _, e := range append(r.GetEdgesFrom(id), r.GetEdgesTo(id)...) {
+		cp := *e
+		cp.Props = copyProps(e.Props)
+		cp.Subgraphs = slices.Clone(e.Subgraphs)
+		state.edges[e.ID] = &cp
+	}
+}
+
+// diffState lists the records that differ
+func diffState(before, after graphState) []change {
+	var changes []change
+	for id := range after.nodes {
+		b, a := before.nodes[id], after.nodes[id]
+		if !reflect.DeepEqual(b, a) {
+			changes = append(changes, change{id: id, nodeBefore: b, nodeAfter: a})
+		}
+	}
+
+	edgeIDs := make(map[string]bool)
+	for id := range before.edges {
+		edgeIDs[id] = true
+	}
+	for id := range after.edges {
+		edgeIDs[id] = true
+	}
+	for id := range edgeIDs {
+		b, a := before.edges[id], after.edges[id]
+		if !reflect.DeepEqual(b, a) {
+			changes = append(changes, change{id: id, edge: true, edgeBefore: b, edgeAfter: a})
+		}
+	}
+	return changes
+}
+
+func copyProps(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	cp := make(map[string]any, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
+
+// parseCount parses the optional count of UNDO and REDO
+func parseCount(args string) (int, error) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(args)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid count: %s", args)
+	}
+	return n, nil
+}
@@ -0,0 +1,237 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/aprksy/knitknot/cmd"
+	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/idgen"
+	"github.com/aprksy/knitknot/pkg/storage/inmem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REPL journal", func() {
+	var (
+		ctx     context.Context
+		engine  *graph.GraphEngine
+		session *cmd.Session
+		out     bytes.Buffer
+
+		alice, bob, carol, knows string
+	)
+
+	// run handles a line that must succeed and returns what it printed
+	run := func(line string) string {
+		out.Reset()
+		ExpectWithOffset(1, session.Run(ctx, line, &out)).To(Succeed())
+		return out.String()
+	}
+
+	age := func(id string) any {
+		n, ok := engine.GetNode(id)
+		ExpectWithOffset(1, ok).To(BeTrue())
+		return n.Props["age"]
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		// UUIDv7 IDs are hyphenated, which a word-splitting journal got wrong
+		engine = graph.NewGraphEngine(inmem.New().WithIDGenerator(idgen.NewUUIDv7()))
+		alice, _ = engine.AddNode("Person", map[string]any{"name": "Alice"})
+		bob, _ = engine.AddNode("Person", map[string]any{"name": "Bob"})
+		carol, _ = engine.AddNode("Person", map[string]any{"name": "Carol"})
+		knows, _ = engine.AddEdge(alice, bob, "KNOWS", nil)
+		session = cmd.NewSession(engine)
+		out.Reset()
+	})
+
+	DescribeTable("UNDO reverts a command and REDO applies it again",
+		func(command func() string, applied func()) {
+			before := engine.Storage().GetAllNodes()
+			run(command())
+			applied()
+
+			Expect(run("UNDO")).To(ContainSubstring("-- Undone: "))
+			Expect(engine.Storage().GetAllNodes()).To(HaveLen(len(before)))
+			Expect(age(alice)).To(BeNil())
+			n, _ := engine.GetNode(alice)
+			Expect(n.Labels).To(Equal([]string{"Person"}))
+			e, ok := engine.GetEdge(knows)
+			Expect(ok).To(BeTrue())
+			Expect(e.Props).To(BeEmpty())
+			Expect(engine.Storage().GetEdgesFrom(alice)).To(HaveLen(1))
+
+			Expect(run("REDO")).To(ContainSubstring("-- Redone: "))
+			applied()
+		},
+		Entry("UPDATE NODE",
+			func() string { return "UPDATE NODE " + alice + " age=40" },
+			func() { Expect(age(alice)).To(Equal(40)) }),
+		Entry("UPDATE NODE labels",
+			func() string { return "UPDATE NODE " + alice + " +:Admin" },
+			func() {
+				n, _ := engine.GetNode(alice)
+				Expect(n.Labels).To(ConsistOf("Person", "Admin"))
+			}),
+		Entry("UPDATE EDGE by ID",
+			func() string { return "UPDATE EDGE " + knows + " since=2020" },
+			func() {
+				e, _ := engine.GetEdge(knows)
+				Expect(e.Props).To(HaveKeyWithValue("since", 2020))
+			}),
+		Entry("UPDATE EDGE by its ends",
+			func() string { return "UPDATE EDGE " + alice + " --KNOWS--> " + bob + " since=2020" },
+			func() {
+				e, _ := engine.GetEdge(knows)
+				Expect(e.Props).To(HaveKeyWithValue("since", 2020))
+			}),
+		Entry("CONNECT",
+			func() string { return "CONNECT " + alice + " --LIKES--> " + carol },
+			func() { Expect(engine.Storage().GetEdgesFrom(alice)).To(HaveLen(2)) }),
+		Entry("DELETE EDGE",
+			func() string { return "DELETE EDGE " + knows },
+			func() {
+				_, ok := engine.GetEdge(knows)
+				Expect(ok).To(BeFalse())
+			}),
+		Entry("DELETE NODE DETACH",
+			func() string { return "DELETE NODE " + bob + " DETACH" },
+			func() {
+				_, ok := engine.GetNode(bob)
+				Expect(ok).To(BeFalse())
+			}),
+		Entry("ADDNODE",
+			func() string { return "ADDNODE Person name=Dave" },
+			func() { Expect(engine.Storage().GetAllNodes()).To(HaveLen(4)) }),
+	)
+
+	It("should undo and redo several commands at once", func() {
+		run("UPDATE NODE " + alice + " age=40")
+		run("UPDATE NODE " + alice + " age=41")
+		run("DELETE EDGE " + knows)
+
+		Expect(run("UNDO 2")).To(Equal("-- Undone: DELETE EDGE " + knows + "\n-- Undone: UPDATE NODE " + alice + " age=41\n"))
+		Expect(age(alice)).To(Equal(40))
+		_, ok := engine.GetEdge(knows)
+		Expect(ok).To(BeTrue())
+
+		run("REDO 5")
+		Expect(age(alice)).To(Equal(41))
+		_, ok = engine.GetEdge(knows)
+		Expect(ok).To(BeFalse())
+
+		Expect(session.Run(ctx, "UNDO two", &out)).To(MatchError("invalid count: two"))
+	})
+
+	It("should forget what REDO could apply once something else changes", func() {
+		run("UPDATE NODE " + alice + " age=40")
+		run("UNDO")
+		run("UPDATE NODE " + bob + " age=30")
+		Expect(session.Run(ctx, "REDO", &out)).To(MatchError("nothing to redo"))
+	})
+
+	It("should put back a deleted node's edges under their IDs and its subgraphs", func() {
+		run("SUBGRAPH CREATE team")
+		run("SUBGRAPH ADD team " + alice + " " + bob)
+		run("SUBGRAPH ADD team EDGE " + knows)
+		run("DELETE NODE " + bob + " DETACH")
+
+		run("UNDO")
+		n, ok := engine.GetNode(bob)
+		Expect(ok).To(BeTrue())
+		Expect(n.InSubgraph("team")).To(BeTrue())
+		e, ok := engine.GetEdge(knows)
+		Expect(ok).To(BeTrue())
+		Expect(e.From).To(Equal(alice))
+		Expect(e.To).To(Equal(bob))
+		Expect(engine.Storage().GetEdgesIn("team")).To(HaveLen(1))
+	})
+
+	It("should undo only the commands of an open transaction", func() {
+		run("UPDATE NODE " + bob + " age=30")
+		run("BEGIN")
+		run("ADDNODE Person name=Dave")
+		run("UPDATE NODE " + alice + " age=40")
+
+		Expect(run("UNDO 5")).To(ContainSubstring("-- Undone: ADDNODE Person name=Dave"))
+		Expect(session.Run(ctx, "UNDO", &out)).To(MatchError("nothing to undo"))
+		run("REDO")
+
+		Expect(run("COMMIT")).To(ContainSubstring("-- Committed 1 command(s)"))
+		Expect(age(alice)).To(BeNil())
+		Expect(age(bob)).To(Equal(30))
+		Expect(engine.Storage().GetAllNodes()).To(HaveLen(4))
+	})
+
+	Describe("BEGIN", func() {
+		BeforeEach(func() {
+			Expect(run("BEGIN")).To(ContainSubstring("-- Transaction started"))
+		})
+
+		It("should keep its writes from the engine until COMMIT", func() {
+			run("UPDATE NODE " + alice + " age=40")
+
+			Expect(run("Find('Person').Where('n.age', '=', 40)")).To(ContainSubstring("Alice"))
+			Expect(age(alice)).To(BeNil())
+
+			Expect(run("COMMIT")).To(ContainSubstring("-- Committed 1 command(s)"))
+			Expect(age(alice)).To(Equal(40))
+		})
+
+		It("should discard every command on ROLLBACK", func() {
+			run("UPDATE NODE " + alice + " age=40")
+			run("CONNECT " + alice + " --LIKES--> " + carol)
+			run("DELETE NODE " + bob + " DETACH")
+
+			Expect(run("ROLLBACK")).To(ContainSubstring("-- Rolled back 3 command(s)"))
+			Expect(age(alice)).To(BeNil())
+			_, ok := engine.GetNode(bob)
+			Expect(ok).To(BeTrue())
+			_, ok = engine.GetEdge(knows)
+			Expect(ok).To(BeTrue())
+			Expect(engine.Storage().GetEdgesFrom(alice)).To(HaveLen(1))
+			Expect(session.Run(ctx, "UNDO", &out)).To(MatchError("nothing to undo"))
+		})
+
+		It("should undo a committed transaction as one command", func() {
+			run("UPDATE NODE " + alice + " age=40")
+			run("UPDATE NODE " + alice + " age=41")
+			run("CONNECT " + alice + " --LIKES--> " + carol)
+			run("COMMIT")
+
+			run("UNDO")
+			Expect(age(alice)).To(BeNil())
+			Expect(engine.Storage().GetEdgesFrom(alice)).To(HaveLen(1))
+
+			run("REDO")
+			Expect(age(alice)).To(Equal(41))
+			Expect(engine.Storage().GetEdgesFrom(alice)).To(HaveLen(2))
+		})
+
+		It("should leave the transaction as it was when a command fails", func() {
+			run("UPDATE NODE " + alice + " age=40")
+			out.Reset()
+			Expect(session.Run(ctx, "CONNECT "+alice+" --LIKES--> nobody", &out)).NotTo(Succeed())
+
+			Expect(run("COMMIT")).To(ContainSubstring("-- Committed 1 command(s)"))
+			Expect(age(alice)).To(Equal(40))
+			Expect(engine.Storage().GetEdgesFrom(alice)).To(HaveLen(1))
+		})
+
+		It("should not open a second transaction", func() {
+			Expect(session.Run(ctx, "BEGIN", &out)).To(MatchError("transaction already open"))
+		})
+
+		It("should refuse to change subgraph members", func() {
+			run("SUBGRAPH CREATE team")
+			out.Reset()
+			err := session.Run(ctx, "SUBGRAPH ADD team "+alice, &out)
+			Expect(err).To(MatchError(ContainSubstring("inside a transaction")))
+
+			run("ROLLBACK")
+			Expect(engine.Storage().GetNodesIn("team")).To(BeEmpty())
+		})
+	})
+})
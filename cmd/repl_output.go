@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aprksy/knitknot/pkg/ports/query"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// Output formats for query results in the REPL
+const (
+	outputTable    = "table"
+	outputVertical = "vertical"
+	outputJSON     = "json"
+	outputCSV      = "csv"
+)
+
+var outputFormats = []string{outputTable, outputVertical, outputJSON, outputCSV}
+
+// printResult writes a result set as a table or vertically, followed by
+// the row count and how long the query took. JSON and CSV are streamed by
+// streamResult instead.
+func (s *replSession) printResult(result query.ResultSet, elapsed time.Duration, out io.Writer) error {
+	if result.Empty() {
+		fmt.Fprintf(out, "(no results)\n-- 0 result(s) in %s\n", formatDuration(elapsed))
+		return nil
+	}
+
+	rows := result.Items()
+	vars := orderedVars(rows)
+
+	header, cells := s.tabulate(rows, vars)
+	if s.format == outputVertical {
+		printVertical(header, cells, out)
+	} else {
+		printTable(header, cells, out)
+	}
+
+	fmt.Fprintf(out, "-- %d result(s) in %s\n", result.Len(), formatDuration(elapsed))
+	return nil
+}
+
+// tabulate turns rows into cells. Each variable gets an "ID (Label)"
+// column, then either one column per chosen property or, with
+// \show props, a single column holding all its properties.
+func (s *replSession) tabulate(rows []map[string]*types.Node, vars []string) ([]string, [][]string) {
+	cells := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		cells = append(cells, s.rowCells(row, vars))
+	}
+	return s.columns(vars), cells
+}
+
+// columns is the header row tabulate gives vars
+func (s *replSession) columns(vars []string) []string {
+	var header []string
+	for _, v := range vars {
+		header = append(header, v)
+		if s.showProps {
+			header = append(header, v+".props")
+			continue
+		}
+		for _, p := range s.props {
+			header = append(header, v+"."+p)
+		}
+	}
+	return header
+}
+
+// rowCells is the line tabulate gives one row
+func (s *replSession) rowCells(row map[string]*types.Node, vars []string) []string {
+	var line []string
+	for _, v := range vars {
+		node := row[v]
+		if node == nil {
+			line = append(line, "")
+			if s.showProps {
+				line = append(line, "")
+			} else {
+				line = append(line, make([]string, len(s.props))...)
+			}
+			continue
+		}
+
+		line = append(line, fmt.Sprintf("%s (%s)", node.ID, node.LabelString()))
+		if s.showProps {
+			line = append(line, formatProps(node.Props))
+			continue
+		}
+		for _, p := range s.props {
+			line = append(line, formatValue(node.Props[p]))
+		}
+	}
+	return line
+}
+
+func printTable(header []string, cells [][]string, out io.Writer) {
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = len([]rune(h))
+	}
+	for _, line := range cells {
+		for i, c := range line {
+			if w := len([]rune(c)); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	writeLine := func(line []string) {
+		parts := make([]string, len(line))
+		for i, c := range line {
+			parts[i] = c + strings.Repeat(" ", widths[i]-len([]rune(c)))
+		}
+		fmt.Fprintln(out, strings.TrimRight(strings.Join(parts, " | "), " "))
+	}
+
+	writeLine(header)
+	seps := make([]string, len(header))
+	for i, w := range widths {
+		seps[i] = strings.Repeat("-", w)
+	}
+	fmt.Fprintln(out, strings.Join(seps, "-+-"))
+	for _, line := range cells {
+		writeLine(line)
+	}
+}
+
+func printVertical(header []string, cells [][]string, out io.Writer) {
+	width := 0
+	for _, h := range header {
+		if len(h) > width {
+			width = len(h)
+		}
+	}
+	for i, line := range cells {
+		fmt.Fprintf(out, "-[ row %d ]%s\n", i+1, strings.Repeat("-", width))
+		for j, c := range line {
+			fmt.Fprintf(out, "%-*s : %s\n", width, header[j], c)
+		}
+	}
+}
+
+// streamResult writes the rows of an iterator in the session's JSON or
+// CSV format as they come, passing each to seen, and returns how many
+// there were. It writes nothing when there are none.
+func (s *replSession) streamResult(
+	ctx context.Context,
+	it query.ResultIterator,
+	seen func(map[string]*types.Node),
+	out io.Writer,
+) (int, error) {
+	if s.format == outputCSV {
+		return s.streamCSV(ctx, it, seen, out)
+	}
+	return streamJSON(ctx, it, seen, out)
+}
+
+// streamJSON writes the rows as an indented JSON array, one row at a time
+func streamJSON(ctx context.Context, it query.ResultIterator, seen func(map[string]*types.Node), out io.Writer) (int, error) {
+	count := 0
+	for it.Next(ctx) {
+		row := it.Row()
+		seen(row)
+		data, err := json.MarshalIndent(row, "  ", "  ")
+		if err != nil {
+			return count, err
+		}
+		sep := ",\n  "
+		if count == 0 {
+			sep = "[\n  "
+		}
+		if _, err := fmt.Fprint(out, sep+string(data)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		return count, err
+	}
+	if count > 0 {
+		fmt.Fprint(out, "\n]\n")
+	}
+	return count, nil
+}
+
+// streamCSV writes the rows as CSV under a header row, one row at a time.
+// The columns come from the first row, as every row binds the same
+// variables.
+func (s *replSession) streamCSV(ctx context.Context, it query.ResultIterator, seen func(map[string]*types.Node), out io.Writer) (int, error) {
+	w := csv.NewWriter(out)
+	var vars []string
+	count := 0
+	for it.Next(ctx) {
+		row := it.Row()
+		seen(row)
+		if count == 0 {
+			vars = orderedVars([]map[string]*types.Node{row})
+			if err := w.Write(s.columns(vars)); err != nil {
+				return count, err
+			}
+		}
+		if err := w.Write(s.rowCells(row, vars)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	w.Flush()
+	if err := it.Err(); err != nil {
+		return count, err
+	}
+	return count, w.Error()
+}
+
+// orderedVars lists the variables of all rows: "n" first, then the
+// generated ones in numeric order (v0, v1, ..., v10)
+func orderedVars(rows []map[string]*types.Node) []string {
+	seen := map[string]bool{}
+	var vars []string
+	for _, row := range rows {
+		for v := range row {
+			if !seen[v] {
+				seen[v] = true
+				vars = append(vars, v)
+			}
+		}
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		a, b := vars[i], vars[j]
+		if (a == "n") != (b == "n") {
+			return a == "n"
+		}
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+	return vars
+}
+
+func formatProps(props map[string]any) string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + formatValue(props[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return fmt.Sprintf("%dµs", d.Microseconds())
+	case d < time.Second:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	default:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	}
+}
@@ -0,0 +1,124 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/aprksy/knitknot/cmd"
+	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+	"github.com/aprksy/knitknot/pkg/storage/inmem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REPL output", func() {
+	const alice = "Find('User').Where('n.name', '=', 'Alice')"
+
+	var (
+		ctx     context.Context
+		session *cmd.Session
+		out     bytes.Buffer
+	)
+
+	// query runs a query and splits what it printed into the rows and the
+	// closing count, which carries a timing that varies
+	query := func(q string) (string, string) {
+		out.Reset()
+		ExpectWithOffset(1, session.Run(ctx, q, &out)).To(Succeed())
+		text := out.String()
+		i := strings.LastIndex(text, "-- ")
+		ExpectWithOffset(1, i).To(BeNumerically(">=", 0))
+		return text[:i], text[i:]
+	}
+
+	set := func(setting string) {
+		ExpectWithOffset(1, session.Run(ctx, `\`+setting, &out)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		engine := graph.NewGraphEngine(inmem.New())
+		Expect(engine.AddNodeWithID("u1", "User", map[string]any{"name": "Alice", "age": 30})).To(Succeed())
+		Expect(engine.AddNodeWithID("u2", "User", map[string]any{"name": "Bob", "age": 25})).To(Succeed())
+		Expect(engine.AddNodeWithID("s1", "Skill", map[string]any{"name": "Go"})).To(Succeed())
+		engine.RegisterVerb("HAS_SKILL", types.Verb{TargetLabel: "Skill", MatchOn: "name"})
+		_, err := engine.AddEdge("u1", "s1", "HAS_SKILL", nil)
+		Expect(err).NotTo(HaveOccurred())
+		session = cmd.NewSession(engine)
+		out.Reset()
+	})
+
+	DescribeTable("\\format",
+		func(format, want string) {
+			set("format " + format)
+			rows, count := query(alice)
+			Expect(rows).To(Equal(want))
+			Expect(count).To(MatchRegexp(`^-- 1 result\(s\) in \S+\n$`))
+		},
+		Entry("table", "table",
+			"n         | n.name\n"+
+				"----------+-------\n"+
+				"u1 (User) | Alice\n"),
+		Entry("vertical", "vertical",
+			"-[ row 1 ]------\n"+
+				"n      : u1 (User)\n"+
+				"n.name : Alice\n"),
+		Entry("csv", "csv",
+			"n,n.name\n"+
+				"u1 (User),Alice\n"),
+	)
+
+	It("should print JSON rows with every property", func() {
+		set("format json")
+		rows, count := query(alice)
+		Expect(count).To(MatchRegexp(`^-- 1 result\(s\) in `))
+
+		var got []map[string]map[string]any
+		Expect(json.Unmarshal([]byte(rows), &got)).To(Succeed())
+		Expect(got).To(HaveLen(1))
+		Expect(got[0]["n"]).To(HaveKeyWithValue("id", "u1"))
+		Expect(got[0]["n"]).To(HaveKeyWithValue("props", HaveKeyWithValue("age", BeNumerically("==", 30))))
+	})
+
+	It("should order the columns by variable", func() {
+		rows, _ := query("Find('User').Has('HAS_SKILL', 'Go')")
+		Expect(strings.SplitN(rows, "\n", 2)[0]).To(Equal("n         | n.name | v0         | v0.name"))
+		Expect(rows).To(ContainSubstring("u1 (User) | Alice  | s1 (Skill) | Go"))
+	})
+
+	It("should show the chosen properties", func() {
+		set("props name, age")
+		rows, _ := query(alice)
+		Expect(rows).To(HavePrefix("n         | n.name | n.age\n"))
+		Expect(rows).To(ContainSubstring("u1 (User) | Alice  | 30"))
+	})
+
+	It("should show every property with \\show props", func() {
+		set("show props on")
+		rows, _ := query(alice)
+		Expect(rows).To(ContainSubstring("u1 (User) | age=30 name=Alice"))
+
+		set("show props")
+		rows, _ = query(alice)
+		Expect(rows).To(ContainSubstring("u1 (User) | Alice"))
+	})
+
+	DescribeTable("should report an empty result",
+		func(format string) {
+			set("format " + format)
+			rows, count := query("Find('Nobody')")
+			Expect(rows).To(Equal("(no results)\n"))
+			Expect(count).To(HavePrefix("-- 0 result(s) in "))
+		},
+		Entry("table", "table"),
+		Entry("json", "json"),
+		Entry("csv", "csv"),
+	)
+
+	It("should reject an unknown format", func() {
+		Expect(session.Run(ctx, `\format xml`, &out)).To(MatchError(ContainSubstring(`unknown format "xml"`)))
+	})
+})
@@ -6,11 +6,11 @@ import (
 	"os"
 
 	"github.com/aprksy/knitknot/pkg/graph"
-	"github.com/aprksy/knitknot/pkg/storage/inmem"
+	"github.com/aprksy/knitknot/pkg/ports/storage"
 )
 
 func execSave(engine *graph.GraphEngine, filename string, out io.Writer) error {
-	storage, ok := engine.Storage().(*inmem.Storage)
+	persister, ok := engine.Storage().(storage.Persister)
 	if !ok {
 		return fmt.Errorf("storage does not support saving")
 	}
@@ -19,21 +19,21 @@ func execSave(engine *graph.GraphEngine, filename string, out io.Writer) error {
 		return fmt.Errorf("missing filename")
 	}
 
-	if err := storage.Save(filename, engine); err != nil {
+	if err := persister.Save(filename); err != nil {
 		return fmt.Errorf("save failed: %w", err)
 	}
 
 	info, _ := os.Stat(filename)
 	fmt.Fprintf(out, "-- Saved %d nodes, %d edges to %s (%.1f KB)\n",
-		len(storage.GetAllNodes()),
-		len(storage.GetAllEdges()),
+		len(engine.Storage().GetAllNodes()),
+		len(engine.Storage().GetAllEdges()),
 		filename,
 		float64(info.Size())/1024)
 	return nil
 }
 
 func execLoad(engine *graph.GraphEngine, filename string, out io.Writer) error {
-	storage, ok := engine.Storage().(*inmem.Storage)
+	persister, ok := engine.Storage().(storage.Persister)
 	if !ok {
 		return fmt.Errorf("storage does not support loading")
 	}
@@ -46,13 +46,31 @@ func execLoad(engine *graph.GraphEngine, filename string, out io.Writer) error {
 		return fmt.Errorf("file not found: %s", filename)
 	}
 
-	if err := storage.Load(filename, engine); err != nil {
+	// Keep the current graph aside, so a file whose definitions the engine
+	// rejects does not leave its data behind
+	backup, err := os.CreateTemp("", "knitknot-*.gob")
+	if err != nil {
+		return fmt.Errorf("load failed: %w", err)
+	}
+	backup.Close()
+	defer os.Remove(backup.Name())
+	if err := persister.Save(backup.Name()); err != nil {
+		return fmt.Errorf("load failed: %w", err)
+	}
+
+	if err := persister.Load(filename); err != nil {
+		return fmt.Errorf("load failed: %w", err)
+	}
+	if err := engine.LoadMetadata(); err != nil {
+		if restoreErr := persister.Load(backup.Name()); restoreErr != nil {
+			return fmt.Errorf("load failed: %w (restoring the previous graph: %v)", err, restoreErr)
+		}
 		return fmt.Errorf("load failed: %w", err)
 	}
 
 	fmt.Fprintf(out, "-- Loaded %d nodes, %d edges from %s\n",
-		len(storage.GetAllNodes()),
-		len(storage.GetAllEdges()),
+		len(engine.Storage().GetAllNodes()),
+		len(engine.Storage().GetAllEdges()),
 		filename)
 	return nil
 }
@@ -10,28 +10,89 @@ import (
 	"github.com/aprksy/knitknot/pkg/ports/types"
 )
 
-// definePattern matches: DEFINE has_skill TO Skill VIA name
-var defineRegex = regexp.MustCompile(`(?i)^define\s+(\w+)\s+to\s+(\w+)\s+via\s+(\w+)$`)
+var (
+	// DEFINE reports_to [FROM User] TO User [VIA name] [options...]
+	defineRegex = regexp.MustCompile(`(?i)^define\s+(\w+)(?:\s+from\s+(\w+))?\s+to\s+(\w+)(?:\s+via\s+(@id|\w+))?((?:\s+\S+)*)$`)
+	// DEFINE LABEL User (name string required, age int default 0)
+	defineLabelRegex = regexp.MustCompile(`(?is)^define\s+label\s+(\w+)\s*\((.*)\)$`)
+	// CONSTRAINT NODE KEY User.first,last [AS user_key]
+	constraintRegex = regexp.MustCompile(`(?i)^(unique|exists|node\s+key|key)\s+(\w+)\.(\w+(?:\s*,\s*\w+)*)(?:\s+as\s+(\w+))?$`)
+)
+
+const defineUsage = "invalid syntax. Use: DEFINE <verb> [FROM <Label>] TO <Label> [VIA <property>|@id] [UNIQUE] " +
+	"[ONE|MANY TO ONE|MANY] [INVERSE <name>] [SYMMETRIC] [PROPS a,b] | " +
+	"DEFINE LABEL <Label> (<prop> <type> [REQUIRED] [UNIQUE] [DEFAULT value], ...)"
 
 func execDefine(engine *graph.GraphEngine, input string, out io.Writer) error {
 	input = strings.TrimSpace(input)
+	if m := defineLabelRegex.FindStringSubmatch(input); m != nil {
+		return execDefineLabel(engine, m[1], m[2], out)
+	}
+
 	matches := defineRegex.FindStringSubmatch(input)
-	fmt.Printf("%s; matches: %v\n", input, matches)
-	if len(matches) != 4 {
-		return fmt.Errorf("invalid syntax. Use: DEFINE <verb> TO <Label> VIA <property>")
+	if matches == nil {
+		return fmt.Errorf(defineUsage)
 	}
 
 	verbName := matches[1]
-	targetLabel := matches[2]
-	matchOn := matches[3]
-
 	def := types.Verb{
-		TargetLabel: targetLabel,
-		MatchOn:     matchOn,
+		SourceLabel: matches[2],
+		TargetLabel: matches[3],
+		MatchOn:     matches[4],
+	}
+	if err := parseVerbOptions(&def, strings.Fields(matches[5])); err != nil {
+		return err
 	}
 
-	engine.RegisterVerb(verbName, def)
-	fmt.Fprintf(out, "-- Verb '%s' defined: → %s.%s\n", verbName, targetLabel, matchOn)
+	if err := engine.DefineVerb(verbName, def); err != nil {
+		return err
+	}
+	def, _ = engine.Verbs().Lookup(verbName)
+	fmt.Fprintf(out, "-- Verb '%s' defined: %s%s\n", verbName, verbTarget(def), verbNotes(def))
+	return nil
+}
+
+// parseVerbOptions reads the options after DEFINE ... TO <Label> [VIA p]
+func parseVerbOptions(def *types.Verb, words []string) error {
+	for i := 0; i < len(words); i++ {
+		switch w := strings.ToLower(words[i]); w {
+		case "unique":
+			def.Unique = true
+		case "symmetric":
+			def.Symmetric = true
+		case "inverse", "props":
+			if i+1 == len(words) {
+				return fmt.Errorf("%s needs a value", strings.ToUpper(w))
+			}
+			i++
+			if w == "inverse" {
+				def.Inverse = words[i]
+				continue
+			}
+			for _, p := range strings.Split(words[i], ",") {
+				if p != "" {
+					def.EdgeProps = append(def.EdgeProps, p)
+				}
+			}
+		case "one", "many":
+			// ONE TO MANY, written as three words
+			if i+2 >= len(words) || !strings.EqualFold(words[i+1], "to") {
+				return fmt.Errorf("invalid cardinality; use ONE|MANY TO ONE|MANY")
+			}
+			c, err := types.ParseCardinality(strings.Join(words[i:i+3], " "))
+			if err != nil {
+				return err
+			}
+			def.Cardinality = c
+			i += 2
+		default:
+			c, err := types.ParseCardinality(w) // many-to-one
+			if err != nil {
+				return fmt.Errorf("unknown DEFINE option %q", words[i])
+			}
+			def.Cardinality = c
+		}
+	}
 	return nil
 }
 
@@ -54,14 +115,231 @@ func execListVerbs(engine *graph.GraphEngine, out io.Writer) error {
 		maxName = 5
 	}
 
-	fmt.Fprintf(out, "%-*s → Target.Property\n", maxName, "VERB")
+	fmt.Fprintf(out, "%-*s [Source] → Target.Property\n", maxName, "VERB")
 	fmt.Fprintln(out, strings.Repeat("-", maxName+20))
 	for name, v := range verbs {
-		prop := v.MatchOn
-		if prop == "" {
-			prop = "(any)"
+		fmt.Fprintf(out, "%-*s %s%s\n", maxName, name, verbTarget(v), verbNotes(v))
+	}
+	return nil
+}
+
+// verbTarget shows a verb as e.g. "User → Skill.name"
+func verbTarget(v types.Verb) string {
+	prop := v.MatchOn
+	if prop == "" {
+		prop = types.DefaultMatchProperty
+	}
+	target := fmt.Sprintf("→ %s.%s", v.TargetLabel, prop)
+	if v.SourceLabel != "" {
+		target = v.SourceLabel + " " + target
+	}
+	return target
+}
+
+func verbNotes(v types.Verb) string {
+	var notes []string
+	if v.Unique {
+		notes = append(notes, "unique")
+	}
+	if v.Cardinality != "" && v.Cardinality != types.ManyToMany {
+		notes = append(notes, v.Cardinality.String())
+	}
+	if v.Symmetric {
+		notes = append(notes, "symmetric")
+	}
+	if v.Inverse != "" {
+		notes = append(notes, "inverse "+v.Inverse)
+	}
+	if v.EdgeProps != nil {
+		notes = append(notes, "props "+strings.Join(v.EdgeProps, ","))
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(notes, ", ") + ")"
+}
+
+// execDefineLabel registers a label schema from its property list:
+// name type [REQUIRED] [UNIQUE] [DEFAULT value], ...
+func execDefineLabel(engine *graph.GraphEngine, label, list string, out io.Writer) error {
+	schema := types.LabelSchema{Label: label}
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		p, err := parsePropertyDef(item)
+		if err != nil {
+			return err
+		}
+		schema.Properties = append(schema.Properties, p)
+	}
+
+	if err := engine.DefineLabel(schema); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "-- Label '%s' defined with %d propert%s\n", label, len(schema.Properties), plural(len(schema.Properties), "y", "ies"))
+	return nil
+}
+
+func parsePropertyDef(item string) (types.PropertyDef, error) {
+	fields := strings.Fields(item)
+	if len(fields) < 2 {
+		return types.PropertyDef{}, fmt.Errorf("invalid property %q (want: name type [REQUIRED] [UNIQUE] [DEFAULT value])", strings.TrimSpace(item))
+	}
+
+	t, err := types.ParsePropType(fields[1])
+	if err != nil {
+		return types.PropertyDef{}, fmt.Errorf("%s: %w", fields[0], err)
+	}
+	p := types.PropertyDef{Name: fields[0], Type: t}
+
+	for i := 2; i < len(fields); i++ {
+		switch strings.ToLower(fields[i]) {
+		case "required":
+			p.Required = true
+		case "unique":
+			p.Unique = true
+		case "default":
+			if i+1 == len(fields) {
+				return p, fmt.Errorf("%s: DEFAULT needs a value", p.Name)
+			}
+			i++
+			v, err := t.Coerce(strings.Trim(fields[i], `"'`))
+			if err != nil {
+				return p, fmt.Errorf("%s default: %w", p.Name, err)
+			}
+			p.Default = v
+		default:
+			return p, fmt.Errorf("%s: unknown modifier %q", p.Name, fields[i])
+		}
+	}
+	return p, nil
+}
+
+// execDescribe shows the schema of a label and how many nodes carry it
+func execDescribe(engine *graph.GraphEngine, label string, out io.Writer) error {
+	count := 0
+	for _, n := range engine.Storage().GetAllNodes() {
+		if n.HasLabel(label) {
+			count++
+		}
+	}
+
+	schema, ok := engine.Schemas().Lookup(label)
+	if !ok {
+		if count == 0 && !hasConstraints(engine, label) {
+			return fmt.Errorf("unknown label %s", label)
+		}
+		fmt.Fprintf(out, "%s: no schema, %d node(s)\n", label, count)
+		describeConstraints(engine, label, out)
+		return nil
+	}
+
+	fmt.Fprintf(out, "%s: %d node(s)\n", label, count)
+	defer describeConstraints(engine, label, out)
+	if len(schema.Properties) == 0 {
+		fmt.Fprintln(out, "(no properties declared)")
+		return nil
+	}
+
+	props := schema.Properties
+	maxName := len("PROPERTY")
+	for _, p := range props {
+		maxName = max(maxName, len(p.Name))
+	}
+	fmt.Fprintf(out, "%-*s %-6s %-8s %-6s  %s\n", maxName, "PROPERTY", "TYPE", "REQUIRED", "UNIQUE", "DEFAULT")
+	fmt.Fprintln(out, strings.Repeat("-", maxName+40))
+	for _, p := range props {
+		def := ""
+		if p.Default != nil {
+			def = fmt.Sprintf("%#v", p.Default)
 		}
-		fmt.Fprintf(out, "%-*s → %s.%s\n", maxName, name, v.TargetLabel, prop)
+		fmt.Fprintf(out, "%-*s %-6s %-8s %-6s  %s\n", maxName, p.Name, p.Type, yesNo(p.Required), yesNo(p.Unique), def)
 	}
 	return nil
 }
+
+func hasConstraints(engine *graph.GraphEngine, label string) bool {
+	for _, c := range engine.Constraints() {
+		if c.Label == label {
+			return true
+		}
+	}
+	return false
+}
+
+func describeConstraints(engine *graph.GraphEngine, label string, out io.Writer) {
+	for _, c := range engine.Constraints() {
+		if c.Label == label {
+			fmt.Fprintf(out, "constraint %s: %s\n", c.Name, c)
+		}
+	}
+}
+
+// execConstraint runs CONSTRAINT UNIQUE|EXISTS|NODE KEY and CONSTRAINT
+// DROP. Like DEFINE, they are not journaled.
+func execConstraint(engine *graph.GraphEngine, args string, out io.Writer) error {
+	args = strings.TrimSpace(args)
+	if name, ok := cutKeyword(args, "drop"); ok {
+		if err := engine.DropConstraint(name); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "-- Constraint '%s' dropped\n", name)
+		return nil
+	}
+
+	m := constraintRegex.FindStringSubmatch(args)
+	if m == nil {
+		return fmt.Errorf("invalid syntax. Use: CONSTRAINT UNIQUE|EXISTS|NODE KEY <Label>.<prop>[,<prop>...] [AS <name>] | CONSTRAINT DROP <name>")
+	}
+	kind, err := types.ParseConstraintKind(strings.Join(strings.Fields(m[1]), " "))
+	if err != nil {
+		return err
+	}
+	c := types.Constraint{Name: m[4], Kind: kind, Label: m[2]}
+	for _, p := range strings.Split(m[3], ",") {
+		c.Properties = append(c.Properties, strings.TrimSpace(p))
+	}
+	if c.Name == "" {
+		c.Name = c.DefaultName()
+	}
+
+	if err := engine.CreateConstraint(c); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "-- Constraint '%s' created: %s\n", c.Name, c)
+	return nil
+}
+
+func execListConstraints(engine *graph.GraphEngine, out io.Writer) error {
+	constraints := engine.Constraints()
+	if len(constraints) == 0 {
+		fmt.Fprintln(out, "(no constraints)")
+		return nil
+	}
+
+	maxName := len("CONSTRAINT")
+	for _, c := range constraints {
+		maxName = max(maxName, len(c.Name))
+	}
+	fmt.Fprintf(out, "%-*s  %s\n", maxName, "CONSTRAINT", "RULE")
+	fmt.Fprintln(out, strings.Repeat("-", maxName+30))
+	for _, c := range constraints {
+		fmt.Fprintf(out, "%-*s  %s\n", maxName, c.Name, c)
+	}
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+// defaultPager is used when $PAGER is not set
+const defaultPager = "less -FRX"
+
+// execSetting handles backslash commands that change session settings:
+//
+//	\format table|vertical|json|csv
+//	\props name,age
+//	\show props [on|off]
+//	\pager on|off
+func (s *replSession) execSetting(input string, out io.Writer) error {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return fmt.Errorf("missing setting name")
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "format":
+		if len(fields) == 1 {
+			fmt.Fprintf(out, "-- format is %s\n", s.format)
+			return nil
+		}
+		format := strings.ToLower(fields[1])
+		if !slices.Contains(outputFormats, format) {
+			return fmt.Errorf("unknown format %q (use %s)", fields[1], strings.Join(outputFormats, ", "))
+		}
+		s.format = format
+		fmt.Fprintf(out, "-- format %s\n", s.format)
+		return nil
+
+	case "props":
+		if len(fields) > 1 {
+			var props []string
+			for _, p := range strings.Split(strings.Join(fields[1:], ","), ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					props = append(props, p)
+				}
+			}
+			s.props = props
+		}
+		fmt.Fprintf(out, "-- props: %s\n", strings.Join(s.props, ", "))
+		return nil
+
+	case "show":
+		if len(fields) < 2 || !strings.EqualFold(fields[1], "props") {
+			return fmt.Errorf("usage: \\show props [on|off]")
+		}
+		if len(fields) > 2 {
+			on, err := parseOnOff(fields[2])
+			if err != nil {
+				return err
+			}
+			s.showProps = on
+		} else {
+			s.showProps = !s.showProps
+		}
+		fmt.Fprintf(out, "-- show props %s\n", onOff(s.showProps))
+		return nil
+
+	case "pager":
+		if len(fields) == 1 {
+			fmt.Fprintf(out, "-- pager is %s\n", onOff(s.pager))
+			return nil
+		}
+		on, err := parseOnOff(fields[1])
+		if err != nil {
+			return err
+		}
+		s.pager = on
+		fmt.Fprintf(out, "-- pager %s\n", onOff(s.pager))
+		return nil
+	}
+
+	return fmt.Errorf("unknown setting: \\%s", fields[0])
+}
+
+// errPagerClosed is returned by writes to a pager the user has quit, so
+// a streaming statement stops early
+var errPagerClosed = errors.New("pager closed")
+
+// output returns where a statement writes: straight to out or, with paging
+// on, through $PAGER once the output outgrows the screen. Only the first
+// screenful is held back, so streamed rows reach the pager as they come.
+// Close it when the statement is done.
+func (s *replSession) output(out io.Writer) io.WriteCloser {
+	if !s.pager {
+		return nopCloser{out}
+	}
+	return &pagedWriter{out: out, height: screenHeight()}
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// pagedWriter holds output until it no longer fits on the screen, then
+// starts the pager and feeds it from there on
+type pagedWriter struct {
+	out    io.Writer
+	height int
+	held   bytes.Buffer
+
+	cmd    *exec.Cmd
+	pipe   io.WriteCloser
+	direct bool // the pager could not start; write to out
+	closed bool // the user quit the pager
+}
+
+func (w *pagedWriter) Write(p []byte) (int, error) {
+	switch {
+	case w.closed:
+		return 0, errPagerClosed
+	case w.direct:
+		return w.out.Write(p)
+	case w.pipe != nil:
+		if _, err := w.pipe.Write(p); err != nil {
+			w.closed = true
+			return 0, errPagerClosed
+		}
+		return len(p), nil
+	}
+
+	w.held.Write(p)
+	if bytes.Count(w.held.Bytes(), []byte("\n")) < w.height-1 {
+		return len(p), nil
+	}
+	if err := w.start(); err != nil {
+		// Fall back to plain output rather than losing it
+		w.direct = true
+		if _, err := w.out.Write(w.held.Bytes()); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if _, err := w.pipe.Write(w.held.Bytes()); err != nil {
+		w.closed = true
+		return 0, errPagerClosed
+	}
+	w.held.Reset()
+	return len(p), nil
+}
+
+func (w *pagedWriter) start() error {
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = defaultPager
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	pipe, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	w.cmd, w.pipe = cmd, pipe
+	return nil
+}
+
+// Close writes out what is held back, or waits for the user to leave the
+// pager
+func (w *pagedWriter) Close() error {
+	if w.pipe == nil {
+		_, err := w.out.Write(w.held.Bytes())
+		w.held.Reset()
+		return err
+	}
+	_ = w.pipe.Close()
+	_ = w.cmd.Wait()
+	w.pipe = nil
+	return nil
+}
+
+func screenHeight() int {
+	if _, h, err := readline.GetSize(int(os.Stdout.Fd())); err == nil && h > 0 {
+		return h
+	}
+	return 24
+}
+
+func parseOnOff(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "true", "1":
+		return true, nil
+	case "off", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected on or off, got %q", s)
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,102 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aprksy/knitknot/cmd"
+	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/storage/inmem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REPL input and paging", func() {
+	DescribeTable("needsMore",
+		func(input string, more bool) {
+			Expect(cmd.NeedsMore(input)).To(Equal(more))
+		},
+		Entry("an open parenthesis", "Find('User'", true),
+		Entry("a trailing dot", "Find('User').", true),
+		Entry("a complete query", "Find('User').Limit(5)", false),
+		Entry("an EXPLAIN left open", "EXPLAIN Find('User').", true),
+		Entry("a REPL command", "ADDNODE User name=(", false),
+	)
+
+	DescribeTable("highlight",
+		func(input, want string) {
+			Expect(cmd.Highlight(input)).To(ContainSubstring(want))
+		},
+		Entry("a REPL command", "ADDNODE User name=Alice", "\033[35mADDNODE\033[0m User name=Alice"),
+		Entry("a method", "Find('User')", "\033[36mFind\033[0m("),
+		Entry("a string", "Find('User')", "\033[32m'User'\033[0m"),
+		Entry("a number", "Find('User').Limit(5)", "\033[33m5\033[0m"),
+		Entry("a query after EXPLAIN", "EXPLAIN Find('User')", "\033[36mFind\033[0m"),
+	)
+
+	Describe("\\pager", func() {
+		var (
+			ctx     context.Context
+			session *cmd.Session
+			out     bytes.Buffer
+			paged   string
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			session = cmd.NewSession(graph.NewGraphEngine(inmem.New()))
+			out.Reset()
+			paged = filepath.Join(GinkgoT().TempDir(), "paged")
+			GinkgoT().Setenv("PAGER", "cat > "+paged)
+		})
+
+		lines := func(n int) string {
+			return strings.Repeat("row\n", n)
+		}
+
+		It("should toggle paging", func() {
+			Expect(session.Run(ctx, `\pager on`, &out)).To(Succeed())
+			Expect(out.String()).To(Equal("-- pager on\n"))
+			Expect(session.Run(ctx, `\pager maybe`, &out)).To(MatchError(ContainSubstring("expected on or off")))
+		})
+
+		It("should write straight through with paging off", func() {
+			w := session.Output(&out)
+			_, err := w.Write([]byte(lines(100)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+			Expect(out.String()).To(Equal(lines(100)))
+			Expect(paged).NotTo(BeAnExistingFile())
+		})
+
+		It("should print output that fits on the screen itself", func() {
+			Expect(session.Run(ctx, `\pager on`, &out)).To(Succeed())
+			out.Reset()
+
+			w := session.Output(&out)
+			_, err := w.Write([]byte(lines(3)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.String()).To(BeEmpty())
+			Expect(w.Close()).To(Succeed())
+			Expect(out.String()).To(Equal(lines(3)))
+			Expect(paged).NotTo(BeAnExistingFile())
+		})
+
+		It("should send longer output through the pager", func() {
+			Expect(session.Run(ctx, `\pager on`, &out)).To(Succeed())
+			out.Reset()
+
+			w := session.Output(&out)
+			for range 100 {
+				_, err := w.Write([]byte(lines(1)))
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(w.Close()).To(Succeed())
+			Expect(out.String()).To(BeEmpty())
+			Expect(os.ReadFile(paged)).To(Equal([]byte(lines(100))))
+		})
+	})
+})
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// execSource runs a script file inside the REPL. The script stops at the
+// first failing statement unless CONTINUE is appended:
+//
+//	SOURCE 'setup.kk'
+//	SOURCE 'setup.kk' CONTINUE
+func execSource(ctx context.Context, session *replSession, input string, out io.Writer) error {
+	input = strings.TrimSpace(input)
+	keepGoing := false
+	if fields := strings.Fields(input); len(fields) > 1 && strings.EqualFold(fields[len(fields)-1], "continue") {
+		keepGoing = true
+		input = strings.TrimSpace(input[:strings.LastIndex(input, fields[len(fields)-1])])
+	}
+
+	filename := strings.Trim(strings.Trim(input, `"`), `'`)
+	if filename == "" {
+		return fmt.Errorf("usage: SOURCE 'file.kk' [CONTINUE]")
+	}
+
+	summary, err := execScriptFile(ctx, session, filename, keepGoing, out)
+	if err != nil {
+		return err
+	}
+	if summary.Failed > 0 && !keepGoing {
+		return fmt.Errorf("%s aborted at line %d", filename, summary.FailedAt)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+var (
+	// SUBGRAPH CREATE org "Org chart" [INDUCED|EXPLICIT]
+	subgraphCreateRegex = regexp.MustCompile(`(?i)^create\s+(\w+)(?:\s+"([^"]*)")?(?:\s+(induced|explicit))?$`)
+	// SUBGRAPH ADD org <query | ids | $vars | EDGE id>
+	subgraphMemberRegex = regexp.MustCompile(`(?is)^(add|remove)\s+(\w+)\s+(.+)$`)
+	// VIEW seniors AS Find('User').Where('n.age', '>', 50)
+	viewRegex = regexp.MustCompile(`(?is)^view\s+(\w+)\s+as\s+(.+)$`)
+)
+
+// errMembersInTx is returned by the commands that change subgraph members
+// inside a transaction: members are kept outside of transactions, so
+// ROLLBACK could not take them back
+var errMembersInTx = errors.New("cannot change subgraph members inside a transaction; COMMIT or ROLLBACK first")
+
+// execSubgraph runs SUBGRAPH CREATE, DROP, MODE, ADD and REMOVE. Membership
+// changes are journaled like other data commands; the others are not,
+// like DEFINE.
+func (s *replSession) execSubgraph(ctx context.Context, args string, out io.Writer) error {
+	args = strings.TrimSpace(args)
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return fmt.Errorf("invalid syntax. Use: SUBGRAPH CREATE|DROP|MODE|ADD|REMOVE <name> ...")
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "create":
+		m := subgraphCreateRegex.FindStringSubmatch(args)
+		if m == nil {
+			return fmt.Errorf(`invalid syntax. Use: SUBGRAPH CREATE <name> ["description"] [INDUCED|EXPLICIT]`)
+		}
+		if err := s.engine.CreateSubgraph(m[1], m[2]); err != nil {
+			return err
+		}
+		if m[3] != "" {
+			if err := s.engine.SetSubgraphMode(m[1], types.SubgraphMode(strings.ToLower(m[3]))); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(out, "-- Subgraph '%s' created\n", m[1])
+		return nil
+
+	case "mode":
+		if len(fields) != 3 {
+			return fmt.Errorf("invalid syntax. Use: SUBGRAPH MODE <name> INDUCED|EXPLICIT")
+		}
+		mode, err := types.ParseSubgraphMode(fields[2])
+		if err != nil {
+			return err
+		}
+		if err := s.engine.SetSubgraphMode(fields[1], mode); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "-- Subgraph '%s' is %s\n", fields[1], mode)
+		return nil
+
+	case "drop":
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid syntax. Use: SUBGRAPH DROP <name>")
+		}
+		if s.inTx() {
+			return errMembersInTx
+		}
+		if err := s.engine.DropSubgraph(fields[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "-- Subgraph '%s' dropped\n", fields[1])
+		return nil
+
+	case "add", "remove":
+		m := subgraphMemberRegex.FindStringSubmatch(args)
+		if m == nil {
+			return fmt.Errorf("invalid syntax. Use: SUBGRAPH %s <name> <query | node IDs | EDGE id>", strings.ToUpper(fields[0]))
+		}
+		return s.execSubgraphMembers(ctx, strings.ToLower(m[1]), m[2], strings.TrimSpace(m[3]), out)
+	}
+	return fmt.Errorf("unknown SUBGRAPH command: %s", fields[0])
+}
+
+func (s *replSession) execSubgraphMembers(ctx context.Context, op, name, target string, out io.Writer) error {
+	if s.inTx() {
+		return errMembersInTx
+	}
+
+	if rest, ok := cutKeyword(target, "edge"); ok {
+		id, err := s.expandVars(rest)
+		if err != nil {
+			return err
+		}
+		var ends []string
+		if e, ok := s.engine.GetEdge(id); ok {
+			ends = []string{e.From, e.To}
+		}
+		command := fmt.Sprintf("SUBGRAPH %s %s EDGE %s", strings.ToUpper(op), name, id)
+		return s.recordMembers(command, ends, func() error {
+			if op == "add" {
+				err = s.engine.AddEdgeToSubgraph(name, id)
+			} else {
+				err = s.engine.RemoveEdgeFromSubgraph(name, id)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "-- Edge %s %s subgraph '%s'\n", id, opNote(op), name)
+			return nil
+		})
+	}
+
+	ids, err := s.targetNodes(ctx, target)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		fmt.Fprintln(out, "-- No nodes matched")
+		return nil
+	}
+
+	command := fmt.Sprintf("SUBGRAPH %s %s %s", strings.ToUpper(op), name, strings.Join(ids, " "))
+	return s.recordMembers(command, ids, func() error {
+		if op == "add" {
+			err = s.engine.AddNodesToSubgraph(name, ids)
+		} else {
+			err = s.engine.RemoveNodesFromSubgraph(name, ids)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "-- %d node(s) %s subgraph '%s'\n", len(ids), opNote(op), name)
+		return nil
+	})
+}
+
+// targetNodes resolves a query, or a list of node IDs and variables, to
+// node IDs
+func (s *replSession) targetNodes(ctx context.Context, target string) ([]string, error) {
+	if strings.Contains(target, "(") {
+		result, err := s.runQuery(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		return resultIDs(result), nil
+	}
+
+	var ids []string
+	for _, word := range strings.Fields(target) {
+		if ref := varRegex.FindStringSubmatch(word); ref != nil && ref[0] == word {
+			bound, ok := s.vars[ref[1]]
+			if !ok {
+				return nil, fmt.Errorf("undefined variable $%s", ref[1])
+			}
+			ids = append(ids, bound...)
+			continue
+		}
+		ids = append(ids, word)
+	}
+	return ids, nil
+}
+
+// execView defines a view: a subgraph holding the results of a query,
+// kept up to date as the graph changes
+func (s *replSession) execView(input string, out io.Writer) error {
+	m := viewRegex.FindStringSubmatch(strings.TrimSpace(input))
+	if m == nil {
+		return fmt.Errorf("invalid syntax. Use: VIEW <name> AS <query>")
+	}
+	if varRegex.MatchString(m[2]) {
+		return fmt.Errorf("a view cannot use variables; they are not saved with the graph")
+	}
+	if s.inTx() {
+		return errMembersInTx
+	}
+	if err := s.engine.CreateView(m[1], strings.TrimSpace(m[2])); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "-- View '%s' created with %d node(s)\n", m[1], len(s.engine.Storage().GetNodesIn(m[1])))
+	return nil
+}
+
+func execListSubgraphs(s *replSession, out io.Writer) error {
+	subgraphs := s.engine.ListSubgraphs()
+	if len(subgraphs) == 0 {
+		fmt.Fprintln(out, "(no subgraphs)")
+		return nil
+	}
+
+	maxName := len("SUBGRAPH")
+	for _, sg := range subgraphs {
+		maxName = max(maxName, len(sg.Name))
+	}
+
+	store := s.engine.Storage()
+	fmt.Fprintf(out, "%-*s %-8s %6s %6s  %s\n", maxName, "SUBGRAPH", "MODE", "NODES", "EDGES", "DESCRIPTION")
+	fmt.Fprintln(out, strings.Repeat("-", maxName+40))
+	for _, sg := range subgraphs {
+		desc := sg.Description
+		if sg.IsView() {
+			desc = "view: " + sg.Query
+		}
+		mode := types.SubgraphInduced
+		if !sg.Induced() {
+			mode = types.SubgraphExplicit
+		}
+		fmt.Fprintf(out, "%-*s %-8s %6d %6d  %s\n", maxName, sg.Name, mode,
+			len(store.GetNodesIn(sg.Name)), len(store.GetEdgesIn(sg.Name)), desc)
+	}
+	return nil
+}
+
+// cutKeyword removes a leading keyword (any case) followed by a space
+func cutKeyword(input, keyword string) (string, bool) {
+	if len(input) <= len(keyword) || !strings.EqualFold(input[:len(keyword)], keyword) || input[len(keyword)] != ' ' {
+		return input, false
+	}
+	return strings.TrimSpace(input[len(keyword):]), true
+}
+
+func opNote(op string) string {
+	if op == "add" {
+		return "added to"
+	}
+	return "removed from"
+}
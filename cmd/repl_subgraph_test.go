@@ -0,0 +1,129 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/aprksy/knitknot/cmd"
+	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/storage/inmem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REPL subgraphs", func() {
+	var (
+		ctx     context.Context
+		engine  *graph.GraphEngine
+		session *cmd.Session
+		out     bytes.Buffer
+		knows   string
+	)
+
+	run := func(line string) string {
+		out.Reset()
+		ExpectWithOffset(1, session.Run(ctx, line, &out)).To(Succeed())
+		return out.String()
+	}
+
+	members := func(name string) []string {
+		var ids []string
+		for _, n := range engine.Storage().GetNodesIn(name) {
+			ids = append(ids, n.ID)
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		engine = graph.NewGraphEngine(inmem.New())
+		Expect(engine.AddNodeWithID("u1", "User", map[string]any{"name": "Alice", "age": 60})).To(Succeed())
+		Expect(engine.AddNodeWithID("u2", "User", map[string]any{"name": "Bob", "age": 30})).To(Succeed())
+		Expect(engine.AddNodeWithID("u3", "User", map[string]any{"name": "Carol", "age": 55})).To(Succeed())
+		var err error
+		knows, err = engine.AddEdge("u1", "u3", "KNOWS", nil)
+		Expect(err).NotTo(HaveOccurred())
+		session = cmd.NewSession(engine)
+		out.Reset()
+	})
+
+	It("should create subgraphs and list them", func() {
+		Expect(run(`SUBGRAPH CREATE org "Org chart"`)).To(Equal("-- Subgraph 'org' created\n"))
+		run("SUBGRAPH CREATE picks EXPLICIT")
+		run("SUBGRAPH ADD org u1 u3")
+
+		listing := run("SUBGRAPHS")
+		Expect(listing).To(MatchRegexp(`org\s+induced\s+2\s+1\s+Org chart`))
+		Expect(listing).To(MatchRegexp(`picks\s+explicit\s+0\s+0`))
+	})
+
+	DescribeTable("SUBGRAPH ADD",
+		func(target string, want []string) {
+			run("SUBGRAPH CREATE org")
+			run("LET bob = Find('User').Where('n.name', '=', 'Bob')")
+			Expect(run("SUBGRAPH ADD org " + target)).To(ContainSubstring("added to subgraph 'org'"))
+			Expect(members("org")).To(ConsistOf(want))
+		},
+		Entry("a query's nodes", "Find('User').Where('n.age', '>', 50)", []string{"u1", "u3"}),
+		Entry("node IDs", "u1 u2", []string{"u1", "u2"}),
+		Entry("a variable", "$bob", []string{"u2"}),
+	)
+
+	It("should take edges only as added in an explicit subgraph", func() {
+		run("SUBGRAPH CREATE picks EXPLICIT")
+		run("SUBGRAPH ADD picks u1 u3")
+		Expect(engine.Storage().GetEdgesIn("picks")).To(BeEmpty())
+
+		Expect(run("SUBGRAPH ADD picks EDGE " + knows)).To(Equal("-- Edge " + knows + " added to subgraph 'picks'\n"))
+		Expect(engine.Storage().GetEdgesIn("picks")).To(HaveLen(1))
+
+		run("SUBGRAPH REMOVE picks EDGE " + knows)
+		Expect(engine.Storage().GetEdgesIn("picks")).To(BeEmpty())
+
+		Expect(run("SUBGRAPH MODE picks INDUCED")).To(Equal("-- Subgraph 'picks' is induced\n"))
+		Expect(engine.Storage().GetEdgesIn("picks")).To(HaveLen(1))
+	})
+
+	It("should undo and redo membership changes", func() {
+		run("SUBGRAPH CREATE org")
+		run("SUBGRAPH ADD org u1 u2")
+		run("SUBGRAPH REMOVE org u2")
+		Expect(members("org")).To(ConsistOf("u1"))
+
+		run("UNDO")
+		Expect(members("org")).To(ConsistOf("u1", "u2"))
+		run("UNDO")
+		Expect(members("org")).To(BeEmpty())
+		run("REDO")
+		Expect(members("org")).To(ConsistOf("u1", "u2"))
+	})
+
+	It("should keep the nodes of a dropped subgraph", func() {
+		run("SUBGRAPH CREATE org")
+		run("SUBGRAPH ADD org u1")
+		Expect(run("SUBGRAPH DROP org")).To(Equal("-- Subgraph 'org' dropped\n"))
+
+		Expect(run("SUBGRAPHS")).To(Equal("(no subgraphs)\n"))
+		n, ok := engine.GetNode("u1")
+		Expect(ok).To(BeTrue())
+		Expect(n.InSubgraph("org")).To(BeFalse())
+	})
+
+	It("should keep a view up to date", func() {
+		Expect(run("VIEW seniors AS Find('User').Where('n.age', '>', 50)")).To(Equal("-- View 'seniors' created with 2 node(s)\n"))
+
+		run("UPDATE NODE u2 age=70")
+		Expect(members("seniors")).To(ConsistOf("u1", "u2", "u3"))
+		Expect(run("SUBGRAPHS")).To(ContainSubstring("view: Find('User').Where('n.age', '>', 50)"))
+	})
+
+	DescribeTable("should reject",
+		func(line, msg string) {
+			Expect(session.Run(ctx, line, &out)).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("a CREATE without a name", "SUBGRAPH CREATE", "invalid syntax"),
+		Entry("an unknown mode", "SUBGRAPH MODE org SPARSE", "SPARSE"),
+		Entry("an unknown command", "SUBGRAPH MERGE org", "unknown SUBGRAPH command"),
+		Entry("a view using a variable", "VIEW mine AS Find('User').Where('n', '=', $_)", "cannot use variables"),
+	)
+})
@@ -3,114 +3,166 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 
-	"github.com/aprksy/knitknot/pkg/graph"
-	"github.com/aprksy/knitknot/pkg/storage/inmem"
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/ports/types"
 )
 
-func execUpdate(engine *graph.GraphEngine, input string, out io.Writer) error {
+func execUpdate(tx storage.Tx, input string, touch touchFunc, out io.Writer) error {
 	input = strings.TrimSpace(input)
 	if !strings.HasPrefix(input, "NODE ") && !strings.HasPrefix(input, "EDGE ") {
-		return fmt.Errorf("usage: UPDATE NODE <id> key=value... | UPDATE EDGE A --rel--> B key=value...")
+		return fmt.Errorf("usage: UPDATE NODE <id> [:Label | +:Label | -:Label] [key=value | -key ...] | UPDATE EDGE <id>|A --rel--> B [key=value | -key ...]")
 	}
 
 	if strings.HasPrefix(input, "NODE ") {
-		return execUpdateNode(engine, input[5:], out)
+		return execUpdateNode(tx, input[5:], touch, out)
 	} else if strings.HasPrefix(input, "EDGE ") {
-		return execUpdateEdge(engine, input[5:], out)
+		return execUpdateEdge(tx, input[5:], touch, out)
 	}
 
 	return fmt.Errorf("invalid UPDATE syntax")
 }
 
-func execUpdateNode(engine *graph.GraphEngine, input string, out io.Writer) error {
-	fields := strings.Fields(input)
-	if len(fields) < 1 {
-		return fmt.Errorf("usage: UPDATE NODE <id> [key=value ...]")
+func execUpdateNode(tx storage.Tx, input string, touch touchFunc, out io.Writer) error {
+	id, rest, _ := strings.Cut(strings.TrimSpace(input), " ")
+	if id == "" {
+		return fmt.Errorf("usage: UPDATE NODE <id> [:Label | +:Label | -:Label] [key=value | -key ...]")
 	}
 
-	id := fields[0]
-	propsInput := ""
-	if len(fields) > 1 {
-		propsInput = strings.Join(fields[1:], " ")
+	set, unset, labels, err := parsePatch(rest)
+	if err != nil {
+		return err
+	}
+	if len(set) == 0 && len(unset) == 0 && len(labels) == 0 {
+		return fmt.Errorf("nothing to update")
 	}
 
-	node, ok := engine.GetNode(id)
-	if !ok {
+	if _, ok := tx.GetNode(id); !ok {
 		return fmt.Errorf("node %s not found", id)
 	}
+	touch(id)
 
-	// Update properties
-	newProps := make(map[string]any)
-	for k, v := range node.Props {
-		newProps[k] = v
+	if len(set) > 0 || len(unset) > 0 {
+		if err := tx.PatchNode(id, set, unset); err != nil {
+			return err
+		}
 	}
-
-	updates := parseProps(propsInput)
-	for k, v := range updates {
-		newProps[k] = v
+	for _, l := range labels {
+		switch l.op {
+		case '+':
+			err = tx.AddLabel(id, l.label)
+		case '-':
+			err = tx.RemoveLabel(id, l.label)
+		default:
+			err = tx.SetLabel(id, l.label)
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	// In real system, you might have UpdateNode method
-	// For now: rebuild storage layer doesn't support mutation → we'll simulate via re-add?
-	// But better: expose mutable access safely
+	fmt.Fprintf(out, "-- Updated node %s\n", id)
+	return nil
+}
 
-	// Since our storage is private, let's assume we can update
-	storage, ok := engine.Storage().(*inmem.Storage)
-	if !ok {
-		return fmt.Errorf("storage not mutable")
+func execUpdateEdge(tx storage.Tx, input string, touch touchFunc, out io.Writer) error {
+	edge, rest, err := edgeRef(tx, input)
+	if err != nil {
+		return err
 	}
 
-	storage.UpdateNode(id, newProps)
-	fmt.Fprintf(out, "-- Updated node %s\n", id)
+	set, unset, labels, err := parsePatch(rest)
+	if err != nil {
+		return err
+	}
+	if len(labels) > 0 {
+		return fmt.Errorf("edges have no labels")
+	}
+	if len(set) == 0 && len(unset) == 0 {
+		return fmt.Errorf("no properties to update")
+	}
+
+	touch(edge.From, edge.To)
+	if err := tx.PatchEdge(edge.ID, set, unset); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "-- Updated edge %s --%s--> %s (%s)\n", edge.From, edge.Kind, edge.To, edge.ID)
 	return nil
 }
 
-func execUpdateEdge(engine *graph.GraphEngine, input string, out io.Writer) error {
-	// Format: fromID --rel--> toID [props]
-	arrowStart := strings.Index(input, "--")
+// labelOp is a label change in UPDATE NODE: ':' replaces the labels,
+// '+' adds one and '-' removes one
+type labelOp struct {
+	op    byte
+	label string
+}
+
+// parsePatch splits UPDATE arguments into props to set (key=value), keys
+// to remove (-key) and label changes (:Label, +:Label, -:Label)
+func parsePatch(input string) (set map[string]any, unset []string, labels []labelOp, err error) {
+	var assignments []string
+	for _, f := range strings.Fields(input) {
+		switch {
+		case strings.Contains(f, "="):
+			assignments = append(assignments, f)
+		case len(f) > 2 && (f[0] == '+' || f[0] == '-') && f[1] == ':':
+			labels = append(labels, labelOp{op: f[0], label: f[2:]})
+		case len(f) > 1 && f[0] == ':':
+			labels = append(labels, labelOp{op: ':', label: f[1:]})
+		case len(f) > 1 && f[0] == '-':
+			unset = append(unset, f[1:])
+		default:
+			return nil, nil, nil, fmt.Errorf("invalid update %q (want key=value, -key, :Label, +:Label or -:Label)", f)
+		}
+	}
+	return parseProps(strings.Join(assignments, " ")), unset, labels, nil
+}
+
+// edgeRef resolves the edge at the start of input, given by ID or as
+// A --rel--> B, and returns the rest of the input
+func edgeRef(r storage.Reader, input string) (*types.Edge, string, error) {
+	input = strings.TrimSpace(input)
+
 	arrowEnd := strings.LastIndex(input, "-->")
-	if arrowStart == -1 || arrowEnd == -1 || arrowEnd <= arrowStart {
-		return fmt.Errorf("invalid edge format in UPDATE EDGE")
+	if arrowEnd == -1 {
+		id, rest, _ := strings.Cut(input, " ")
+		edge, ok := r.GetEdge(id)
+		if !ok {
+			return nil, "", fmt.Errorf("edge %s not found", id)
+		}
+		return edge, strings.TrimSpace(rest), nil
 	}
 
+	arrowStart := strings.Index(input, "--")
+	if arrowStart == arrowEnd {
+		return nil, "", fmt.Errorf("invalid edge format")
+	}
 	fromID := strings.TrimSpace(input[:arrowStart])
-	middle := input[arrowStart+2 : arrowEnd]
-	toID := strings.TrimSpace(input[arrowEnd+3:])
-
-	rel := strings.TrimSpace(middle)
-	rest := ""
-
-	// If there are props after the arrow
-	if space := strings.Index(rest, " "); space != -1 {
-		// Extract props
-		propsStr := strings.TrimSpace(rest[space+1:])
-		if propsStr != "" {
-			props := parseProps(propsStr)
-
-			edgeID := fmt.Sprintf("%s->%s@%s", fromID, toID, rel)
-			s, ok := engine.Storage().(*inmem.Storage)
-			if !ok {
-				return fmt.Errorf("storage not mutable")
-			}
-
-			edge, exists := engine.GetEdge(edgeID)
-			if !exists {
-				return fmt.Errorf("edge not found")
-			}
-
-			// Update props
-			for k, v := range props {
-				edge.Props[k] = v
-			}
-
-			s.UpdateEdge(edgeID, edge.Props)
-
-			fmt.Fprintf(out, "-- Updated edge %s --%s--> %s\n", fromID, rel, toID)
-			return nil
+	rel := strings.TrimSpace(input[arrowStart+2 : arrowEnd])
+	toID, rest, _ := strings.Cut(strings.TrimSpace(input[arrowEnd+3:]), " ")
+	if fromID == "" || toID == "" || rel == "" {
+		return nil, "", fmt.Errorf("invalid edge spec")
+	}
+
+	var matches []*types.Edge
+	for _, e := range r.GetEdgesFrom(fromID) {
+		if e.To == toID && e.Kind == rel {
+			matches = append(matches, e)
 		}
 	}
+	switch len(matches) {
+	case 0:
+		return nil, "", fmt.Errorf("edge %s --%s--> %s not found", fromID, rel, toID)
+	case 1:
+		return matches[0], strings.TrimSpace(rest), nil
+	}
 
-	return fmt.Errorf("no properties to update")
+	ids := make([]string, len(matches))
+	for i, e := range matches {
+		ids[i] = e.ID
+	}
+	sort.Strings(ids)
+	return nil, "", fmt.Errorf("%w (%s); give the edge ID instead", storage.ErrAmbiguousEdge, strings.Join(ids, ", "))
 }
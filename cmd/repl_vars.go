@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aprksy/knitknot/pkg/dsl"
+	"github.com/aprksy/knitknot/pkg/ports/query"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// lastResultVar holds the node IDs of the last query or created node
+const lastResultVar = "_"
+
+var (
+	letRegex = regexp.MustCompile(`(?is)^let\s+(\w+)\s*=\s*(.+)$`)
+	varRegex = regexp.MustCompile(`\$(\w+)`)
+)
+
+// execLet binds the node IDs of a query result (or another variable) to
+// a session variable. Without arguments it lists the variables.
+//
+//	LET alice = Find('User').Where('n.name', '=', 'Alice')
+//	LET bob = $_
+func (s *replSession) execLet(ctx context.Context, input string, out io.Writer) error {
+	input = strings.TrimSpace(input)
+	if strings.EqualFold(input, "let") {
+		return s.execListVars(out)
+	}
+
+	matches := letRegex.FindStringSubmatch(input)
+	if len(matches) != 3 {
+		return fmt.Errorf("invalid syntax. Use: LET <name> = <query>")
+	}
+	name, rhs := matches[1], strings.TrimSpace(matches[2])
+	if name == lastResultVar {
+		return fmt.Errorf("$%s is set automatically", lastResultVar)
+	}
+
+	if ref := varRegex.FindStringSubmatch(rhs); ref != nil && ref[0] == rhs {
+		ids, ok := s.vars[ref[1]]
+		if !ok {
+			return fmt.Errorf("undefined variable $%s", ref[1])
+		}
+		s.vars[name] = ids
+	} else {
+		result, err := s.runQuery(ctx, rhs)
+		if err != nil {
+			return err
+		}
+		s.vars[name] = resultIDs(result)
+	}
+
+	fmt.Fprintf(out, "-- $%s = %s\n", name, describeIDs(s.vars[name]))
+	return nil
+}
+
+func (s *replSession) execListVars(out io.Writer) error {
+	if len(s.vars) == 0 {
+		fmt.Fprintln(out, "(no variables)")
+		return nil
+	}
+
+	names := make([]string, 0, len(s.vars))
+	for name := range s.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "$%s = %s\n", name, describeIDs(s.vars[name]))
+	}
+	return nil
+}
+
+// lookupNode resolves a variable that must hold exactly one node
+func (s *replSession) lookupNode(name string) (string, error) {
+	ids, ok := s.vars[name]
+	if !ok {
+		return "", fmt.Errorf("undefined variable $%s", name)
+	}
+	if len(ids) != 1 {
+		return "", fmt.Errorf("$%s holds %d nodes, expected 1", name, len(ids))
+	}
+	return ids[0], nil
+}
+
+// expandVars replaces $name in a REPL command with the node ID it holds
+func (s *replSession) expandVars(input string) (string, error) {
+	var firstErr error
+	expanded := varRegex.ReplaceAllStringFunc(input, func(ref string) string {
+		id, err := s.lookupNode(ref[1:])
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return ref
+		}
+		return id
+	})
+	return expanded, firstErr
+}
+
+// resolveVars replaces $name arguments of a parsed query with the node ID
+// the variable holds, so they can be compared against bare variables:
+//
+//	Find('User').Where('n', '=', $alice)
+func (s *replSession) resolveVars(ast *dsl.Query) error {
+	for _, m := range ast.Methods {
+		for i, arg := range m.Arguments {
+			resolved, err := s.resolveVar(arg)
+			if err != nil {
+				return err
+			}
+			m.Arguments[i] = resolved
+		}
+	}
+	return nil
+}
+
+// resolveVar resolves a $name argument, or the $name values of a map
+func (s *replSession) resolveVar(arg dsl.Expression) (dsl.Expression, error) {
+	switch arg := arg.(type) {
+	case *dsl.VarRef:
+		id, err := s.lookupNode(arg.Name)
+		if err != nil {
+			return nil, err
+		}
+		return &dsl.StringLiteral{Value: id}, nil
+	case *dsl.MapLiteral:
+		for _, e := range arg.Entries {
+			value, err := s.resolveVar(e.Value)
+			if err != nil {
+				return nil, err
+			}
+			e.Value = value
+		}
+	}
+	return arg, nil
+}
+
+// setLast records the node IDs of the last result as $_
+func (s *replSession) setLast(ids []string) {
+	s.vars[lastResultVar] = ids
+}
+
+// resultIDs returns the distinct IDs of the main ("n") node of each row
+func resultIDs(result query.ResultSet) []string {
+	ids := newIDCollector()
+	for _, row := range result.Items() {
+		ids.add(row)
+	}
+	return ids.ids
+}
+
+// idCollector gathers the distinct IDs of the main ("n") node of rows
+// as they stream past
+type idCollector struct {
+	seen map[string]bool
+	ids  []string
+}
+
+func newIDCollector() *idCollector {
+	return &idCollector{seen: map[string]bool{}, ids: []string{}}
+}
+
+func (c *idCollector) add(row map[string]*types.Node) {
+	node, ok := row["n"]
+	if !ok || c.seen[node.ID] {
+		return
+	}
+	c.seen[node.ID] = true
+	c.ids = append(c.ids, node.ID)
+}
+
+func describeIDs(ids []string) string {
+	switch len(ids) {
+	case 0:
+		return "(no nodes)"
+	case 1:
+		return ids[0]
+	}
+
+	shown := ids
+	if len(shown) > 5 {
+		shown = shown[:5]
+	}
+	desc := fmt.Sprintf("%d nodes [%s", len(ids), strings.Join(shown, ", "))
+	if len(ids) > len(shown) {
+		desc += ", ..."
+	}
+	return desc + "]"
+}
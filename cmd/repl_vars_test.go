@@ -0,0 +1,88 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/aprksy/knitknot/cmd"
+	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/storage/inmem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REPL variables", func() {
+	var (
+		ctx     context.Context
+		engine  *graph.GraphEngine
+		session *cmd.Session
+		out     bytes.Buffer
+	)
+
+	run := func(line string) string {
+		out.Reset()
+		ExpectWithOffset(1, session.Run(ctx, line, &out)).To(Succeed())
+		return out.String()
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		engine = graph.NewGraphEngine(inmem.New())
+		Expect(engine.AddNodeWithID("u1", "User", map[string]any{"name": "Alice"})).To(Succeed())
+		Expect(engine.AddNodeWithID("u2", "User", map[string]any{"name": "Bob"})).To(Succeed())
+		session = cmd.NewSession(engine)
+		out.Reset()
+	})
+
+	It("should bind a query's nodes with LET and list them", func() {
+		Expect(run("LET alice = Find('User').Where('n.name', '=', 'Alice')")).To(Equal("-- $alice = u1\n"))
+		// Nodes come out in no particular order
+		users := `2 nodes \[(u1, u2|u2, u1)\]`
+		Expect(run("LET users = Find('User')")).To(MatchRegexp(`^-- \$users = ` + users + "\n$"))
+		Expect(run("LET someone = $alice")).To(Equal("-- $someone = u1\n"))
+
+		Expect(run("LET")).To(MatchRegexp(`^\$alice = u1\n\$someone = u1\n\$users = ` + users + "\n$"))
+	})
+
+	It("should keep the last result in $_", func() {
+		run("Find('User').Where('n.name', '=', 'Bob')")
+		Expect(run("LET bob = $_")).To(Equal("-- $bob = u2\n"))
+	})
+
+	DescribeTable("should put a variable's node ID in a command",
+		func(command string, check func()) {
+			run("LET alice = Find('User').Where('n.name', '=', 'Alice')")
+			run("LET bob = Find('User').Where('n.name', '=', 'Bob')")
+			run(command)
+			check()
+		},
+		Entry("CONNECT", "CONNECT $alice --KNOWS--> $bob", func() {
+			Expect(engine.Storage().GetEdgesFrom("u1")).To(ConsistOf(HaveField("To", "u2")))
+		}),
+		Entry("UPDATE NODE", "UPDATE NODE $alice age=30", func() {
+			n, _ := engine.GetNode("u1")
+			Expect(n.Props).To(HaveKeyWithValue("age", 30))
+		}),
+		Entry("DELETE NODE", "DELETE NODE $bob", func() {
+			_, ok := engine.GetNode("u2")
+			Expect(ok).To(BeFalse())
+		}),
+	)
+
+	It("should compare a query's variables against one", func() {
+		run("LET alice = Find('User').Where('n.name', '=', 'Alice')")
+		Expect(run("Find('User').Where('n', '=', $alice)")).To(ContainSubstring("u1 (User) | Alice"))
+	})
+
+	DescribeTable("should reject",
+		func(line, msg string) {
+			run("LET users = Find('User')")
+			Expect(session.Run(ctx, line, &out)).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("an undefined variable", "UPDATE NODE $nobody age=1", "undefined variable $nobody"),
+		Entry("several nodes where one is needed", "DELETE NODE $users", "$users holds 2 nodes, expected 1"),
+		Entry("an undefined variable in a query", "Find('User').Where('n', '=', $nobody)", "undefined variable $nobody"),
+		Entry("binding $_", "LET _ = Find('User')", "$_ is set automatically"),
+		Entry("a LET without a query", "LET alice", "invalid syntax"),
+	)
+})
@@ -3,6 +3,10 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
+
+	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/idgen"
 
 	"github.com/spf13/cobra"
 )
@@ -10,6 +14,8 @@ import (
 var globalFlags struct {
 	subgraph string
 	file     string
+	idScheme string
+	verbMode string
 }
 
 var RootCmd = &cobra.Command{
@@ -40,6 +46,18 @@ func init() {
 		"",
 		"Graph data file to load and save (e.g., data.gob)",
 	)
+	RootCmd.PersistentFlags().StringVar(
+		&globalFlags.idScheme,
+		"id-scheme",
+		idgen.Default,
+		"Node ID scheme for new graphs: "+strings.Join(idgen.Schemes(), ", "),
+	)
+	RootCmd.PersistentFlags().StringVar(
+		&globalFlags.verbMode,
+		"verb-mode",
+		string(graph.VerbsOff),
+		"How to treat edges of unregistered verbs or the wrong target label: off, lenient (warn) or strict (reject)",
+	)
 }
 
 func initConfig() {
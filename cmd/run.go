@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aprksy/knitknot/pkg/script"
+	"github.com/spf13/cobra"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run <script>",
+	Short: "Execute a KnitKnot script",
+	Long: `Execute a file of REPL commands and queries.
+
+Statements are separated by ';' or newlines, and lines starting with '--'
+are comments. The graph given with -f is saved after a successful run.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runScriptCmd,
+}
+
+var runFlags struct {
+	continueOnError bool
+	noSave          bool
+}
+
+func init() {
+	runCmd.Flags().StringVar(&globalFlags.subgraph, "subgraph", "", "Run script within a subgraph context")
+	runCmd.Flags().BoolVar(&runFlags.continueOnError, "continue-on-error", false, "Keep executing after a statement fails")
+	runCmd.Flags().BoolVar(&runFlags.noSave, "no-save", false, "Do not save the graph file after the run")
+	RootCmd.AddCommand(runCmd)
+}
+
+func runScriptCmd(cmd *cobra.Command, args []string) error {
+	engine, err := LoadGraph(globalFlags.file)
+	if err != nil {
+		return err
+	}
+
+	engine = withSubgraphFlag(cmd, engine)
+
+	session := newReplSession(engine)
+	summary, err := execScriptFile(context.Background(), session, args[0], runFlags.continueOnError, cmd.OutOrStdout())
+	if err != nil {
+		return err
+	}
+
+	// A transaction the script left open is not saved
+	if session.inTx() {
+		if err := session.execRollback(cmd.OutOrStdout()); err != nil {
+			return err
+		}
+	}
+
+	if summary.Failed > 0 && !runFlags.continueOnError {
+		return fmt.Errorf("script aborted at line %d", summary.FailedAt)
+	}
+
+	if globalFlags.file != "" && !runFlags.noSave {
+		return SaveGraph(engine, globalFlags.file)
+	}
+	return nil
+}
+
+// scriptSummary counts what happened while running a script
+type scriptSummary struct {
+	Total    int
+	OK       int
+	Failed   int
+	Skipped  int
+	FailedAt int // line of the first failing statement
+}
+
+type sourceStackKey struct{}
+
+// execScriptFile parses and runs a script file, printing the outcome of
+// each statement followed by a summary.
+func execScriptFile(ctx context.Context, session *replSession, filename string, keepGoing bool, out io.Writer) (*scriptSummary, error) {
+	// Guard against scripts that SOURCE themselves, directly or not
+	stack, _ := ctx.Value(sourceStackKey{}).([]string)
+	for _, f := range stack {
+		if f == filename {
+			return nil, fmt.Errorf("recursive SOURCE of %s", filename)
+		}
+	}
+	ctx = context.WithValue(ctx, sourceStackKey{}, append(stack[:len(stack):len(stack)], filename))
+
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	stmts, err := script.Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	summary := &scriptSummary{Total: len(stmts)}
+	for i, stmt := range stmts {
+		fmt.Fprintf(out, "[%s:%d] %s\n", filename, stmt.Line, firstLine(stmt.Text))
+		err := session.handleLine(ctx, stmt.Text, &indentWriter{out: out, prefix: "    "})
+
+		if errors.Is(err, errQuit) {
+			summary.OK++
+			summary.Skipped = len(stmts) - i - 1
+			break
+		}
+
+		if err != nil {
+			fmt.Fprintf(out, "    Error: %v\n", err)
+			summary.Failed++
+			if summary.FailedAt == 0 {
+				summary.FailedAt = stmt.Line
+			}
+			if !keepGoing {
+				summary.Skipped = len(stmts) - i - 1
+				break
+			}
+			continue
+		}
+		summary.OK++
+	}
+
+	fmt.Fprintf(out, "-- %s: %d statement(s), %d ok, %d failed, %d skipped\n",
+		filename, summary.Total, summary.OK, summary.Failed, summary.Skipped)
+	return summary, nil
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i != -1 {
+		return s[:i] + " ..."
+	}
+	return s
+}
+
+// indentWriter prefixes every line written through it
+type indentWriter struct {
+	out    io.Writer
+	prefix string
+	mid    bool // the last write did not end a line
+}
+
+func (w *indentWriter) Write(p []byte) (int, error) {
+	var b bytes.Buffer
+	for _, l := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(l) == 0 {
+			continue
+		}
+		if !w.mid {
+			b.WriteString(w.prefix)
+		}
+		b.Write(l)
+		w.mid = l[len(l)-1] != '\n'
+	}
+	if _, err := w.out.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -55,7 +55,7 @@ func seedSampleData(engine *graph.GraphEngine) {
 	payment_method_5, _ := engine.AddNode("payment_method", map[string]any{"name": "PayPal"})
 	payment_method_6, _ := engine.AddNode("payment_method", map[string]any{"name": "PooplePay"})
 
-	err := engine.AddEdge(customer_1, channel_1, "make_purchase_in", map[string]any{"trx_count": 1, "trx_amount": 1499})
+	_, err := engine.AddEdge(customer_1, channel_1, "make_purchase_in", map[string]any{"trx_count": 1, "trx_amount": 1499})
 
 	if err != nil {
 		fmt.Println(err.Error())
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Check a graph file's edges against its verbs",
+	Long: `Scan a saved graph for edges that break their verb definitions.
+
+Reports edges whose kind is not a registered verb, that start or end at a
+node with the wrong label, that carry properties the verb does not allow,
+or that exceed its cardinality. The file defaults to the -f flag. The
+command fails if any edge is reported.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runValidate,
+}
+
+func init() {
+	RootCmd.AddCommand(validateCmd)
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+	filename := globalFlags.file
+	if len(args) == 1 {
+		filename = args[0]
+	}
+	if filename == "" {
+		return fmt.Errorf("no graph file given")
+	}
+	if _, err := os.Stat(filename); err != nil {
+		return err
+	}
+
+	engine, err := LoadGraph(filename)
+	if err != nil {
+		return err
+	}
+
+	violations := engine.ValidateEdges()
+	for _, v := range violations {
+		fmt.Fprintln(cmd.OutOrStdout(), v)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%d invalid edge(s)", len(violations))
+	}
+	fmt.Fprintln(cmd.ErrOrStderr(), "-- All edges match their verbs")
+	return nil
+}
@@ -1,17 +1,5 @@
 package util
 
-import (
-	"math/rand"
-	"time"
-)
-
-func init() {
-	seed := int64(time.Now().UnixNano())
-	source := rand.NewSource(seed)
-
-	rand.New(source)
-}
-
 // Capitalize first letter (for labels)
 func Capitalize(s string) string {
 	if s == "" {
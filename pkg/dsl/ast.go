@@ -1,5 +1,7 @@
 package dsl
 
+import "strconv"
+
 // Node is a node in the AST
 type Node interface {
 	TokenLiteral() string
@@ -54,4 +56,27 @@ type NumberLiteral struct {
 }
 
 func (n *NumberLiteral) ExpressionNode()      {}
-func (n *NumberLiteral) TokenLiteral() string { return string(rune(n.Value)) } // not ideal, just for now
+func (n *NumberLiteral) TokenLiteral() string { return strconv.Itoa(n.Value) }
+
+// VarRef: $alice, a session variable the caller substitutes before the
+// query is built
+type VarRef struct {
+	Name string
+}
+
+func (v *VarRef) ExpressionNode()      {}
+func (v *VarRef) TokenLiteral() string { return "$" + v.Name }
+
+// MapLiteral: {name: 'Go', level: 3}, entries in source order
+type MapLiteral struct {
+	Entries []*MapEntry
+}
+
+// MapEntry is one key: value pair of a MapLiteral
+type MapEntry struct {
+	Key   string
+	Value Expression
+}
+
+func (m *MapLiteral) ExpressionNode()      {}
+func (m *MapLiteral) TokenLiteral() string { return "{" }
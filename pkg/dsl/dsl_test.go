@@ -75,6 +75,46 @@ var _ = Describe("DSL Parser", func() {
 			Expect(numArg.Value).To(Equal(30))
 		})
 
+		It("should parse variable references", func() {
+			ast, err := parse("Where('n', '=', $alice)")
+			Expect(err).NotTo(HaveOccurred())
+
+			ref, ok := ast.Methods[0].Arguments[2].(*dsl.VarRef)
+			Expect(ok).To(BeTrue())
+			Expect(ref.Name).To(Equal("alice"))
+			Expect(ref.TokenLiteral()).To(Equal("$alice"))
+		})
+
+		It("should reject a bare $", func() {
+			_, err := parse("Where('n', '=', $)")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should parse a property map", func() {
+			ast, err := parse("Has('has_skill', {name: 'Go', 'level': 3, by: $alice})")
+			Expect(err).NotTo(HaveOccurred())
+			m, ok := ast.Methods[0].Arguments[1].(*dsl.MapLiteral)
+			Expect(ok).To(BeTrue())
+			Expect(m.Entries).To(Equal([]*dsl.MapEntry{
+				{Key: "name", Value: &dsl.StringLiteral{Value: "Go"}},
+				{Key: "level", Value: &dsl.NumberLiteral{Value: 3}},
+				{Key: "by", Value: &dsl.VarRef{Name: "alice"}},
+			}))
+		})
+
+		It("should reject malformed maps", func() {
+			for _, input := range []string{
+				"Has('r', {name 'Go'})",
+				"Has('r', {3: 'Go'})",
+				"Has('r', {name: 'Go',})",
+				"Has('r', {name: {a: 1}})",
+				"Has('r', {name: 'Go')",
+			} {
+				_, err := parse(input)
+				Expect(err).To(HaveOccurred(), input)
+			}
+		})
+
 		It("should parse Limit(5)", func() {
 			ast, err := parse("Limit(5)")
 			Expect(err).NotTo(HaveOccurred())
@@ -175,7 +215,7 @@ var _ = Describe("DSL Parser", func() {
 			// Add sample data
 			aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice", "age": 40})
 			goID, _ := engine.AddNode("Skill", map[string]any{"name": "Go"})
-			_ = engine.AddEdge(aliceID, goID, "has_skill", nil)
+			_, _ = engine.AddEdge(aliceID, goID, "has_skill", nil)
 
 			// Parse and execute
 			ast, err := parse("Find('User').Has('has_skill', 'Go').Where('n.age', '>', 30)")
@@ -0,0 +1,108 @@
+package dsl
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MaxLineWidth is the width above which Format breaks a chain into one
+// method per line
+const MaxLineWidth = 80
+
+// Format pretty-prints a query in canonical form: single-quoted strings,
+// ", " between arguments and no other whitespace. Chains longer than
+// MaxLineWidth are written one method per line:
+//
+//	Find('User')
+//	  .Has('has_skill', 'Go')
+//	  .Where('n.age', '>', 30)
+func Format(q *Query) string {
+	if q == nil || len(q.Methods) == 0 {
+		return ""
+	}
+
+	oneLine := q.String()
+	if len(oneLine) <= MaxLineWidth || len(q.Methods) == 1 {
+		return oneLine
+	}
+	return q.join("\n  .")
+}
+
+// String renders the query on a single line
+func (q *Query) String() string { return q.join(".") }
+
+// join renders the methods of the query separated by sep
+func (q *Query) join(sep string) string {
+	parts := make([]string, len(q.Methods))
+	for i, m := range q.Methods {
+		parts[i] = m.String()
+	}
+	return strings.Join(parts, sep)
+}
+
+// String renders the call as Name(arg, arg, ...)
+func (m *MethodCall) String() string {
+	args := make([]string, len(m.Arguments))
+	for i, a := range m.Arguments {
+		args[i] = exprString(a)
+	}
+	return m.Name.Value + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (i *Identifier) String() string { return i.Value }
+
+// String renders the literal quoted, escaping ' and \
+func (s *StringLiteral) String() string { return Quote(s.Value) }
+
+func (n *NumberLiteral) String() string { return strconv.Itoa(n.Value) }
+
+func (v *VarRef) String() string { return "$" + v.Name }
+
+// String renders the map as {key: value, ...}, quoting keys that are not
+// identifiers
+func (m *MapLiteral) String() string {
+	entries := make([]string, len(m.Entries))
+	for i, e := range m.Entries {
+		key := e.Key
+		if !isIdentifier(key) {
+			key = Quote(key)
+		}
+		entries[i] = key + ": " + exprString(e.Value)
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+func isIdentifier(s string) bool {
+	if s == "" || !isLetter(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isLetter(s[i]) && !isDigit(s[i]) && s[i] != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Quote wraps s in single quotes, escaping characters the lexer treats
+// specially
+func Quote(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s) + 2)
+	sb.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\'' || s[i] == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
+
+func exprString(e Expression) string {
+	if s, ok := e.(interface{ String() string }); ok {
+		return s.String()
+	}
+	return e.TokenLiteral()
+}
@@ -0,0 +1,89 @@
+package dsl_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aprksy/knitknot/pkg/dsl"
+)
+
+var _ = Describe("DSL Formatter", func() {
+	mustParse := func(input string) *dsl.Query {
+		ast, err := dsl.NewParser(input).Parse()
+		Expect(err).NotTo(HaveOccurred())
+		return ast
+	}
+
+	Describe("Format", func() {
+		It("should normalize whitespace", func() {
+			ast := mustParse("  Find ( 'User' ) .Has('has_skill','Go')\n.Limit( 5 )")
+			Expect(dsl.Format(ast)).To(Equal("Find('User').Has('has_skill', 'Go').Limit(5)"))
+		})
+
+		It("should put one method per line for long chains", func() {
+			ast := mustParse("Find('customer').Has('make_purchase_in', 'Marketplace').Where('n.age', '>', 25).Limit(5)")
+			Expect(dsl.Format(ast)).To(Equal(strings.Join([]string{
+				"Find('customer')",
+				"  .Has('make_purchase_in', 'Marketplace')",
+				"  .Where('n.age', '>', 25)",
+				"  .Limit(5)",
+			}, "\n")))
+		})
+
+		It("should render the same methods as String", func() {
+			short := mustParse("Find('User').Has('has_skill', 'Go')")
+			Expect(dsl.Format(short)).To(Equal(short.String()))
+
+			long := mustParse("Find('customer').Has('make_purchase_in', 'Marketplace').Where('n.age', '>', 25).Limit(5)")
+			Expect(strings.ReplaceAll(dsl.Format(long), "\n  .", ".")).To(Equal(long.String()))
+		})
+
+		It("should escape quotes and backslashes", func() {
+			ast := mustParse(`Find('User').Where('n.name', '=', 'O\'Brien \\ Co')`)
+			value := ast.Methods[1].Arguments[2].(*dsl.StringLiteral)
+			Expect(value.Value).To(Equal(`O'Brien \ Co`))
+			Expect(dsl.Format(ast)).To(ContainSubstring(`'O\'Brien \\ Co'`))
+		})
+
+		It("should format maps and quote keys that are not identifiers", func() {
+			ast := mustParse("Find('User').Has('has_skill',{ 'name':'Go','@id' :'n1' })")
+			Expect(dsl.Format(ast)).To(Equal("Find('User').Has('has_skill', {name: 'Go', '@id': 'n1'})"))
+		})
+
+		It("should format empty argument lists", func() {
+			ast := mustParse("Find('User').Exec()")
+			Expect(dsl.Format(ast)).To(Equal("Find('User').Exec()"))
+		})
+
+		It("should return empty string for nil query", func() {
+			Expect(dsl.Format(nil)).To(BeEmpty())
+		})
+	})
+
+	Describe("Round trip", func() {
+		inputs := []string{
+			"Find('User')",
+			"Find('User').Has('has_skill', 'Go')",
+			"Find('User').Where('n.age', '>', 30).Limit(10)",
+			"Find('customer').Has('make_purchase_in', 'Marketplace').Where('n.age', '>', 25).Where('n.gender', '=', 'female').WhereEdge('trx_amount', '>', 100).Limit(5)",
+			`Find('User').Where('n.name', '=', 'it\'s')`,
+			"Find('X').In('org')",
+			"Find('User').Has('has_skill', 'level', '>=', 3)",
+			"Find('User').Has('has_skill', {name: 'Go', level: 3, '@id': $go})",
+			"Find('User').Has('has_skill', {})",
+		}
+
+		for _, input := range inputs {
+			It("should satisfy Parse(Format(ast)) == ast for "+input, func() {
+				ast := mustParse(input)
+				formatted := dsl.Format(ast)
+				Expect(mustParse(formatted)).To(Equal(ast))
+
+				// Formatting is idempotent
+				Expect(dsl.Format(mustParse(formatted))).To(Equal(formatted))
+			})
+		}
+	})
+})
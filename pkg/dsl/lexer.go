@@ -1,5 +1,7 @@
 package dsl
 
+import "strings"
+
 type Lexer struct {
 	input        string
 	position     int  // current position in input (points to char)
@@ -40,20 +42,31 @@ func (l *Lexer) NextToken() Token {
 		tok = Token{Type: RParen, Literal: ")", PosX: position}
 	case ',':
 		tok = Token{Type: Comma, Literal: ",", PosX: position}
+	case '{':
+		tok = Token{Type: LBrace, Literal: "{", PosX: position}
+	case '}':
+		tok = Token{Type: RBrace, Literal: "}", PosX: position}
+	case ':':
+		tok = Token{Type: Colon, Literal: ":", PosX: position}
 	case '\'':
 		str := l.readString()
-		tok = Token{Type: String, Literal: str, PosX: position}
+		tok = Token{Type: String, Literal: str, PosX: position, End: l.position}
 		return tok // ← Return early! Already advanced in readString
+	case '$':
+		l.readChar() // consume $
+		name := l.readIdentifier()
+		tok = Token{Type: Var, Literal: name, PosX: position, End: l.position}
+		return tok
 	case 0:
-		tok = Token{Type: EOF, Literal: ""}
+		tok = Token{Type: EOF, Literal: "", PosX: position, End: position}
 	default:
 		if isLetter(l.ch) {
 			id := l.readIdentifier()
-			tok = Token{Type: Ident, Literal: id, PosX: position}
+			tok = Token{Type: Ident, Literal: id, PosX: position, End: l.position}
 			return tok // ← Return early! Already advanced
 		} else if isDigit(l.ch) {
 			num := l.readNumber()
-			tok = Token{Type: Number, Literal: num, PosX: position}
+			tok = Token{Type: Number, Literal: num, PosX: position, End: l.position}
 			return tok // ← Return early!
 		} else {
 			tok = Token{Type: Illegal, Literal: string(l.ch), PosX: position}
@@ -61,6 +74,9 @@ func (l *Lexer) NextToken() Token {
 	}
 
 	// Only advance if we didn't return early
+	if tok.Type != EOF {
+		tok.End = position + 1
+	}
 	l.readChar()
 	return tok
 }
@@ -80,23 +96,31 @@ func (l *Lexer) readIdentifier() string {
 }
 
 func (l *Lexer) readString() string {
-	pos := l.position + 1 // start after opening '
-	l.readChar()          // consume opening '
+	l.readChar() // consume opening '
 
+	// Backslash escapes the next char, so \' and \\ can appear in strings
+	var sb strings.Builder
 	for l.ch != '\'' && l.ch != 0 {
+		if l.ch == '\\' && l.peekChar() != 0 {
+			l.readChar()
+		}
+		sb.WriteByte(l.ch)
 		l.readChar()
 	}
 
-	// At this point, l.ch is '\'' or 0
-	// Extract string content
-	s := l.input[pos:l.position]
-
 	// If we stopped at ', consume it
 	if l.ch == '\'' {
 		l.readChar() // now points after closing '
 	}
 
-	return s
+	return sb.String()
+}
+
+func (l *Lexer) peekChar() byte {
+	if l.readPosition >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPosition]
 }
 
 func (l *Lexer) readNumber() string {
@@ -0,0 +1,53 @@
+package dsl
+
+// MethodSpec describes a DSL method for help, completion and hover
+type MethodSpec struct {
+	Name      string
+	Signature string
+	Doc       string
+}
+
+// Methods lists the methods understood by the query builder, in the
+// order they usually appear in a chain
+var Methods = []MethodSpec{
+	{
+		Name:      "Find",
+		Signature: "Find(label)",
+		Doc:       "Starts a query with nodes of the given label, bound to `n`.",
+	},
+	{
+		Name:      "Has",
+		Signature: "Has(rel, value) | Has(rel, prop, op, value) | Has(rel, {prop: value, ...})",
+		Doc:       "Follows `rel` edges to nodes whose match property (from the verb definition) equals `value`, whose `prop` compares to `value` with `op`, or whose properties equal all those given. Properties the verb's PROPS lists are compared on the edge. The property `@id` is the node ID.",
+	},
+	{
+		Name:      "Where",
+		Signature: "Where(field, op, value)",
+		Doc:       "Filters on a node property. `field` is `var.prop`, e.g. `n.age`.",
+	},
+	{
+		Name:      "WhereEdge",
+		Signature: "WhereEdge(field, op, value)",
+		Doc:       "Filters the most recent `Has` edge on one of its properties.",
+	},
+	{
+		Name:      "In",
+		Signature: "In(subgraph)",
+		Doc:       "Restricts the query to the nodes of a subgraph.",
+	},
+	{
+		Name:      "Limit",
+		Signature: "Limit(n)",
+		Doc:       "Limits the number of result rows.",
+	},
+}
+
+// LookupMethod returns the spec for a method name
+func LookupMethod(name string) (MethodSpec, bool) {
+	for _, m := range Methods {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return MethodSpec{}, false
+}
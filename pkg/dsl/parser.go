@@ -9,7 +9,19 @@ type Parser struct {
 	l         *Lexer
 	curToken  Token
 	peekToken Token
-	errors    []string
+	errors    []*ParseError
+}
+
+// ParseError is a syntax error at a byte offset of the parsed input
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string { return e.Msg }
+
+func (p *Parser) errorf(pos int, format string, args ...any) *ParseError {
+	return &ParseError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
 }
 
 func NewParser(input string) *Parser {
@@ -33,11 +45,12 @@ func (p *Parser) Parse() (*Query, error) {
 		if p.curToken.Type == Ident {
 			method := p.parseMethodCall()
 			if method == nil {
-				return nil, fmt.Errorf("failed to parse method at pos %d. %s", p.l.position-1, p.errors[0])
+				first := p.errors[0]
+				return nil, p.errorf(first.Pos, "failed to parse method at pos %d. %s", first.Pos, first.Msg)
 			}
 			query.Methods = append(query.Methods, method)
 		} else {
-			return nil, fmt.Errorf("expected method name, got %v at pos %d", p.curToken.Type, p.curToken.PosX)
+			return nil, p.errorf(p.curToken.PosX, "expected method name, got %v at pos %d", p.curToken.Type, p.curToken.PosX)
 		}
 
 		if p.expectPeek(Dot) {
@@ -48,7 +61,7 @@ func (p *Parser) Parse() (*Query, error) {
 	}
 
 	if p.curToken.Type == EOF {
-		return nil, fmt.Errorf("expected method name, got %v at pos %d", p.curToken.Type, p.curToken.PosX)
+		return nil, p.errorf(p.curToken.PosX, "expected method name, got %v at pos %d", p.curToken.Type, p.curToken.PosX)
 	}
 
 	return query, nil
@@ -77,22 +90,27 @@ func (p *Parser) parseMethodCall() *MethodCall {
 func (p *Parser) parseArguments() []Expression {
 	var args []Expression
 
-	if p.curToken.Type != RParen {
-		args = []Expression{}
+	// Empty argument list: already at the closing paren
+	if p.curToken.Type == RParen {
+		return []Expression{}
+	}
 
-		arg := p.parseExpression()
-		if arg != nil {
-			args = append(args, arg)
-		}
+	args = []Expression{}
 
-		for p.peekToken.Type == Comma {
-			p.nextToken()
-			p.nextToken()
-			arg := p.parseExpression()
-			if arg != nil {
-				args = append(args, arg)
-			}
+	arg := p.parseExpression()
+	if arg == nil {
+		return nil
+	}
+	args = append(args, arg)
+
+	for p.peekToken.Type == Comma {
+		p.nextToken()
+		p.nextToken()
+		arg := p.parseExpression()
+		if arg == nil {
+			return nil
 		}
+		args = append(args, arg)
 	}
 
 	// if p.peekToken.Type == RParen {
@@ -115,16 +133,64 @@ func (p *Parser) parseExpression() Expression {
 		if v, err := strconv.Atoi(p.curToken.Literal); err == nil {
 			return &NumberLiteral{Value: v}
 		}
+	case Var:
+		if p.curToken.Literal != "" {
+			return &VarRef{Name: p.curToken.Literal}
+		}
+	case LBrace:
+		return p.parseMapLiteral()
 	}
-	p.errors = append(p.errors, fmt.Sprintf("unexpected token: %s", p.curToken.Literal))
+	p.errors = append(p.errors, p.errorf(p.curToken.PosX, "unexpected token: %s", p.curToken.Literal))
 	return nil
 }
 
+// parseMapLiteral parses {key: value, ...}. Keys are identifiers or
+// strings; values are strings, numbers or variables.
+func (p *Parser) parseMapLiteral() Expression {
+	m := &MapLiteral{Entries: []*MapEntry{}}
+	if p.peekToken.Type == RBrace {
+		p.nextToken()
+		return m
+	}
+
+	for {
+		p.nextToken()
+		if p.curToken.Type != Ident && p.curToken.Type != String {
+			p.errors = append(p.errors, p.errorf(p.curToken.PosX, "expected map key, got %v", p.curToken.Type))
+			return nil
+		}
+		key := p.curToken.Literal
+		if !p.expectPeek(Colon) {
+			return nil
+		}
+		p.nextToken()
+		if p.curToken.Type == LBrace {
+			p.errors = append(p.errors, p.errorf(p.curToken.PosX, "map values cannot be maps"))
+			return nil
+		}
+		value := p.parseExpression()
+		if value == nil {
+			return nil
+		}
+		m.Entries = append(m.Entries, &MapEntry{Key: key, Value: value})
+
+		if p.peekToken.Type != Comma {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(RBrace) {
+		return nil
+	}
+	return m
+}
+
 func (p *Parser) expectPeek(t TokenType) bool {
 	if p.peekToken.Type == t {
 		p.nextToken() // advances curToken to peekToken
 		return true
 	}
-	p.errors = append(p.errors, fmt.Sprintf("expected %v, got %v", t, p.peekToken.Type))
+	p.errors = append(p.errors, p.errorf(p.peekToken.PosX, "expected %v, got %v", t, p.peekToken.Type))
 	return false
 }
@@ -10,6 +10,7 @@ const (
 	Int     TokenType = "INT"
 	String  TokenType = "STRING"
 	Number  TokenType = "NUMBER"
+	Var     TokenType = "VAR" // $name, resolved by the caller
 
 	Assign    TokenType = "ASSIGN"
 	Plus      TokenType = "PLUS"
@@ -18,6 +19,9 @@ const (
 
 	LParen TokenType = "LPAREN"
 	RParen TokenType = "RPAREN"
+	LBrace TokenType = "LBRACE"
+	RBrace TokenType = "RBRACE"
+	Colon  TokenType = "COLON"
 	Dot    TokenType = "DOT"
 )
 
@@ -25,5 +29,6 @@ const (
 type Token struct {
 	Type    TokenType
 	Literal string
-	PosX    int
+	PosX    int // byte offset of the first char
+	End     int // byte offset just past the last char
 }
@@ -26,11 +26,11 @@ func ExportToDOT(nodes []*types.Node, edges []*types.Edge, w io.Writer) error {
 
 	// Nodes
 	for _, n := range nodes {
-		label := n.Label
+		label := n.LabelString()
 		if name, ok := n.Props["name"]; ok {
-			label = fmt.Sprintf("%s:%v", n.Label, name)
+			label = fmt.Sprintf("%s:%v", label, name)
 		} else if title, ok := n.Props["title"]; ok {
-			label = fmt.Sprintf("%s:%v", n.Label, title)
+			label = fmt.Sprintf("%s:%v", label, title)
 		}
 		_, err := fmt.Fprintf(w, "  %s [label=%s, shape=box, style=rounded];\n",
 			exportNodeName(n.ID), LabelSafe(label))
@@ -42,11 +42,10 @@ func ExportToDOT(nodes []*types.Node, edges []*types.Edge, w io.Writer) error {
 	// Edges
 	seen := make(map[string]bool)
 	for _, edge := range edges {
-		key := fmt.Sprintf("%s->%s@%s", edge.From, edge.To, edge.Kind)
-		if seen[key] {
+		if seen[edge.ID] {
 			continue
 		}
-		seen[key] = true
+		seen[edge.ID] = true
 
 		fromName := exportNodeName(edge.From)
 		toName := exportNodeName(edge.To)
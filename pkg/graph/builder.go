@@ -4,8 +4,11 @@ package graph
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/aprksy/knitknot/pkg/ports/query"
+	"github.com/aprksy/knitknot/pkg/ports/storage"
 	"github.com/aprksy/knitknot/pkg/ports/types"
 )
 
@@ -54,21 +57,75 @@ func (b *Builder) Limit(n int) *Builder {
 	return b
 }
 
+// Has matches nodes with an edge of the verb to a node whose MatchOn
+// property equals value. Under a verb's inverse name it follows the
+// verb's edges backwards; a symmetric verb's edges are followed both ways.
 func (b *Builder) Has(rel, value string) *Builder {
+	return b.HasWhere(rel, "", "=", value)
+}
+
+// HasWhere is Has comparing prop with op instead, e.g.
+// HasWhere("has_skill", "level", ">=", 3). A property the verb's
+// EdgeProps lists is compared on the edge, any other on the target node.
+// An empty prop is the verb's MatchOn property; types.MatchOnID compares
+// the node ID.
+func (b *Builder) HasWhere(rel, prop, op string, value any) *Builder {
+	t := b.hasEdge(rel)
+	if prop == "" {
+		return b.Where(matchField(t.v, t.matchOn), op, value)
+	}
+	return t.where(b, prop, op, value)
+}
+
+// HasProps is Has matching every property in props, e.g.
+// HasProps("has_skill", map[string]any{"name": "Go", "level": 3}), on the
+// edge or the target node as HasWhere does
+func (b *Builder) HasProps(rel string, props map[string]any) *Builder {
+	t := b.hasEdge(rel)
+	for _, key := range slices.Sorted(maps.Keys(props)) {
+		t.where(b, key, "=", props[key])
+	}
+	return b
+}
+
+// hasTarget is what a Has call added to the plan
+type hasTarget struct {
+	v         string             // the target node's variable
+	matchOn   string             // the property the two-argument form compares
+	edge      *query.PatternEdge // the edge to the target
+	edgeProps []string           // properties compared on the edge
+}
+
+// where filters on prop of the edge if the verb declares it, and of the
+// target node otherwise
+func (t hasTarget) where(b *Builder, prop, op string, value any) *Builder {
+	if slices.Contains(t.edgeProps, prop) {
+		t.edge.Filters = append(t.edge.Filters, query.Filter{Field: prop, Op: op, Value: value})
+		return b
+	}
+	return b.Where(matchField(t.v, prop), op, value)
+}
+
+// hasEdge adds the verb's target node and edge to the plan
+func (b *Builder) hasEdge(rel string) hasTarget {
 	v := b.freshVar()
 
 	// Look up verb semantics
-	verb, ok := b.engine.verbs.Lookup(rel)
+	kind, verb, inverse, ok := b.engine.verbs.Resolve(rel)
 	if !ok {
+		kind = rel
 		verb = types.Verb{
-			TargetLabel: "Entity",
+			TargetLabel: types.DefaultTargetLabel,
 			MatchOn:     types.DefaultMatchProperty,
 		}
 	}
 
 	targetLabel := verb.TargetLabel
 	if targetLabel == "" {
-		targetLabel = "Entity"
+		targetLabel = types.DefaultTargetLabel
+	}
+	if inverse {
+		targetLabel = verb.SourceLabel // empty matches any label
 	}
 
 	propKey := verb.MatchOn
@@ -77,10 +134,29 @@ func (b *Builder) Has(rel, value string) *Builder {
 	}
 
 	b.MatchNode(v, targetLabel)
-	b.RelatedTo(v, rel, "n")
-	b.Where(v+"."+propKey, "=", value)
+	switch {
+	case inverse:
+		b.RelatedTo("n", kind, v)
+	case verb.Symmetric:
+		b.plan.Edges = append(b.plan.Edges, &query.PatternEdge{From: "n", To: v, Kind: kind, Undirected: true})
+	default:
+		b.RelatedTo(v, kind, "n")
+	}
+	return hasTarget{
+		v:         v,
+		matchOn:   propKey,
+		edge:      b.plan.Edges[len(b.plan.Edges)-1],
+		edgeProps: verb.EdgeProps,
+	}
+}
 
-	return b
+// matchField is the filter field for a property of a variable; a bare
+// variable compares the node ID
+func matchField(v, prop string) string {
+	if prop == types.MatchOnID {
+		return v
+	}
+	return v + "." + prop
 }
 
 func (b *Builder) RelatedTo(targetVar, edgeKind, sourceVar string) *Builder {
@@ -111,6 +187,22 @@ func (b *Builder) Exec(ctx context.Context) (query.ResultSet, error) {
 	return result, err
 }
 
+// Iterate is Exec with the rows streamed; close the iterator when done
+func (b *Builder) Iterate(ctx context.Context) (query.ResultIterator, error) {
+	return b.engine.Iterate(ctx, b.plan)
+}
+
+// ExecTx runs the query against a transaction's view of the graph, its
+// own writes included
+func (b *Builder) ExecTx(ctx context.Context, tx storage.Tx) (query.ResultSet, error) {
+	return b.engine.QueryTx(ctx, tx, b.plan)
+}
+
+// IterateTx is ExecTx with the rows streamed
+func (b *Builder) IterateTx(ctx context.Context, tx storage.Tx) (query.ResultIterator, error) {
+	return b.engine.IterateTx(ctx, tx, b.plan)
+}
+
 // Only for testing
 func (b *Builder) ExportPlanForTest() *query.QueryPlan {
 	return b.plan
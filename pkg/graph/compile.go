@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"fmt"
+
+	"github.com/aprksy/knitknot/pkg/dsl"
+)
+
+// Compile builds a query from a parsed DSL query
+func (ge *GraphEngine) Compile(q *dsl.Query) (*Builder, error) {
+	var builder *Builder
+
+	for _, method := range q.Methods {
+		switch method.Name.Value {
+		case "Find":
+			if len(method.Arguments) != 1 {
+				return nil, fmt.Errorf("find takes 1 arg")
+			}
+			if str, ok := method.Arguments[0].(*dsl.StringLiteral); ok {
+				builder = ge.Find(str.Value)
+			} else {
+				return nil, fmt.Errorf("find requires string")
+			}
+
+		case "Has":
+			if len(method.Arguments) != 2 && len(method.Arguments) != 4 {
+				return nil, fmt.Errorf("has takes 2 or 4 args")
+			}
+			rel, ok := method.Arguments[0].(*dsl.StringLiteral)
+			if !ok {
+				return nil, fmt.Errorf("has requires a verb string")
+			}
+			if builder == nil {
+				continue
+			}
+
+			if len(method.Arguments) == 4 {
+				prop, ok1 := method.Arguments[1].(*dsl.StringLiteral)
+				op, ok2 := method.Arguments[2].(*dsl.StringLiteral)
+				if !ok1 || !ok2 {
+					return nil, fmt.Errorf("has property and op must be strings")
+				}
+				value, ok := literalValue(method.Arguments[3])
+				if !ok {
+					return nil, fmt.Errorf("has value must be string or number")
+				}
+				builder = builder.HasWhere(rel.Value, prop.Value, op.Value, value)
+				continue
+			}
+
+			if m, ok := method.Arguments[1].(*dsl.MapLiteral); ok {
+				props := map[string]any{}
+				for _, e := range m.Entries {
+					value, ok := literalValue(e.Value)
+					if !ok {
+						return nil, fmt.Errorf("has value of %s must be string or number", e.Key)
+					}
+					props[e.Key] = value
+				}
+				builder = builder.HasProps(rel.Value, props)
+				continue
+			}
+			value, ok := literalValue(method.Arguments[1])
+			if !ok {
+				return nil, fmt.Errorf("has value must be string, number or {property: value, ...}")
+			}
+			builder = builder.HasWhere(rel.Value, "", "=", value)
+
+		case "Where":
+			if len(method.Arguments) != 3 {
+				return nil, fmt.Errorf("where takes 3 args")
+			}
+			field, ok1 := method.Arguments[0].(*dsl.StringLiteral)
+			op, ok2 := method.Arguments[1].(*dsl.StringLiteral)
+			var value any
+			if str, ok := method.Arguments[2].(*dsl.StringLiteral); ok {
+				value = str.Value
+			} else if num, ok := method.Arguments[2].(*dsl.NumberLiteral); ok {
+				value = num.Value
+			} else {
+				return nil, fmt.Errorf("where value must be string or number")
+			}
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("where field and op must be strings")
+			}
+			if builder != nil {
+				builder = builder.Where(field.Value, op.Value, value)
+			}
+
+		case "WhereEdge":
+			if len(method.Arguments) != 3 {
+				return nil, fmt.Errorf("where takes 3 args")
+			}
+			field, ok1 := method.Arguments[0].(*dsl.StringLiteral)
+			op, ok2 := method.Arguments[1].(*dsl.StringLiteral)
+			var value any
+			if str, ok := method.Arguments[2].(*dsl.StringLiteral); ok {
+				value = str.Value
+			} else if num, ok := method.Arguments[2].(*dsl.NumberLiteral); ok {
+				value = num.Value
+			} else {
+				return nil, fmt.Errorf("where value must be string or number")
+			}
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("where field and op must be strings")
+			}
+			if builder != nil {
+				builder = builder.WhereEdge(field.Value, op.Value, value)
+			}
+
+		case "In":
+			if len(method.Arguments) != 1 {
+				return nil, fmt.Errorf("in takes 1 arg")
+			}
+			if str, ok := method.Arguments[0].(*dsl.StringLiteral); ok && builder != nil {
+				builder = builder.In(str.Value)
+			} else {
+				return nil, fmt.Errorf("in requires string")
+			}
+
+		case "Limit":
+			if len(method.Arguments) != 1 {
+				return nil, fmt.Errorf("limit takes 1 arg")
+			}
+			if num, ok := method.Arguments[0].(*dsl.NumberLiteral); ok && builder != nil {
+				builder = builder.Limit(num.Value)
+			} else {
+				return nil, fmt.Errorf("limit requires number")
+			}
+
+		default:
+			return nil, fmt.Errorf("unknown method: %s", method.Name.Value)
+		}
+	}
+
+	if builder == nil {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	return builder, nil
+}
+
+// literalValue returns the value of a string or number argument
+func literalValue(e dsl.Expression) (any, bool) {
+	switch lit := e.(type) {
+	case *dsl.StringLiteral:
+		return lit.Value, true
+	case *dsl.NumberLiteral:
+		return lit.Value, true
+	}
+	return nil, false
+}
@@ -0,0 +1,240 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// Constraints are checked on the same writes as label schemas, after the
+// schema has converted the values. Lookups go through a property index
+// on the first property of each unique constraint, which the engine
+// creates with the constraint. Checks read the writer's view, so two
+// concurrent transactions can still commit the same value.
+
+// ConstraintError reports the nodes breaking a constraint. NodeIDs lists
+// the existing nodes involved; a node being created has no ID yet.
+type ConstraintError struct {
+	Constraint types.Constraint
+	NodeIDs    []string
+	Reason     string
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("constraint %s (%s) violated: %s", e.Constraint.Name, e.Constraint, e.Reason)
+}
+
+// CreateConstraint checks the existing nodes against a constraint and, if
+// they all pass, enforces it from then on. An empty Name is filled in
+// with the default one.
+func (ge *GraphEngine) CreateConstraint(c types.Constraint) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		c.Name = c.DefaultName()
+	}
+	if _, exists := ge.constraints.Lookup(c.Name); exists {
+		return fmt.Errorf("constraint %s already exists", c.Name)
+	}
+
+	if err := violations(ge.storage, c); err != nil {
+		return err
+	}
+	if c.Distinct() {
+		if err := ge.ensureIndex(c.Label, c.Properties[0]); err != nil {
+			return err
+		}
+	}
+	ge.constraints.Register(c)
+	ge.syncMetadata()
+	return nil
+}
+
+// DropConstraint stops enforcing a constraint, dropping its index unless
+// something else needs it
+func (ge *GraphEngine) DropConstraint(name string) error {
+	c, ok := ge.constraints.Lookup(name)
+	if !ok || !ge.constraints.Remove(name) {
+		return fmt.Errorf("constraint %s not found", name)
+	}
+	ge.syncMetadata()
+	if c.Distinct() {
+		ge.releaseIndex(types.PropertyIndex{Label: c.Label, Property: c.Properties[0]})
+	}
+	return nil
+}
+
+// Constraints returns the constraints, sorted by name
+func (ge *GraphEngine) Constraints() []types.Constraint {
+	return ge.constraints.All()
+}
+
+func (ge *GraphEngine) ensureIndex(label, prop string) error {
+	def := types.PropertyIndex{Label: label, Property: prop}
+	if slices.Contains(ge.storage.ListIndexes(), def) {
+		return nil
+	}
+	return ge.storage.CreateIndex(label, prop)
+}
+
+// releaseIndex drops an index unless another constraint or a unique
+// schema property looks values up in it
+func (ge *GraphEngine) releaseIndex(def types.PropertyIndex) {
+	for _, c := range ge.constraints.All() {
+		if c.Distinct() && c.Label == def.Label && c.Properties[0] == def.Property {
+			return
+		}
+	}
+	if schema, ok := ge.schemas.Lookup(def.Label); ok {
+		if p, ok := schema.Property(def.Property); ok && p.Unique {
+			return
+		}
+	}
+	_ = ge.storage.DropIndex(def.Label, def.Property)
+}
+
+// checkConstraints checks a node about to have the labels and props
+func (ge *GraphEngine) checkConstraints(r storage.Reader, id string, labels []string, props map[string]any) error {
+	for _, c := range ge.constraints.All() {
+		if !slices.Contains(labels, c.Label) {
+			continue
+		}
+
+		values, complete := propValues(props, c.Properties)
+		if !complete {
+			if c.Requires() {
+				return &ConstraintError{Constraint: c, NodeIDs: nonEmpty(id), Reason: missingReason(c, id)}
+			}
+			continue
+		}
+		if !c.Distinct() {
+			continue
+		}
+
+		var others []string
+		for _, n := range r.GetNodesByProp(c.Label, c.Properties[0], values[0]) {
+			if n.ID == id {
+				continue
+			}
+			if v, ok := propValues(n.Props, c.Properties); ok && slices.EqualFunc(v, values, sameValue) {
+				others = append(others, n.ID)
+			}
+		}
+		if len(others) > 0 {
+			slices.Sort(others)
+			return &ConstraintError{
+				Constraint: c,
+				NodeIDs:    others,
+				Reason:     fmt.Sprintf("%s is already used by %s", valueString(c, values), strings.Join(others, ", ")),
+			}
+		}
+	}
+	return nil
+}
+
+// violations checks all nodes of the label against a constraint
+func violations(r storage.Reader, c types.Constraint) error {
+	var missing []string
+	groups := make(map[string][]string) // valueKey to node IDs
+	shown := make(map[string]string)    // valueKey to valueString
+	var keys []string
+
+	for _, n := range r.GetAllNodes() {
+		if !n.HasLabel(c.Label) {
+			continue
+		}
+		values, complete := propValues(n.Props, c.Properties)
+		if !complete {
+			if c.Requires() {
+				missing = append(missing, n.ID)
+			}
+			continue
+		}
+		if c.Distinct() {
+			key := valueKey(values)
+			if groups[key] == nil {
+				keys = append(keys, key)
+				shown[key] = valueString(c, values)
+			}
+			groups[key] = append(groups[key], n.ID)
+		}
+	}
+
+	var reasons, ids []string
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		ids = append(ids, missing...)
+		verb := "lack"
+		if len(missing) == 1 {
+			verb = "lacks"
+		}
+		reasons = append(reasons, fmt.Sprintf("%s %s %s", strings.Join(missing, ", "), verb, strings.Join(c.Properties, ", ")))
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if dup := groups[key]; len(dup) > 1 {
+			slices.Sort(dup)
+			ids = append(ids, dup...)
+			reasons = append(reasons, fmt.Sprintf("%s is used by %s", shown[key], strings.Join(dup, ", ")))
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return &ConstraintError{Constraint: c, NodeIDs: ids, Reason: strings.Join(reasons, "; ")}
+}
+
+// propValues returns the values of the props, and whether the node has
+// them all
+func propValues(props map[string]any, names []string) ([]any, bool) {
+	values := make([]any, len(names))
+	for i, name := range names {
+		v, ok := props[name]
+		if !ok || v == nil {
+			return nil, false
+		}
+		values[i] = v
+	}
+	return values, true
+}
+
+// valueKey tells values apart the way an index does: 1 and 1.0 differ
+func valueKey(values []any) string {
+	var b strings.Builder
+	for _, v := range values {
+		fmt.Fprintf(&b, "%T:%#v\x00", v, v)
+	}
+	return b.String()
+}
+
+func sameValue(a, b any) bool {
+	return valueKey([]any{a}) == valueKey([]any{b})
+}
+
+// valueString prints values as e.g. User.email "a@x"
+func valueString(c types.Constraint, values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%s.%s %#v", c.Label, c.Properties[i], v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func missingReason(c types.Constraint, id string) string {
+	node := "new node"
+	if id != "" {
+		node = "node " + id
+	}
+	return fmt.Sprintf("%s lacks %s", node, strings.Join(c.Properties, ", "))
+}
+
+func nonEmpty(id string) []string {
+	if id == "" {
+		return nil
+	}
+	return []string{id}
+}
@@ -2,6 +2,9 @@ package graph
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 
 	"github.com/aprksy/knitknot/pkg/ports/query"
 	"github.com/aprksy/knitknot/pkg/ports/storage"
@@ -15,15 +18,25 @@ type GraphEngine struct {
 	query           query.QueryEngine
 	defaultSubgraph string
 	verbs           *types.VerbRegistry
+	schemas         *types.SchemaRegistry
+	constraints     *types.ConstraintRegistry
+	verbMode        VerbMode
+	logger          *slog.Logger
 }
 
-// NewGraphEngine creates a new engine with default components.
+// NewGraphEngine creates a new engine with default components, taking
+// over the definitions kept in the storage's metadata.
 func NewGraphEngine(storage storage.StorageEngine) *GraphEngine {
-	return &GraphEngine{
-		storage: storage,
-		query:   q.NewDefaultQueryEngine(),
-		verbs:   types.NewVerbRegistry(),
+	ge := &GraphEngine{
+		storage:     storage,
+		query:       q.NewDefaultQueryEngine(),
+		verbs:       types.NewVerbRegistry(),
+		schemas:     types.NewSchemaRegistry(),
+		constraints: types.NewConstraintRegistry(),
+		logger:      slog.Default(),
 	}
+	ge.adoptMetadata()
+	return ge
 }
 
 // WithQueryEngine allows replacing the query engine (for testing/plugins).
@@ -32,19 +45,116 @@ func (ge *GraphEngine) WithQueryEngine(qe query.QueryEngine) *GraphEngine {
 	return ge
 }
 
+// WithSubgraph restricts queries to a subgraph by default; it is saved
+// with the graph
 func (ge *GraphEngine) WithSubgraph(name string) *GraphEngine {
 	ge.defaultSubgraph = name
+	ge.syncMetadata()
+	return ge
+}
+
+// DefaultSubgraph returns the subgraph queries are restricted to, if any
+func (ge *GraphEngine) DefaultSubgraph() string {
+	return ge.defaultSubgraph
+}
+
+// WithLogger replaces the logger warnings go to (slog.Default())
+func (ge *GraphEngine) WithLogger(logger *slog.Logger) *GraphEngine {
+	ge.logger = logger
 	return ge
 }
 
-// AddNode delegates to storage
+// AddNode checks the props against the label's schema and stores the node
 func (ge *GraphEngine) AddNode(label string, props map[string]any) (string, error) {
-	return ge.storage.AddNode(label, props)
+	props, err := ge.newNodeProps(ge.storage, "", []string{label}, props)
+	if err != nil {
+		return "", err
+	}
+	id, err := ge.storage.AddNode(label, props)
+	return id, ge.refreshed(err, id)
+}
+
+// AddNodeWithLabels adds a node carrying several labels, atomically
+func (ge *GraphEngine) AddNodeWithLabels(labels []string, props map[string]any) (string, error) {
+	tx, err := ge.storage.Begin(context.Background())
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	id, err := ge.addNodeWithLabels(tx, labels, props)
+	if err != nil {
+		return "", err
+	}
+	return id, ge.refreshed(tx.Commit(), id)
+}
+
+// AddNodeWithLabelsTx is AddNodeWithLabels within a transaction begun on
+// the engine. On error the transaction is left without the node.
+func (ge *GraphEngine) AddNodeWithLabelsTx(tx storage.Tx, labels []string, props map[string]any) (string, error) {
+	// The labels are checked together, not one by one as tx would
+	if etx, ok := tx.(*engineTx); ok {
+		tx = etx.Tx
+	}
+	return ge.addNodeWithLabels(tx, labels, props)
+}
+
+func (ge *GraphEngine) addNodeWithLabels(tx storage.Tx, labels []string, props map[string]any) (string, error) {
+	if len(labels) == 0 {
+		return "", errors.New("node needs at least one label")
+	}
+
+	props, err := ge.newNodeProps(tx, "", labels, props)
+	if err != nil {
+		return "", err
+	}
+	id, err := tx.AddNode(labels[0], props)
+	if err != nil {
+		return "", err
+	}
+	for _, label := range labels[1:] {
+		if err := tx.AddLabel(id, label); err != nil {
+			_ = tx.DeleteNode(id)
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+// AddNodeWithID stores a node under a natural key instead of a generated ID
+func (ge *GraphEngine) AddNodeWithID(id, label string, props map[string]any) error {
+	props, err := ge.newNodeProps(ge.storage, id, []string{label}, props)
+	if err != nil {
+		return err
+	}
+	return ge.refreshed(ge.storage.AddNodeWithID(id, label, props), id)
+}
+
+// AddEdge checks an edge against its verb, stores it and returns its ID.
+// Edges of a Unique verb are merged into the existing one between the
+// same nodes, if any.
+func (ge *GraphEngine) AddEdge(from, to, kind string, props map[string]any) (string, error) {
+	from, to, kind = ge.edgeKind(from, to, kind)
+	add := ge.storage.AddEdge
+	v, ok := ge.verbs.Lookup(kind)
+	if ok && v.Unique {
+		add = ge.storage.MergeEdge
+	}
+	if err := ge.checkEdge(ge.storage, from, to, kind, props, ok && v.Unique); err != nil {
+		return "", err
+	}
+	id, err := add(from, to, kind, props)
+	return id, ge.refreshed(err, from, to)
 }
 
-// AddEdge delegates to storage
-func (ge *GraphEngine) AddEdge(from, to, kind string, props map[string]any) error {
-	return ge.storage.AddEdge(from, to, kind, props)
+// AddEdgeWithID checks an edge like AddEdge and stores it under the given
+// ID, e.g. to put back one that was deleted. It is never merged.
+func (ge *GraphEngine) AddEdgeWithID(id, from, to, kind string, props map[string]any) error {
+	from, to, kind = ge.edgeKind(from, to, kind)
+	if err := ge.checkEdge(ge.storage, from, to, kind, props, false); err != nil {
+		return err
+	}
+	return ge.refreshed(ge.storage.AddEdgeWithID(id, from, to, kind, props), from, to)
 }
 
 // GetNode retrieves a node by ID
@@ -57,12 +167,64 @@ func (ge *GraphEngine) GetEdge(id string) (*types.Edge, bool) {
 	return ge.storage.GetEdge(id)
 }
 
-// Query runs a compiled plan using the query engine
+// Query runs a compiled plan using the query engine, against a snapshot so
+// that concurrent writes do not show up halfway through
 func (ge *GraphEngine) Query(ctx context.Context, plan *query.QueryPlan) (query.ResultSet, error) {
-	result, err := ge.query.Execute(ctx, ge.storage, plan)
+	snap := ge.storage.Snapshot()
+	defer snap.Release()
+
+	result, err := ge.query.Execute(ctx, snap, plan)
 	return result, err
 }
 
+// Iterate runs a compiled plan like Query but streams the rows. The
+// snapshot it reads is held until the iterator is closed.
+func (ge *GraphEngine) Iterate(ctx context.Context, plan *query.QueryPlan) (query.ResultIterator, error) {
+	snap := ge.storage.Snapshot()
+	it, err := ge.query.Iterate(ctx, snap, plan)
+	if err != nil {
+		snap.Release()
+		return nil, err
+	}
+	return &snapshotIterator{ResultIterator: it, snap: snap}, nil
+}
+
+// snapshotIterator releases its snapshot when closed
+type snapshotIterator struct {
+	query.ResultIterator
+	snap storage.Snapshot
+}
+
+func (it *snapshotIterator) Close() error {
+	err := it.ResultIterator.Close()
+	if it.snap != nil {
+		it.snap.Release()
+		it.snap = nil
+	}
+	return err
+}
+
+// Begin starts a storage transaction. Its writes are checked like those
+// made on the engine, and committing it refreshes the views.
+func (ge *GraphEngine) Begin(ctx context.Context) (storage.Tx, error) {
+	tx, err := ge.storage.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &engineTx{Tx: tx, ge: ge}, nil
+}
+
+// QueryTx runs a compiled plan against a transaction's view of the graph
+func (ge *GraphEngine) QueryTx(ctx context.Context, tx storage.Tx, plan *query.QueryPlan) (query.ResultSet, error) {
+	return ge.query.Execute(ctx, tx, plan)
+}
+
+// IterateTx streams the rows of a compiled plan from a transaction's view
+// of the graph
+func (ge *GraphEngine) IterateTx(ctx context.Context, tx storage.Tx, plan *query.QueryPlan) (query.ResultIterator, error) {
+	return ge.query.Iterate(ctx, tx, plan)
+}
+
 // Storage exposes the underlying engine (useful for exporters, debug)
 func (ge *GraphEngine) Storage() storage.StorageEngine {
 	return ge.storage
@@ -71,31 +233,163 @@ func (ge *GraphEngine) Storage() storage.StorageEngine {
 // WithVerbs allows replacing or extending the registry
 func (ge *GraphEngine) WithVerbs(vr *types.VerbRegistry) *GraphEngine {
 	ge.verbs = vr
+	ge.syncMetadata()
 	return ge
 }
 
-// RegisterVerb adds a new relationship semantic
+// RegisterVerb adds a new relationship semantic without checking it; see
+// DefineVerb
 func (ge *GraphEngine) RegisterVerb(name string, def types.Verb) {
 	ge.verbs.Register(name, def)
+	ge.syncMetadata()
 }
 
-// Verbs returns the verb registry (for introspection)
+// Verbs returns the verb registry (for introspection). Verbs registered
+// on it directly are not saved; use RegisterVerb.
 func (ge *GraphEngine) Verbs() *types.VerbRegistry {
 	return ge.verbs
 }
 
 func (ge *GraphEngine) UpdateNode(id string, props map[string]any) error {
-	return ge.storage.UpdateNode(id, props)
+	props, err := ge.updatedProps(ge.storage, id, props)
+	if err != nil {
+		return err
+	}
+	return ge.refreshed(ge.storage.UpdateNode(id, props), id)
 }
 
 func (ge *GraphEngine) UpdateEdge(id string, props map[string]any) error {
-	return ge.storage.UpdateEdge(id, props)
+	if err := ge.checkEdgeUpdate(ge.storage, id, props); err != nil {
+		return err
+	}
+	return ge.refreshed(ge.storage.UpdateEdge(id, props), ge.edgeEnds(id)...)
+}
+
+// PatchNode sets and removes some props of a node in one write
+func (ge *GraphEngine) PatchNode(id string, set map[string]any, unset []string) error {
+	set, err := ge.patchedProps(ge.storage, id, set, unset)
+	if err != nil {
+		return err
+	}
+	return ge.refreshed(ge.storage.PatchNode(id, set, unset), id)
+}
+
+func (ge *GraphEngine) PatchEdge(id string, set map[string]any, unset []string) error {
+	if err := ge.checkEdgeUpdate(ge.storage, id, set); err != nil {
+		return err
+	}
+	return ge.refreshed(ge.storage.PatchEdge(id, set, unset), ge.edgeEnds(id)...)
+}
+
+func (ge *GraphEngine) SetLabel(id, label string) error {
+	if err := ge.checkLabels(ge.storage, id, []string{label}); err != nil {
+		return err
+	}
+	return ge.refreshed(ge.storage.SetLabel(id, label), id)
+}
+
+func (ge *GraphEngine) AddLabel(id, label string) error {
+	if err := ge.checkLabels(ge.storage, id, []string{label}); err != nil {
+		return err
+	}
+	return ge.refreshed(ge.storage.AddLabel(id, label), id)
+}
+
+func (ge *GraphEngine) RemoveLabel(id, label string) error {
+	return ge.refreshed(ge.storage.RemoveLabel(id, label), id)
 }
 
 func (ge *GraphEngine) DeleteNode(id string) error {
 	return ge.storage.DeleteNode(id)
 }
 
+func (ge *GraphEngine) DetachDeleteNode(id string) error {
+	neighbours := ge.neighbours(id)
+	return ge.refreshed(ge.storage.DetachDeleteNode(id), neighbours...)
+}
+
+// DeleteEdge deletes the edge of a kind between two nodes; use
+// DeleteEdgeByID when there may be parallel ones
 func (ge *GraphEngine) DeleteEdge(from, to, kind string) error {
-	return ge.storage.DeleteEdge(from, to, kind)
+	from, to, kind = ge.edgeKind(from, to, kind)
+	return ge.refreshed(ge.storage.DeleteEdge(from, to, kind), from, to)
+}
+
+func (ge *GraphEngine) DeleteEdgeByID(id string) error {
+	ends := ge.edgeEnds(id)
+	return ge.refreshed(ge.storage.DeleteEdgeByID(id), ends...)
+}
+
+func (ge *GraphEngine) CreateSubgraph(name, description string) error {
+	return ge.storage.CreateSubgraph(name, description)
+}
+
+// DropSubgraph deletes a subgraph and all memberships in it, not its nodes
+func (ge *GraphEngine) DropSubgraph(name string) error {
+	return ge.storage.DropSubgraph(name)
+}
+
+func (ge *GraphEngine) ListSubgraphs() []*types.Subgraph {
+	return ge.storage.ListSubgraphs()
+}
+
+// AddNodesToSubgraph adds nodes to a subgraph; the members of a view
+// cannot be changed by hand
+func (ge *GraphEngine) AddNodesToSubgraph(name string, ids []string) error {
+	if ge.isView(name) {
+		return fmt.Errorf("%s is a view; its members come from its query", name)
+	}
+	return ge.refreshed(ge.storage.AddNodesToSubgraph(name, ids), ids...)
+}
+
+func (ge *GraphEngine) RemoveNodesFromSubgraph(name string, ids []string) error {
+	if ge.isView(name) {
+		return fmt.Errorf("%s is a view; its members come from its query", name)
+	}
+	return ge.refreshed(ge.storage.RemoveNodesFromSubgraph(name, ids), ids...)
+}
+
+// SetSubgraphMode changes which edges belong to a subgraph, and so what
+// queries In it can follow
+func (ge *GraphEngine) SetSubgraphMode(name string, mode types.SubgraphMode) error {
+	if err := ge.storage.SetSubgraphMode(name, mode); err != nil {
+		return err
+	}
+	return ge.RefreshViews()
+}
+
+func (ge *GraphEngine) AddEdgeToSubgraph(name, edgeID string) error {
+	return ge.refreshed(ge.storage.AddEdgeToSubgraph(name, edgeID), ge.edgeEnds(edgeID)...)
+}
+
+func (ge *GraphEngine) RemoveEdgeFromSubgraph(name, edgeID string) error {
+	return ge.refreshed(ge.storage.RemoveEdgeFromSubgraph(name, edgeID), ge.edgeEnds(edgeID)...)
+}
+
+// refreshed refreshes the views for the nodes a successful write touched
+func (ge *GraphEngine) refreshed(err error, ids ...string) error {
+	if err == nil {
+		ge.refreshNodes(ids...)
+	}
+	return err
+}
+
+// edgeEnds returns the nodes an edge joins, if it exists
+func (ge *GraphEngine) edgeEnds(id string) []string {
+	if e, ok := ge.storage.GetEdge(id); ok {
+		return []string{e.From, e.To}
+	}
+	return nil
+}
+
+// neighbours returns the nodes joined to a node by an edge either way
+func (ge *GraphEngine) neighbours(id string) []string {
+	var ids []string
+	for _, e := range ge.storage.GetEdgesTo(id) {
+		ids = append(ids, e.From)
+	}
+	for _, e := range ge.storage.GetEdgesFrom(id) {
+		ids = append(ids, e.To)
+	}
+	return ids
 }
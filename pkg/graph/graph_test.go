@@ -1,13 +1,19 @@
 package graph_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/aprksy/knitknot/pkg/dsl"
 	"github.com/aprksy/knitknot/pkg/graph"
 	"github.com/aprksy/knitknot/pkg/ports/query"
+	"github.com/aprksy/knitknot/pkg/ports/storage"
 	"github.com/aprksy/knitknot/pkg/ports/types"
 	"github.com/aprksy/knitknot/pkg/storage/inmem"
 )
@@ -65,7 +71,7 @@ var _ = Describe("Builder.Has", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			// Connect them
-			err = engine.AddEdge(aliceID, goID, "has_skill", nil)
+			_, err = engine.AddEdge(aliceID, goID, "has_skill", nil)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Re-run same query
@@ -76,7 +82,7 @@ var _ = Describe("Builder.Has", func() {
 			row := result.Items()[0]
 			n, ok := row["n"]
 			Expect(ok).To(BeTrue())
-			Expect(n.Label).To(Equal("User"))
+			Expect(n.Labels).To(Equal([]string{"User"}))
 			Expect(n.Props["name"]).To(Equal("Alice"))
 		})
 	})
@@ -88,7 +94,7 @@ var _ = Describe("Builder.Has", func() {
 			// Add matching data
 			userID, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
 			topicID, _ := engine.AddNode("Entity", map[string]any{"name": "Rust"})
-			_ = engine.AddEdge(userID, topicID, "likes", nil)
+			_, _ = engine.AddEdge(userID, topicID, "likes", nil)
 
 			result, err := engine.Find("User").Has("likes", "Rust").Exec(context.Background())
 			Expect(err).NotTo(HaveOccurred())
@@ -106,7 +112,7 @@ var _ = Describe("Builder.Has", func() {
 			// Add data
 			userID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
 			projID, _ := engine.AddNode("Project", map[string]any{"name": "KnitKnot"})
-			_ = engine.AddEdge(userID, projID, "contributes_to", map[string]any{
+			_, _ = engine.AddEdge(userID, projID, "contributes_to", map[string]any{
 				"level": 5,
 			})
 
@@ -130,7 +136,7 @@ var _ = Describe("Builder.Has", func() {
 
 			personID, _ := engine.AddNode("Person", map[string]any{"name": "Bob"})
 			userID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
-			_ = engine.AddEdge(userID, personID, "knows", nil)
+			_, _ = engine.AddEdge(userID, personID, "knows", nil)
 
 			result, err := engine.Find("User").Has("knows", "Bob").Exec(context.Background())
 			Expect(err).NotTo(HaveOccurred())
@@ -147,7 +153,7 @@ var _ = Describe("Builder.Has", func() {
 
 			skillID, _ := engine.AddNode("Skill", map[string]any{"name": "Go"})
 			userID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
-			_ = engine.AddEdge(userID, skillID, "HAS_SKILL", nil)
+			_, _ = engine.AddEdge(userID, skillID, "HAS_SKILL", nil)
 
 			result, err := engine.Find("User").Has("HAS_SKILL", "Go").Exec(context.Background())
 			Expect(err).NotTo(HaveOccurred())
@@ -177,7 +183,7 @@ var _ = Describe("Builder.Has", func() {
 		It("should not match", func() {
 			userID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
 			skillID, _ := engine.AddNode("Skill", map[string]any{}) // no 'name'
-			_ = engine.AddEdge(userID, skillID, "has_skill", nil)
+			_, _ = engine.AddEdge(userID, skillID, "has_skill", nil)
 
 			result, err := engine.Find("User").Has("has_skill", "Go").Exec(context.Background())
 			Expect(err).NotTo(HaveOccurred())
@@ -185,6 +191,118 @@ var _ = Describe("Builder.Has", func() {
 		})
 	})
 
+	Context("with an operator or a property map", func() {
+		It("should compare any property of the target", func() {
+			aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+			bobID, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
+			goID, _ := engine.AddNode("Skill", map[string]any{"name": "Go", "level": 4})
+			rustID, _ := engine.AddNode("Skill", map[string]any{"name": "Rust", "level": 2})
+			_, _ = engine.AddEdge(aliceID, goID, "has_skill", nil)
+			_, _ = engine.AddEdge(bobID, rustID, "has_skill", nil)
+
+			result, err := engine.Find("User").HasWhere("has_skill", "level", ">=", 3).Exec(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+			Expect(result.Items()[0]["n"].ID).To(Equal(aliceID))
+
+			result, err = engine.Find("User").HasProps("has_skill", map[string]any{"name": "Rust", "level": 2}).Exec(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+			Expect(result.Items()[0]["n"].ID).To(Equal(bobID))
+
+			result, err = engine.Find("User").HasProps("has_skill", map[string]any{"name": "Rust", "level": 4}).Exec(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Empty()).To(BeTrue())
+
+			// An empty prop is the verb's MatchOn
+			result, err = engine.Find("User").HasWhere("has_skill", "", "!=", "Go").Exec(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+			Expect(result.Items()[0]["n"].ID).To(Equal(bobID))
+		})
+
+		It("should compare the properties the verb gives its edges on the edge", func() {
+			engine.RegisterVerb("rated", types.Verb{TargetLabel: "Skill", EdgeProps: []string{"level"}})
+			aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+			bobID, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
+			// The skills' own levels say the opposite of the edges'
+			goID, _ := engine.AddNode("Skill", map[string]any{"name": "Go", "level": 1})
+			rustID, _ := engine.AddNode("Skill", map[string]any{"name": "Rust", "level": 5})
+			_, err := engine.AddEdge(aliceID, goID, "rated", map[string]any{"level": 4})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = engine.AddEdge(bobID, rustID, "rated", map[string]any{"level": 2})
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := engine.Find("User").HasWhere("rated", "level", ">=", 3).Exec(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+			Expect(result.Items()[0]["n"].ID).To(Equal(aliceID))
+
+			// name is not an edge property, so it is the skill's
+			result, err = engine.Find("User").HasProps("rated", map[string]any{"name": "Rust", "level": 2}).Exec(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+			Expect(result.Items()[0]["n"].ID).To(Equal(bobID))
+
+			result, err = engine.Find("User").HasProps("rated", map[string]any{"name": "Rust", "level": 5}).Exec(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Empty()).To(BeTrue())
+		})
+
+		It("should match the node ID when the verb says so", func() {
+			engine.RegisterVerb("works_at", types.Verb{TargetLabel: "Company", MatchOn: types.MatchOnID})
+			aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+			acmeID, _ := engine.AddNode("Company", map[string]any{"name": "Acme"})
+			_, _ = engine.AddEdge(aliceID, acmeID, "works_at", nil)
+
+			result, err := engine.Find("User").Has("works_at", acmeID).Exec(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+			result, err = engine.Find("User").Has("works_at", "Acme").Exec(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Empty()).To(BeTrue())
+
+			result, err = engine.Find("User").HasProps("works_at", map[string]any{types.MatchOnID: acmeID, "name": "Acme"}).Exec(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+		})
+
+		It("should compile every form of Has", func() {
+			aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+			goID, _ := engine.AddNode("Skill", map[string]any{"name": "Go", "level": 4})
+			_, _ = engine.AddEdge(aliceID, goID, "has_skill", nil)
+
+			for input, want := range map[string]int{
+				"Find('User').Has('has_skill', 'Go')":                       1,
+				"Find('User').Has('has_skill', 'level', '>=', 4)":           1,
+				"Find('User').Has('has_skill', 'level', '<', 4)":            0,
+				"Find('User').Has('has_skill', {name: 'Go', level: 4})":     1,
+				"Find('User').Has('has_skill', {name: 'Go', level: 3})":     0,
+				"Find('User').Has('has_skill', {'@id': '" + goID + "'})":    1,
+				"Find('User').Has('has_skill', '@id', '=', '" + goID + "')": 1,
+			} {
+				ast, err := dsl.NewParser(input).Parse()
+				Expect(err).NotTo(HaveOccurred())
+				b, err := engine.Compile(ast)
+				Expect(err).NotTo(HaveOccurred(), input)
+				result, err := b.Exec(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Len()).To(Equal(want), input)
+			}
+
+			for _, input := range []string{
+				"Find('User').Has('has_skill', 'level', '>=')",
+				"Find('User').Has('has_skill', {name: $x})",
+				"Find('User').Has(3, 'Go')",
+			} {
+				ast, err := dsl.NewParser(input).Parse()
+				Expect(err).NotTo(HaveOccurred())
+				_, err = engine.Compile(ast)
+				Expect(err).To(HaveOccurred(), input)
+			}
+		})
+	})
+
 	Context("with multiple Has calls", func() {
 		It("should bind distinct variables", func() {
 			engine.RegisterVerb("teaches", types.Verb{TargetLabel: "Course", MatchOn: "code"})
@@ -192,11 +310,11 @@ var _ = Describe("Builder.Has", func() {
 			// Alice → teaches → CS101
 			aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
 			cs101ID, _ := engine.AddNode("Course", map[string]any{"code": "CS101"})
-			_ = engine.AddEdge(aliceID, cs101ID, "teaches", nil)
+			_, _ = engine.AddEdge(aliceID, cs101ID, "teaches", nil)
 
 			// Alice → has_skill → Go
 			goID, _ := engine.AddNode("Skill", map[string]any{"name": "Go"})
-			_ = engine.AddEdge(aliceID, goID, "has_skill", nil)
+			_, _ = engine.AddEdge(aliceID, goID, "has_skill", nil)
 
 			result, err := engine.Find("User").
 				Has("teaches", "CS101").
@@ -213,3 +331,942 @@ var _ = Describe("Builder.Has", func() {
 		})
 	})
 })
+
+var _ = Describe("GraphEngine.Begin", func() {
+	It("should query a transaction's uncommitted writes", func() {
+		engine := graph.NewGraphEngine(inmem.New())
+		ctx := context.Background()
+
+		tx, err := engine.Begin(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = tx.Rollback() }()
+
+		_, err = tx.AddNode("User", map[string]any{"name": "Alice"})
+		Expect(err).NotTo(HaveOccurred())
+
+		plan := engine.Find("User").ExportPlanForTest()
+		result, err := engine.QueryTx(ctx, tx, plan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Len()).To(Equal(1))
+
+		result, err = engine.Query(ctx, plan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Len()).To(Equal(0))
+	})
+
+	It("should merge edges of a Unique verb like the engine", func() {
+		engine := graph.NewGraphEngine(inmem.New())
+		engine.RegisterVerb("likes", types.Verb{Unique: true})
+		alice, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+		bob, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
+
+		tx, err := engine.Begin(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		first, err := tx.AddEdge(alice, bob, "likes", map[string]any{"since": 1})
+		Expect(err).NotTo(HaveOccurred())
+		second, err := tx.AddEdge(alice, bob, "likes", map[string]any{"since": 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(Equal(first))
+		Expect(tx.Commit()).To(Succeed())
+
+		edges := engine.Storage().GetEdgesFrom(alice)
+		Expect(edges).To(HaveLen(1))
+		Expect(edges[0].Props["since"]).To(Equal(2))
+		Expect(engine.ValidateEdges()).To(BeEmpty())
+	})
+
+	It("should add a node with several labels checked together", func() {
+		engine := graph.NewGraphEngine(inmem.New())
+		Expect(engine.DefineLabel(types.LabelSchema{
+			Label:      "Mentor",
+			Properties: []types.PropertyDef{{Name: "active", Type: types.PropBool, Required: true, Default: true}},
+		})).To(Succeed())
+		Expect(engine.DefineLabel(types.LabelSchema{
+			Label:      "Badge",
+			Properties: []types.PropertyDef{{Name: "level", Type: types.PropInt, Required: true}},
+		})).To(Succeed())
+		ctx := context.Background()
+
+		tx, err := engine.Begin(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = tx.Rollback() }()
+		id, err := engine.AddNodeWithLabelsTx(tx, []string{"User", "Mentor"}, map[string]any{"name": "Alice"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = engine.AddNodeWithLabelsTx(tx, []string{"User", "Badge"}, map[string]any{"name": "Bob"})
+		Expect(err).To(MatchError(ContainSubstring("level")))
+
+		result, err := engine.Find("User").ExecTx(ctx, tx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Len()).To(Equal(1))
+		n, _ := tx.GetNode(id)
+		Expect(n.Labels).To(Equal([]string{"User", "Mentor"}))
+		Expect(n.Props["active"]).To(Equal(true))
+	})
+
+	It("should stream a transaction's writes through the builder", func() {
+		engine := graph.NewGraphEngine(inmem.New())
+		ctx := context.Background()
+		tx, err := engine.Begin(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = tx.Rollback() }()
+		_, _ = tx.AddNode("User", map[string]any{"name": "Alice"})
+
+		it, err := engine.Find("User").IterateTx(ctx, tx)
+		Expect(err).NotTo(HaveOccurred())
+		defer it.Close()
+		Expect(it.Next(ctx)).To(BeTrue())
+		Expect(it.Row()["n"].Props["name"]).To(Equal("Alice"))
+		Expect(it.Next(ctx)).To(BeFalse())
+	})
+
+	It("should check an edge put back under its ID", func() {
+		engine := graph.NewGraphEngine(inmem.New()).WithVerbMode(graph.VerbsStrict)
+		engine.RegisterVerb("has_skill", types.Verb{TargetLabel: "Skill"})
+		alice, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+		goID, _ := engine.AddNode("Skill", map[string]any{"name": "Go"})
+		id, err := engine.AddEdge(alice, goID, "has_skill", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(engine.DeleteEdgeByID(id)).To(Succeed())
+
+		Expect(engine.AddEdgeWithID("e9", goID, alice, "has_skill", nil)).To(MatchError(ContainSubstring("must end at a Skill node")))
+
+		tx, err := engine.Begin(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tx.AddEdgeWithID("e9", alice, goID, "knows", nil)).To(MatchError(ContainSubstring("not a registered verb")))
+		Expect(tx.AddEdgeWithID(id, alice, goID, "has_skill", nil)).To(Succeed())
+		Expect(tx.Commit()).To(Succeed())
+
+		edge, ok := engine.GetEdge(id)
+		Expect(ok).To(BeTrue())
+		Expect(edge.From).To(Equal(alice))
+	})
+})
+
+var _ = Describe("GraphEngine.Iterate", func() {
+	It("should stream from a snapshot held until the iterator is closed", func() {
+		store := &releaseCounter{Storage: inmem.New()}
+		engine := graph.NewGraphEngine(store)
+		ctx := context.Background()
+		_, _ = engine.AddNode("User", map[string]any{"name": "Alice"})
+		_, _ = engine.AddNode("User", map[string]any{"name": "Bob"})
+
+		it, err := engine.Find("User").Iterate(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		_, _ = engine.AddNode("User", map[string]any{"name": "Carol"})
+
+		count := 0
+		for it.Next(ctx) {
+			count++
+		}
+		Expect(it.Err()).NotTo(HaveOccurred())
+		Expect(count).To(Equal(2))
+		Expect(store.released).To(Equal(0))
+
+		Expect(it.Close()).To(Succeed())
+		Expect(it.Close()).To(Succeed())
+		Expect(store.released).To(Equal(1))
+	})
+})
+
+// releaseCounter counts the snapshots released
+type releaseCounter struct {
+	*inmem.Storage
+	released int
+}
+
+func (s *releaseCounter) Snapshot() storage.Snapshot {
+	return &countedSnapshot{Snapshot: s.Storage.Snapshot(), released: &s.released}
+}
+
+type countedSnapshot struct {
+	storage.Snapshot
+	released *int
+}
+
+func (sn *countedSnapshot) Release() {
+	*sn.released++
+	sn.Snapshot.Release()
+}
+
+var _ = Describe("GraphEngine.AddEdge", func() {
+	var (
+		engine         *graph.GraphEngine
+		aliceID, bobID string
+	)
+
+	BeforeEach(func() {
+		engine = graph.NewGraphEngine(inmem.New())
+		aliceID, _ = engine.AddNode("User", map[string]any{"name": "Alice"})
+		bobID, _ = engine.AddNode("User", map[string]any{"name": "Bob"})
+	})
+
+	It("should add parallel edges by default", func() {
+		_, _ = engine.AddEdge(aliceID, bobID, "messaged", nil)
+		_, _ = engine.AddEdge(aliceID, bobID, "messaged", nil)
+
+		Expect(engine.Storage().GetEdgesFrom(aliceID)).To(HaveLen(2))
+	})
+
+	It("should keep a single edge of a unique verb", func() {
+		engine.RegisterVerb("reports_to", types.Verb{TargetLabel: "User", Unique: true})
+
+		first, err := engine.AddEdge(aliceID, bobID, "reports_to", map[string]any{"since": 2020})
+		Expect(err).NotTo(HaveOccurred())
+		second, err := engine.AddEdge(aliceID, bobID, "reports_to", map[string]any{"since": 2024})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(second).To(Equal(first))
+		edges := engine.Storage().GetEdgesFrom(aliceID)
+		Expect(edges).To(HaveLen(1))
+		Expect(edges[0].Props["since"]).To(Equal(2024))
+
+		Expect(engine.DeleteEdge(aliceID, bobID, "reports_to")).To(Succeed())
+	})
+})
+
+var _ = Describe("Multi-label nodes", func() {
+	It("should be found by any of their labels", func() {
+		engine := graph.NewGraphEngine(inmem.New())
+		ctx := context.Background()
+
+		id, err := engine.AddNodeWithLabels([]string{"Employee", "Mentor"}, map[string]any{"name": "Alice"})
+		Expect(err).NotTo(HaveOccurred())
+		_, _ = engine.AddNode("Employee", map[string]any{"name": "Bob"})
+
+		mentors, err := engine.Find("Mentor").Exec(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mentors.Len()).To(Equal(1))
+		Expect(mentors.Items()[0]["n"].ID).To(Equal(id))
+
+		employees, err := engine.Find("Employee").Exec(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(employees.Len()).To(Equal(2))
+	})
+})
+
+var _ = Describe("Views", func() {
+	var (
+		engine         *graph.GraphEngine
+		store          *inmem.Storage
+		aliceID, bobID string
+		memberIDs      func(name string) []string
+	)
+
+	BeforeEach(func() {
+		store = inmem.New()
+		engine = graph.NewGraphEngine(store)
+		engine.RegisterVerb("has_skill", types.Verb{TargetLabel: "Skill", MatchOn: "name"})
+		aliceID, _ = engine.AddNode("User", map[string]any{"name": "Alice", "age": 60})
+		bobID, _ = engine.AddNode("User", map[string]any{"name": "Bob", "age": 30})
+
+		memberIDs = func(name string) []string {
+			var ids []string
+			for _, n := range store.GetNodesIn(name) {
+				ids = append(ids, n.ID)
+			}
+			return ids
+		}
+	})
+
+	It("should hold the results of its query", func() {
+		Expect(engine.CreateView("seniors", "Find('User').Where('n.age', '>', 50)")).To(Succeed())
+		Expect(memberIDs("seniors")).To(ConsistOf(aliceID))
+
+		result, err := engine.Find("User").In("seniors").Exec(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Len()).To(Equal(1))
+	})
+
+	It("should follow node writes", func() {
+		Expect(engine.CreateView("seniors", "Find('User').Where('n.age', '>', 50)")).To(Succeed())
+
+		Expect(engine.PatchNode(bobID, map[string]any{"age": 55}, nil)).To(Succeed())
+		Expect(memberIDs("seniors")).To(ConsistOf(aliceID, bobID))
+
+		Expect(engine.UpdateNode(aliceID, map[string]any{"name": "Alice"})).To(Succeed())
+		Expect(memberIDs("seniors")).To(ConsistOf(bobID))
+
+		carolID, _ := engine.AddNode("User", map[string]any{"name": "Carol", "age": 70})
+		Expect(memberIDs("seniors")).To(ConsistOf(bobID, carolID))
+	})
+
+	It("should follow edge writes and changes to their targets", func() {
+		Expect(engine.CreateView("gophers", "Find('User').Has('has_skill', 'Go')")).To(Succeed())
+		goID, _ := engine.AddNode("Skill", map[string]any{"name": "Golang"})
+
+		edgeID, err := engine.AddEdge(aliceID, goID, "has_skill", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(memberIDs("gophers")).To(BeEmpty())
+
+		Expect(engine.PatchNode(goID, map[string]any{"name": "Go"}, nil)).To(Succeed())
+		Expect(memberIDs("gophers")).To(ConsistOf(aliceID))
+
+		Expect(engine.DeleteEdgeByID(edgeID)).To(Succeed())
+		Expect(memberIDs("gophers")).To(BeEmpty())
+	})
+
+	It("should follow edge writes of inverse and symmetric verbs at either end", func() {
+		Expect(engine.DefineVerb("reports_to", types.Verb{TargetLabel: "User", Inverse: "manages"})).To(Succeed())
+		Expect(engine.DefineVerb("knows", types.Verb{TargetLabel: "User", MatchOn: "name", Symmetric: true})).To(Succeed())
+		Expect(engine.CreateView("bobs_managers", "Find('User').Has('manages', 'Bob')")).To(Succeed())
+		Expect(engine.CreateView("knows_alice", "Find('User').Has('knows', 'Alice')")).To(Succeed())
+
+		// Bob reports to Alice: Alice, the target, manages Bob
+		edgeID, err := engine.AddEdge(bobID, aliceID, "reports_to", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(memberIDs("bobs_managers")).To(ConsistOf(aliceID))
+
+		Expect(engine.PatchNode(bobID, map[string]any{"name": "Robert"}, nil)).To(Succeed())
+		Expect(memberIDs("bobs_managers")).To(BeEmpty())
+		Expect(engine.PatchNode(bobID, map[string]any{"name": "Bob"}, nil)).To(Succeed())
+		Expect(memberIDs("bobs_managers")).To(ConsistOf(aliceID))
+
+		Expect(engine.DeleteEdgeByID(edgeID)).To(Succeed())
+		Expect(memberIDs("bobs_managers")).To(BeEmpty())
+
+		// Alice knows Bob, so Bob knows Alice
+		_, err = engine.AddEdge(aliceID, bobID, "knows", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(memberIDs("knows_alice")).To(ConsistOf(bobID))
+
+		Expect(engine.DetachDeleteNode(aliceID)).To(Succeed())
+		Expect(memberIDs("knows_alice")).To(BeEmpty())
+	})
+
+	It("should be refreshed by a committed transaction", func() {
+		Expect(engine.CreateView("seniors", "Find('User').Where('n.age', '>', 50)")).To(Succeed())
+
+		tx, err := engine.Begin(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tx.PatchNode(bobID, map[string]any{"age": 80}, nil)).To(Succeed())
+		Expect(memberIDs("seniors")).To(ConsistOf(aliceID))
+
+		Expect(tx.Commit()).To(Succeed())
+		Expect(memberIDs("seniors")).To(ConsistOf(aliceID, bobID))
+	})
+
+	It("should not accept members by hand, Limit or another view", func() {
+		Expect(engine.CreateView("seniors", "Find('User').Where('n.age', '>', 50)")).To(Succeed())
+
+		Expect(engine.AddNodesToSubgraph("seniors", []string{bobID})).To(HaveOccurred())
+		Expect(engine.CreateView("one", "Find('User').Limit(1)")).To(HaveOccurred())
+		Expect(engine.CreateView("nested", "Find('User').In('seniors')")).To(HaveOccurred())
+		Expect(store.ListSubgraphs()).To(HaveLen(1))
+	})
+
+	It("should be saved with its query", func() {
+		Expect(engine.CreateView("seniors", "Find('User').Where('n.age', '>', 50)")).To(Succeed())
+		filename := filepath.Join(GinkgoT().TempDir(), "views.gob")
+		Expect(store.Save(filename)).To(Succeed())
+
+		loaded := inmem.New()
+		loadedEngine := graph.NewGraphEngine(loaded)
+		Expect(loaded.Load(filename)).To(Succeed())
+		Expect(loadedEngine.LoadMetadata()).To(Succeed())
+		Expect(loaded.ListSubgraphs()[0].Query).To(Equal("Find('User').Where('n.age', '>', 50)"))
+
+		Expect(loadedEngine.PatchNode(bobID, map[string]any{"age": 90}, nil)).To(Succeed())
+		Expect(loaded.GetNodesIn("seniors")).To(HaveLen(2))
+	})
+})
+
+var _ = Describe("Label schemas", func() {
+	var (
+		engine *graph.GraphEngine
+		store  *inmem.Storage
+	)
+
+	BeforeEach(func() {
+		store = inmem.New()
+		engine = graph.NewGraphEngine(store)
+		Expect(engine.DefineLabel(types.LabelSchema{
+			Label: "User",
+			Properties: []types.PropertyDef{
+				{Name: "name", Type: types.PropString, Required: true},
+				{Name: "age", Type: types.PropInt},
+				{Name: "email", Type: types.PropString, Unique: true},
+				{Name: "active", Type: types.PropBool, Default: true},
+			},
+		})).To(Succeed())
+	})
+
+	It("should reject invalid schemas", func() {
+		Expect(engine.DefineLabel(types.LabelSchema{
+			Label:      "Bad",
+			Properties: []types.PropertyDef{{Name: "x", Type: types.PropInt, Default: "many"}},
+		})).To(MatchError(ContainSubstring("Bad.x default")))
+		Expect(engine.DefineLabel(types.LabelSchema{
+			Label:      "Bad",
+			Properties: []types.PropertyDef{{Name: "x", Type: "date"}},
+		})).To(MatchError(ContainSubstring("unknown property type")))
+	})
+
+	It("should require properties and fill in defaults", func() {
+		_, err := engine.AddNode("User", map[string]any{"age": 3})
+		Expect(err).To(MatchError("User.name is required"))
+
+		id, err := engine.AddNode("User", map[string]any{"name": "Alice"})
+		Expect(err).NotTo(HaveOccurred())
+		n, _ := engine.GetNode(id)
+		Expect(n.Props).To(HaveKeyWithValue("active", true))
+	})
+
+	It("should convert values to their declared types", func() {
+		id, err := engine.AddNode("User", map[string]any{"name": 42, "age": "35", "active": "false"})
+		Expect(err).NotTo(HaveOccurred())
+		n, _ := engine.GetNode(id)
+		Expect(n.Props).To(Equal(map[string]any{"name": "42", "age": 35, "active": false}))
+
+		_, err = engine.AddNode("User", map[string]any{"name": "Bob", "age": "old"})
+		Expect(err).To(MatchError(`User.age: want int, got string "old"`))
+	})
+
+	It("should keep unique properties unique", func() {
+		aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice", "email": "a@x"})
+		_, err := engine.AddNode("User", map[string]any{"name": "Bob", "email": "a@x"})
+		Expect(err).To(MatchError(ContainSubstring("User.email must be unique")))
+
+		// A node keeps its own value
+		Expect(engine.PatchNode(aliceID, map[string]any{"age": 30}, nil)).To(Succeed())
+	})
+
+	It("should check updates, patches and label changes", func() {
+		id, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+		Expect(engine.UpdateNode(id, map[string]any{"age": 30})).To(MatchError("User.name is required"))
+		Expect(engine.PatchNode(id, nil, []string{"name"})).To(MatchError("User.name is required"))
+
+		Expect(engine.PatchNode(id, map[string]any{"age": "31"}, nil)).To(Succeed())
+		n, _ := engine.GetNode(id)
+		Expect(n.Props["age"]).To(Equal(31))
+
+		thingID, _ := engine.AddNode("Thing", map[string]any{"size": 1})
+		Expect(engine.AddLabel(thingID, "User")).To(MatchError("User.name is required"))
+		Expect(engine.SetLabel(thingID, "User")).To(MatchError("User.name is required"))
+	})
+
+	It("should check writes made in a transaction", func() {
+		tx, err := engine.Begin(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = tx.Rollback() }()
+
+		_, err = tx.AddNode("User", map[string]any{"age": 3})
+		Expect(err).To(MatchError("User.name is required"))
+
+		id, err := tx.AddNode("User", map[string]any{"name": "Alice", "email": "a@x"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = tx.AddNode("User", map[string]any{"name": "Bob", "email": "a@x"})
+		Expect(err).To(MatchError(ContainSubstring("is used by " + id)))
+	})
+
+	It("should be saved with the graph", func() {
+		filename := filepath.Join(GinkgoT().TempDir(), "schemas.gob")
+		Expect(store.Save(filename)).To(Succeed())
+
+		loaded := inmem.New()
+		loadedEngine := graph.NewGraphEngine(loaded)
+		Expect(loaded.Load(filename)).To(Succeed())
+		Expect(loadedEngine.LoadMetadata()).To(Succeed())
+
+		schema, ok := loadedEngine.Schemas().Lookup("User")
+		Expect(ok).To(BeTrue())
+		Expect(schema).To(Equal(engine.Schemas().All()["User"]))
+		_, err := loadedEngine.AddNode("User", nil)
+		Expect(err).To(MatchError("User.name is required"))
+	})
+})
+
+var _ = Describe("Constraints", func() {
+	var (
+		engine         *graph.GraphEngine
+		store          *inmem.Storage
+		aliceID, bobID string
+	)
+
+	BeforeEach(func() {
+		store = inmem.New()
+		engine = graph.NewGraphEngine(store)
+		aliceID, _ = engine.AddNode("User", map[string]any{"name": "Alice", "email": "a@x"})
+		bobID, _ = engine.AddNode("User", map[string]any{"name": "Bob", "email": "b@x"})
+	})
+
+	unique := types.Constraint{Kind: types.ConstraintUnique, Label: "User", Properties: []string{"email"}}
+
+	It("should reject duplicate values and index the property", func() {
+		Expect(engine.CreateConstraint(unique)).To(Succeed())
+		Expect(engine.Constraints()[0].Name).To(Equal("user_email_unique"))
+		Expect(store.ListIndexes()).To(ContainElement(types.PropertyIndex{Label: "User", Property: "email"}))
+
+		_, err := engine.AddNode("User", map[string]any{"name": "Carol", "email": "a@x"})
+		var cerr *graph.ConstraintError
+		Expect(errors.As(err, &cerr)).To(BeTrue())
+		Expect(cerr.NodeIDs).To(Equal([]string{aliceID}))
+
+		Expect(engine.PatchNode(bobID, map[string]any{"email": "a@x"}, nil)).To(MatchError(ContainSubstring("is already used by " + aliceID)))
+		Expect(engine.PatchNode(aliceID, map[string]any{"name": "Al"}, nil)).To(Succeed())
+
+		// Nodes without the property are not compared
+		_, err = engine.AddNode("User", map[string]any{"name": "Dan"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should check the existing nodes when created", func() {
+		Expect(engine.PatchNode(bobID, map[string]any{"email": "a@x"}, nil)).To(Succeed())
+		carolID, _ := engine.AddNode("User", map[string]any{"email": "c@x"})
+
+		err := engine.CreateConstraint(unique)
+		var cerr *graph.ConstraintError
+		Expect(errors.As(err, &cerr)).To(BeTrue())
+		Expect(cerr.NodeIDs).To(ConsistOf(aliceID, bobID))
+		Expect(engine.Constraints()).To(BeEmpty())
+
+		err = engine.CreateConstraint(types.Constraint{Kind: types.ConstraintExists, Label: "User", Properties: []string{"name"}})
+		Expect(errors.As(err, &cerr)).To(BeTrue())
+		Expect(cerr.NodeIDs).To(Equal([]string{carolID}))
+		Expect(err).To(MatchError(ContainSubstring(carolID + " lacks name")))
+	})
+
+	It("should require the properties of existence constraints and node keys", func() {
+		key := types.Constraint{Name: "user_key", Kind: types.ConstraintNodeKey, Label: "User", Properties: []string{"name", "email"}}
+		Expect(engine.CreateConstraint(key)).To(Succeed())
+		Expect(engine.CreateConstraint(key)).To(MatchError("constraint user_key already exists"))
+
+		Expect(engine.PatchNode(aliceID, nil, []string{"email"})).To(MatchError(ContainSubstring("node " + aliceID + " lacks name, email")))
+		_, err := engine.AddNode("User", map[string]any{"name": "Alice", "email": "a@x"})
+		Expect(err).To(MatchError(ContainSubstring("is already used by " + aliceID)))
+		_, err = engine.AddNode("User", map[string]any{"name": "Alice", "email": "c@x"})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Only nodes with the label are constrained
+		_, err = engine.AddNode("Team", map[string]any{"name": "Alice"})
+		Expect(err).NotTo(HaveOccurred())
+		thingID, _ := engine.AddNode("Thing", nil)
+		Expect(engine.AddLabel(thingID, "User")).To(HaveOccurred())
+	})
+
+	It("should check transactions and drop unused indexes", func() {
+		Expect(engine.CreateConstraint(unique)).To(Succeed())
+
+		tx, err := engine.Begin(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		id, err := tx.AddNode("User", map[string]any{"email": "c@x"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = tx.AddNode("User", map[string]any{"email": "c@x"})
+		Expect(err).To(MatchError(ContainSubstring("is already used by " + id)))
+		Expect(tx.Rollback()).To(Succeed())
+
+		Expect(engine.DropConstraint("user_email_unique")).To(Succeed())
+		Expect(engine.DropConstraint("user_email_unique")).To(HaveOccurred())
+		Expect(store.ListIndexes()).To(BeEmpty())
+		_, err = engine.AddNode("User", map[string]any{"email": "a@x"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should be saved with the graph", func() {
+		Expect(engine.CreateConstraint(unique)).To(Succeed())
+		filename := filepath.Join(GinkgoT().TempDir(), "constraints.gob")
+		Expect(store.Save(filename)).To(Succeed())
+
+		loaded := inmem.New()
+		loadedEngine := graph.NewGraphEngine(loaded)
+		Expect(loaded.Load(filename)).To(Succeed())
+		Expect(loadedEngine.LoadMetadata()).To(Succeed())
+		Expect(loadedEngine.Constraints()).To(Equal(engine.Constraints()))
+		Expect(loaded.ListIndexes()).To(Equal(store.ListIndexes()))
+		_, err := loadedEngine.AddNode("User", map[string]any{"email": "b@x"})
+		Expect(err).To(HaveOccurred())
+
+		// Loading again replaces the constraint
+		Expect(loaded.Load(filename)).To(Succeed())
+		Expect(loadedEngine.LoadMetadata()).To(Succeed())
+		Expect(loadedEngine.Constraints()).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("Verb definitions", func() {
+	var (
+		engine *graph.GraphEngine
+		store  *inmem.Storage
+	)
+
+	BeforeEach(func() {
+		store = inmem.New()
+		engine = graph.NewGraphEngine(store)
+	})
+
+	names := func(result query.ResultSet) []any {
+		var out []any
+		for _, row := range result.Items() {
+			out = append(out, row["n"].Props["name"])
+		}
+		return out
+	}
+
+	It("should reject clashing definitions", func() {
+		Expect(engine.DefineVerb("reports_to", types.Verb{Inverse: "manages"})).To(Succeed())
+		Expect(engine.DefineVerb("manages", types.Verb{})).To(MatchError(ContainSubstring("already the inverse of reports_to")))
+		Expect(engine.DefineVerb("leads", types.Verb{Inverse: "reports_to"})).To(MatchError(ContainSubstring("already a verb")))
+		Expect(engine.DefineVerb("knows", types.Verb{Symmetric: true, Cardinality: "many to one"})).To(HaveOccurred())
+		Expect(engine.DefineVerb("knows", types.Verb{Cardinality: "some"})).To(HaveOccurred())
+
+		// Redefining a verb keeps its own inverse
+		Expect(engine.DefineVerb("reports_to", types.Verb{Inverse: "manages", Cardinality: "many-to-one"})).To(Succeed())
+		v, _ := engine.Verbs().Lookup("reports_to")
+		Expect(v.Cardinality).To(Equal(types.ManyToOne))
+	})
+
+	It("should check the source label and edge props", func() {
+		Expect(engine.DefineVerb("has_skill", types.Verb{
+			SourceLabel: "User", TargetLabel: "Skill", EdgeProps: []string{"level"},
+		})).To(Succeed())
+		aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+		teamID, _ := engine.AddNode("Team", map[string]any{"name": "Core"})
+		goID, _ := engine.AddNode("Skill", map[string]any{"name": "Go"})
+
+		_, err := engine.AddEdge(teamID, goID, "has_skill", nil)
+		Expect(err).To(MatchError(ContainSubstring("must start at a User node")))
+		_, err = engine.AddEdge(aliceID, goID, "has_skill", map[string]any{"since": 2020})
+		Expect(err).To(MatchError(ContainSubstring(`cannot have property "since"`)))
+
+		edgeID, err := engine.AddEdge(aliceID, goID, "has_skill", map[string]any{"level": 3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(engine.PatchEdge(edgeID, map[string]any{"since": 2020}, nil)).To(HaveOccurred())
+		Expect(engine.UpdateEdge(edgeID, map[string]any{"level": 4})).To(Succeed())
+	})
+
+	It("should enforce cardinality", func() {
+		Expect(engine.DefineVerb("reports_to", types.Verb{Cardinality: types.ManyToOne, Unique: true})).To(Succeed())
+		Expect(engine.DefineVerb("parent_of", types.Verb{Cardinality: types.OneToMany})).To(Succeed())
+		aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+		bobID, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
+		carolID, _ := engine.AddNode("User", map[string]any{"name": "Carol"})
+
+		_, err := engine.AddEdge(aliceID, bobID, "reports_to", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = engine.AddEdge(carolID, bobID, "reports_to", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = engine.AddEdge(aliceID, carolID, "reports_to", nil)
+		Expect(err).To(MatchError(ContainSubstring("reports_to is many-to-one: " + aliceID)))
+		// A unique verb replaces the existing edge instead
+		_, err = engine.AddEdge(aliceID, bobID, "reports_to", map[string]any{"since": 2020})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = engine.AddEdge(aliceID, bobID, "parent_of", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = engine.AddEdge(carolID, bobID, "parent_of", nil)
+		Expect(err).To(MatchError(ContainSubstring("parent_of is one-to-many: " + bobID)))
+	})
+
+	It("should store and query edges under the inverse name", func() {
+		Expect(engine.DefineVerb("reports_to", types.Verb{
+			SourceLabel: "User", TargetLabel: "User", Inverse: "manages",
+		})).To(Succeed())
+		aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+		bobID, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
+
+		edgeID, err := engine.AddEdge(bobID, aliceID, "manages", nil)
+		Expect(err).NotTo(HaveOccurred())
+		e, _ := engine.GetEdge(edgeID)
+		Expect(e.From).To(Equal(aliceID))
+		Expect(e.To).To(Equal(bobID))
+		Expect(e.Kind).To(Equal("reports_to"))
+
+		result, err := engine.Find("User").Has("reports_to", "Bob").Exec(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(result)).To(ConsistOf("Alice"))
+		result, err = engine.Find("User").Has("manages", "Alice").Exec(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(result)).To(ConsistOf("Bob"))
+
+		Expect(engine.DeleteEdge(bobID, aliceID, "manages")).To(Succeed())
+		_, ok := engine.GetEdge(edgeID)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should follow symmetric edges both ways", func() {
+		Expect(engine.DefineVerb("married_to", types.Verb{
+			TargetLabel: "User", Symmetric: true, Cardinality: types.OneToOne,
+		})).To(Succeed())
+		aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+		bobID, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
+		carolID, _ := engine.AddNode("User", map[string]any{"name": "Carol"})
+
+		_, err := engine.AddEdge(aliceID, bobID, "married_to", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = engine.AddEdge(carolID, bobID, "married_to", nil)
+		Expect(err).To(MatchError(ContainSubstring(bobID + " already has edge")))
+
+		result, err := engine.Find("User").Has("married_to", "Alice").Exec(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(result)).To(ConsistOf("Bob"))
+		result, err = engine.Find("User").Has("married_to", "Bob").Exec(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(result)).To(ConsistOf("Alice"))
+	})
+
+	It("should check edges added in a transaction", func() {
+		Expect(engine.DefineVerb("reports_to", types.Verb{Cardinality: types.ManyToOne, Inverse: "manages"})).To(Succeed())
+		aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+		bobID, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
+		carolID, _ := engine.AddNode("User", map[string]any{"name": "Carol"})
+
+		tx, err := engine.Begin(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		_, err = tx.AddEdge(bobID, aliceID, "manages", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = tx.AddEdge(aliceID, carolID, "reports_to", nil)
+		Expect(err).To(MatchError(ContainSubstring("many-to-one")))
+		Expect(tx.Commit()).To(Succeed())
+
+		Expect(store.GetEdgesFrom(aliceID)).To(HaveLen(1))
+		Expect(store.GetEdgesFrom(aliceID)[0].Kind).To(Equal("reports_to"))
+	})
+
+	It("should be saved with the graph", func() {
+		def := types.Verb{
+			SourceLabel: "User", TargetLabel: "User", Cardinality: types.ManyToOne,
+			Inverse: "manages", EdgeProps: []string{"since"},
+		}
+		Expect(engine.DefineVerb("reports_to", def)).To(Succeed())
+		filename := filepath.Join(GinkgoT().TempDir(), "verbs.gob")
+		Expect(store.Save(filename)).To(Succeed())
+
+		loaded := inmem.New()
+		loadedEngine := graph.NewGraphEngine(loaded)
+		Expect(loaded.Load(filename)).To(Succeed())
+		Expect(loadedEngine.LoadMetadata()).To(Succeed())
+		v, ok := loadedEngine.Verbs().Lookup("reports_to")
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal(def))
+	})
+})
+
+var _ = Describe("Verb modes", func() {
+	var (
+		engine         *graph.GraphEngine
+		warnings       *bytes.Buffer
+		aliceID, goID  string
+		teamID, orphan string
+	)
+
+	BeforeEach(func() {
+		warnings = &bytes.Buffer{}
+		engine = graph.NewGraphEngine(inmem.New()).
+			WithLogger(slog.New(slog.NewTextHandler(warnings, nil)))
+		engine.RegisterVerb("has_skill", types.Verb{TargetLabel: "Skill"})
+		aliceID, _ = engine.AddNode("User", map[string]any{"name": "Alice"})
+		goID, _ = engine.AddNode("Skill", map[string]any{"name": "Go"})
+		teamID, _ = engine.AddNode("Team", map[string]any{"name": "Core"})
+		orphan = "has_skil"
+	})
+
+	It("should accept any edge when off", func() {
+		Expect(engine.VerbMode()).To(Equal(graph.VerbsOff))
+		_, err := engine.AddEdge(aliceID, goID, orphan, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = engine.AddEdge(aliceID, teamID, "has_skill", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings.String()).To(BeEmpty())
+	})
+
+	It("should warn when lenient", func() {
+		engine.WithVerbMode(graph.VerbsLenient)
+		_, err := engine.AddEdge(aliceID, goID, orphan, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings.String()).To(ContainSubstring("has_skil is not a registered verb"))
+		_, err = engine.AddEdge(aliceID, teamID, "has_skill", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings.String()).To(ContainSubstring("must end at a Skill node; " + teamID + " is Team"))
+	})
+
+	It("should reject when strict, also in transactions", func() {
+		engine.WithVerbMode(graph.VerbsStrict)
+		_, err := engine.AddEdge(aliceID, goID, orphan, nil)
+		Expect(err).To(MatchError(ContainSubstring("not a registered verb")))
+		_, err = engine.AddEdge(aliceID, teamID, "has_skill", nil)
+		Expect(err).To(MatchError(ContainSubstring("must end at a Skill node")))
+		_, err = engine.AddEdge(aliceID, goID, "has_skill", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		tx, err := engine.Begin(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		_, err = tx.AddEdge(aliceID, goID, orphan, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(tx.Rollback()).To(Succeed())
+	})
+
+	It("should parse mode names", func() {
+		Expect(graph.ParseVerbMode("Strict")).To(Equal(graph.VerbsStrict))
+		Expect(graph.ParseVerbMode("")).To(Equal(graph.VerbsOff))
+		_, err := graph.ParseVerbMode("loose")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should report stored edges that break their verbs", func() {
+		e1, _ := engine.AddEdge(aliceID, goID, orphan, nil)
+		e2, _ := engine.AddEdge(aliceID, teamID, "has_skill", nil)
+		_, _ = engine.AddEdge(aliceID, goID, "has_skill", nil)
+		e4, _ := engine.AddEdge(aliceID, teamID, "reports_to", nil)
+		e5, _ := engine.AddEdge(aliceID, teamID, "reports_to", map[string]any{"since": 2020})
+		e6, _ := engine.AddEdge(goID, teamID, "reports_to", nil)
+
+		// The definition arrives after the edges
+		engine.RegisterVerb("reports_to", types.Verb{SourceLabel: "User", Cardinality: types.ManyToOne, EdgeProps: []string{}})
+		Expect(engine.ValidateEdges()).To(Equal([]graph.EdgeViolation{
+			{EdgeID: e1, Kind: orphan, Reason: "has_skil is not a registered verb"},
+			{EdgeID: e2, Kind: "has_skill", Reason: "has_skill edges must end at a Skill node; " + teamID + " is Team"},
+			{EdgeID: e5, Kind: "reports_to", Reason: `reports_to edges cannot have properties; got "since"`},
+			{EdgeID: e5, Kind: "reports_to", Reason: "reports_to is many-to-one: " + aliceID + " already has edge " + e4},
+			{EdgeID: e6, Kind: "reports_to", Reason: "reports_to edges must start at a User node; " + goID + " is Skill"},
+		}))
+	})
+})
+
+var _ = Describe("Metadata", func() {
+	var (
+		engine *graph.GraphEngine
+		store  *inmem.Storage
+	)
+
+	BeforeEach(func() {
+		store = inmem.New()
+		engine = graph.NewGraphEngine(store)
+	})
+
+	It("should write definitions through to the storage", func() {
+		engine.RegisterVerb("has_skill", types.Verb{TargetLabel: "Skill"})
+		Expect(engine.DefineLabel(types.LabelSchema{Label: "User"})).To(Succeed())
+		Expect(engine.CreateConstraint(types.Constraint{Kind: types.ConstraintExists, Label: "User", Properties: []string{"name"}})).To(Succeed())
+		engine.WithSubgraph("org")
+
+		meta := store.Metadata()
+		Expect(meta.Verbs).To(HaveKey("has_skill"))
+		Expect(meta.Schemas).To(HaveKey("User"))
+		Expect(meta.Constraints).To(Equal(engine.Constraints()))
+		Expect(meta.DefaultSubgraph).To(Equal("org"))
+
+		Expect(engine.DropConstraint("user_name_exists")).To(Succeed())
+		Expect(store.Metadata().Constraints).To(BeEmpty())
+	})
+
+	It("should take over the definitions of a loaded storage", func() {
+		engine.RegisterVerb("has_skill", types.Verb{TargetLabel: "Skill"})
+		engine.WithSubgraph("org")
+		filename := filepath.Join(GinkgoT().TempDir(), "meta.gob")
+		Expect(store.Save(filename)).To(Succeed())
+
+		loaded := inmem.New()
+		Expect(loaded.Load(filename)).To(Succeed())
+		fresh := graph.NewGraphEngine(loaded)
+		_, ok := fresh.Verbs().Lookup("has_skill")
+		Expect(ok).To(BeTrue())
+		Expect(fresh.DefaultSubgraph()).To(Equal("org"))
+
+		// Loading into a running engine replaces its definitions
+		other := graph.NewGraphEngine(inmem.New())
+		other.RegisterVerb("knows", types.Verb{})
+		Expect(other.Storage().(*inmem.Storage).Load(filename)).To(Succeed())
+		Expect(other.LoadMetadata()).To(Succeed())
+		Expect(other.Verbs().All()).To(HaveKey("has_skill"))
+		Expect(other.Verbs().All()).To(HaveLen(1))
+		Expect(other.Storage().Metadata().Verbs).To(HaveLen(1))
+		Expect(other.DefaultSubgraph()).To(Equal("org"))
+	})
+
+	It("should leave nothing of the previous graph when loading another", func() {
+		dir := GinkgoT().TempDir()
+		save := func(name string, define func(*graph.GraphEngine)) string {
+			s := inmem.New()
+			define(graph.NewGraphEngine(s))
+			filename := filepath.Join(dir, name)
+			Expect(s.Save(filename)).To(Succeed())
+			return filename
+		}
+		first := save("first.gob", func(e *graph.GraphEngine) {
+			e.RegisterVerb("has_skill", types.Verb{TargetLabel: "Skill"})
+			Expect(e.DefineLabel(types.LabelSchema{Label: "User"})).To(Succeed())
+			Expect(e.CreateConstraint(types.Constraint{Kind: types.ConstraintExists, Label: "User", Properties: []string{"name"}})).To(Succeed())
+			e.WithSubgraph("org")
+		})
+		second := save("second.gob", func(e *graph.GraphEngine) {
+			e.RegisterVerb("knows", types.Verb{Symmetric: true})
+			Expect(e.DefineLabel(types.LabelSchema{Label: "Team"})).To(Succeed())
+		})
+
+		Expect(store.Load(first)).To(Succeed())
+		Expect(engine.LoadMetadata()).To(Succeed())
+		Expect(engine.Constraints()).To(HaveLen(1))
+
+		Expect(store.Load(second)).To(Succeed())
+		Expect(engine.LoadMetadata()).To(Succeed())
+		Expect(engine.Verbs().All()).To(ConsistOf(types.Verb{Symmetric: true}))
+		Expect(engine.Verbs().All()).To(HaveKey("knows"))
+		Expect(engine.Schemas().All()).To(HaveKey("Team"))
+		Expect(engine.Schemas().All()).To(HaveLen(1))
+		Expect(engine.Constraints()).To(BeEmpty())
+		Expect(engine.DefaultSubgraph()).To(BeEmpty())
+		Expect(store.Metadata().Verbs).To(HaveLen(1))
+
+		// A node without a name no longer breaks the first graph's constraint
+		_, err := engine.AddNode("User", nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should keep its definitions when the loaded ones are rejected", func() {
+		engine.RegisterVerb("knows", types.Verb{})
+
+		bad := inmem.New()
+		_, _ = bad.AddNode("User", nil)
+		bad.SetMetadata(types.Metadata{
+			Verbs:       map[string]types.Verb{"has_skill": {}},
+			Constraints: []types.Constraint{{Name: "user_name_exists", Kind: types.ConstraintExists, Label: "User", Properties: []string{"name"}}},
+		})
+		filename := filepath.Join(GinkgoT().TempDir(), "bad.gob")
+		Expect(bad.Save(filename)).To(Succeed())
+
+		Expect(store.Load(filename)).To(Succeed())
+		var violation *graph.ConstraintError
+		Expect(errors.As(engine.LoadMetadata(), &violation)).To(BeTrue())
+		Expect(engine.Verbs().All()).To(HaveKey("knows"))
+		Expect(engine.Verbs().All()).To(HaveLen(1))
+		Expect(engine.Constraints()).To(BeEmpty())
+	})
+
+	uniqueSchemas := types.Metadata{Schemas: map[string]types.LabelSchema{
+		"Team": {Label: "Team", Properties: []types.PropertyDef{{Name: "code", Type: types.PropString, Unique: true}}},
+		"User": {Label: "User", Properties: []types.PropertyDef{{Name: "email", Type: types.PropString, Unique: true}}},
+	}}
+
+	It("should drop the indexes it created when a load fails", func() {
+		failing := &refusingIndexer{Storage: inmem.New(), label: "User"}
+		engine := graph.NewGraphEngine(failing)
+		failing.SetMetadata(uniqueSchemas)
+
+		Expect(engine.LoadMetadata()).To(MatchError("index refused"))
+		Expect(failing.ListIndexes()).To(BeEmpty())
+		Expect(engine.Schemas().All()).To(BeEmpty())
+	})
+
+	It("should index the definitions of a storage that kept no indexes", func() {
+		store.SetMetadata(uniqueSchemas)
+		Expect(store.ListIndexes()).To(BeEmpty())
+
+		engine = graph.NewGraphEngine(store)
+		Expect(store.ListIndexes()).To(ConsistOf(
+			types.PropertyIndex{Label: "Team", Property: "code"},
+			types.PropertyIndex{Label: "User", Property: "email"},
+		))
+	})
+})
+
+// refusingIndexer is a storage that cannot index one label
+type refusingIndexer struct {
+	*inmem.Storage
+	label string
+}
+
+func (s *refusingIndexer) CreateIndex(label, prop string) error {
+	if label == s.label {
+		return errors.New("index refused")
+	}
+	return s.Storage.CreateIndex(label, prop)
+}
@@ -0,0 +1,125 @@
+package graph
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// The verbs, schemas, constraints and default subgraph of an engine live
+// in its storage's metadata as well: every change is written through, so
+// a storage saving its graph saves them too. The property indexes the
+// engine needs are not part of it: they follow from unique schema
+// properties and Distinct constraints, and are created again whenever
+// definitions are taken from a storage.
+
+// LoadMetadata takes over the definitions of a storage that was just
+// loaded, in place of the engine's own. It builds new registries from the
+// storage's metadata and checks them, constraints against the loaded
+// nodes, before swapping them in; on error the engine keeps the
+// definitions it had.
+func (ge *GraphEngine) LoadMetadata() error {
+	meta := ge.storage.Metadata()
+
+	verbs := types.NewVerbRegistry()
+	for name, verb := range meta.Verbs {
+		if err := verb.Validate(name); err != nil {
+			return fmt.Errorf("verb %s: %w", name, err)
+		}
+		verbs.Register(name, verb)
+	}
+	schemas := types.NewSchemaRegistry()
+	for _, schema := range meta.Schemas {
+		if err := schema.Validate(); err != nil {
+			return fmt.Errorf("schema of %s: %w", schema.Label, err)
+		}
+		schemas.Register(schema)
+	}
+	constraints := types.NewConstraintRegistry()
+	for _, c := range meta.Constraints {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+		if err := violations(ge.storage, c); err != nil {
+			return err
+		}
+		constraints.Register(c)
+	}
+
+	// Drop the indexes this load created if it cannot create them all
+	var created []types.PropertyIndex
+	for _, def := range metadataIndexes(meta) {
+		if slices.Contains(ge.storage.ListIndexes(), def) {
+			continue
+		}
+		if err := ge.storage.CreateIndex(def.Label, def.Property); err != nil {
+			for _, c := range created {
+				_ = ge.storage.DropIndex(c.Label, c.Property)
+			}
+			return err
+		}
+		created = append(created, def)
+	}
+
+	ge.verbs, ge.schemas, ge.constraints = verbs, schemas, constraints
+	ge.defaultSubgraph = meta.DefaultSubgraph
+	ge.syncMetadata()
+	return nil
+}
+
+// adoptMetadata registers the definitions the storage already holds, as
+// they were checked when they were made
+func (ge *GraphEngine) adoptMetadata() {
+	meta := ge.storage.Metadata()
+	for name, verb := range meta.Verbs {
+		ge.verbs.Register(name, verb)
+	}
+	for _, schema := range meta.Schemas {
+		ge.schemas.Register(schema)
+	}
+	for _, c := range meta.Constraints {
+		ge.constraints.Register(c)
+	}
+	ge.defaultSubgraph = meta.DefaultSubgraph
+
+	// A storage may keep its metadata but not its indexes
+	for _, def := range metadataIndexes(meta) {
+		if err := ge.ensureIndex(def.Label, def.Property); err != nil {
+			ge.logger.Warn(err.Error(), "label", def.Label, "property", def.Property)
+		}
+	}
+}
+
+// metadataIndexes lists the indexes the definitions look values up in,
+// sorted and without repeats
+func metadataIndexes(meta types.Metadata) []types.PropertyIndex {
+	var indexes []types.PropertyIndex
+	for _, schema := range meta.Schemas {
+		for _, p := range schema.Properties {
+			if p.Unique {
+				indexes = append(indexes, types.PropertyIndex{Label: schema.Label, Property: p.Name})
+			}
+		}
+	}
+	for _, c := range meta.Constraints {
+		if c.Distinct() {
+			indexes = append(indexes, types.PropertyIndex{Label: c.Label, Property: c.Properties[0]})
+		}
+	}
+	slices.SortFunc(indexes, func(a, b types.PropertyIndex) int {
+		return cmp.Or(cmp.Compare(a.Label, b.Label), cmp.Compare(a.Property, b.Property))
+	})
+	return slices.Compact(indexes)
+}
+
+// syncMetadata writes the engine's definitions to the storage
+func (ge *GraphEngine) syncMetadata() {
+	ge.storage.SetMetadata(types.Metadata{
+		Verbs:           ge.verbs.All(),
+		Schemas:         ge.schemas.All(),
+		Constraints:     ge.constraints.All(),
+		DefaultSubgraph: ge.defaultSubgraph,
+	})
+}
@@ -0,0 +1,138 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// Label schemas are enforced on the writes made through the engine and
+// through transactions begun on it. A node must match the schema of each
+// of its labels, and then its constraints (see constraint.go).
+
+// DefineLabel registers or replaces the schema of a label, indexing its
+// unique properties. Existing nodes are not checked.
+func (ge *GraphEngine) DefineLabel(schema types.LabelSchema) error {
+	if err := schema.Validate(); err != nil {
+		return err
+	}
+	ge.schemas.Register(schema)
+	ge.syncMetadata()
+	for _, p := range schema.Properties {
+		if p.Unique {
+			if err := ge.ensureIndex(schema.Label, p.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Schemas returns the schema registry (for introspection)
+func (ge *GraphEngine) Schemas() *types.SchemaRegistry {
+	return ge.schemas
+}
+
+// newNodeProps checks the props of a node about to be created with id
+// (empty if generated), and fills in defaults
+func (ge *GraphEngine) newNodeProps(r storage.Reader, id string, labels []string, props map[string]any) (map[string]any, error) {
+	return ge.checkProps(r, id, labels, props, true)
+}
+
+// updatedProps checks the props replacing those of a node
+func (ge *GraphEngine) updatedProps(r storage.Reader, id string, props map[string]any) (map[string]any, error) {
+	n, ok := r.GetNode(id)
+	if !ok {
+		return props, nil // let the storage report it
+	}
+	return ge.checkProps(r, id, n.Labels, props, false)
+}
+
+// patchedProps checks a patch of a node's props and returns the values to
+// set, converted to their declared types
+func (ge *GraphEngine) patchedProps(r storage.Reader, id string, set map[string]any, unset []string) (map[string]any, error) {
+	n, ok := r.GetNode(id)
+	if !ok {
+		return set, nil
+	}
+
+	merged := make(map[string]any, len(n.Props)+len(set))
+	for k, v := range n.Props {
+		if !slices.Contains(unset, k) {
+			merged[k] = v
+		}
+	}
+	for k, v := range set {
+		merged[k] = v
+	}
+
+	checked, err := ge.checkProps(r, id, n.Labels, merged, false)
+	if err != nil {
+		return nil, err
+	}
+	typed := make(map[string]any, len(set))
+	for k := range set {
+		typed[k] = checked[k]
+	}
+	return typed, nil
+}
+
+// checkLabels checks that a node's props, unchanged, match the schemas of
+// the labels it is about to have
+func (ge *GraphEngine) checkLabels(r storage.Reader, id string, labels []string) error {
+	n, ok := r.GetNode(id)
+	if !ok {
+		return nil
+	}
+
+	checked, err := ge.checkProps(r, id, labels, n.Props, false)
+	if err != nil {
+		return err
+	}
+	for k, v := range checked {
+		if n.Props[k] != v {
+			return fmt.Errorf("node %s: %s is %T %#v, not of its declared type", id, k, n.Props[k], n.Props[k])
+		}
+	}
+	return nil
+}
+
+func (ge *GraphEngine) checkProps(r storage.Reader, id string, labels []string, props map[string]any, create bool) (map[string]any, error) {
+	for _, label := range labels {
+		schema, ok := ge.schemas.Lookup(label)
+		if !ok {
+			continue
+		}
+
+		var err error
+		if props, err = schema.Check(props, create); err != nil {
+			return nil, err
+		}
+		if err := checkUnique(r, id, schema, props); err != nil {
+			return nil, err
+		}
+	}
+	if err := ge.checkConstraints(r, id, labels, props); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// checkUnique fails if another node of the label has the value of one of
+// the schema's unique properties
+func checkUnique(r storage.Reader, id string, schema types.LabelSchema, props map[string]any) error {
+	for _, p := range schema.Properties {
+		v, set := props[p.Name]
+		if !p.Unique || !set {
+			continue
+		}
+		for _, n := range r.GetNodesByProp(schema.Label, p.Name, v) {
+			if n.ID != id {
+				return fmt.Errorf("%s.%s must be unique: %#v is used by %s", schema.Label, p.Name, v, n.ID)
+			}
+		}
+	}
+	return nil
+}
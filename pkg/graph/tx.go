@@ -0,0 +1,120 @@
+package graph
+
+import (
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+)
+
+var _ storage.Tx = (*engineTx)(nil)
+
+// engineTx is a transaction begun on the engine: writes are checked
+// against the label schemas, constraints and verbs, and views are
+// refreshed once it commits
+type engineTx struct {
+	storage.Tx
+	ge *GraphEngine
+}
+
+func (tx *engineTx) AddNode(label string, props map[string]any) (string, error) {
+	props, err := tx.ge.newNodeProps(tx.Tx, "", []string{label}, props)
+	if err != nil {
+		return "", err
+	}
+	return tx.Tx.AddNode(label, props)
+}
+
+func (tx *engineTx) AddNodeWithID(id, label string, props map[string]any) error {
+	props, err := tx.ge.newNodeProps(tx.Tx, id, []string{label}, props)
+	if err != nil {
+		return err
+	}
+	return tx.Tx.AddNodeWithID(id, label, props)
+}
+
+func (tx *engineTx) UpdateNode(id string, props map[string]any) error {
+	props, err := tx.ge.updatedProps(tx.Tx, id, props)
+	if err != nil {
+		return err
+	}
+	return tx.Tx.UpdateNode(id, props)
+}
+
+func (tx *engineTx) PatchNode(id string, set map[string]any, unset []string) error {
+	set, err := tx.ge.patchedProps(tx.Tx, id, set, unset)
+	if err != nil {
+		return err
+	}
+	return tx.Tx.PatchNode(id, set, unset)
+}
+
+func (tx *engineTx) SetLabel(id, label string) error {
+	if err := tx.ge.checkLabels(tx.Tx, id, []string{label}); err != nil {
+		return err
+	}
+	return tx.Tx.SetLabel(id, label)
+}
+
+func (tx *engineTx) AddLabel(id, label string) error {
+	if err := tx.ge.checkLabels(tx.Tx, id, []string{label}); err != nil {
+		return err
+	}
+	return tx.Tx.AddLabel(id, label)
+}
+
+// AddEdge merges edges of a Unique verb into the existing one, like
+// GraphEngine.AddEdge
+func (tx *engineTx) AddEdge(from, to, kind string, props map[string]any) (string, error) {
+	from, to, kind = tx.ge.edgeKind(from, to, kind)
+	add := tx.Tx.AddEdge
+	v, ok := tx.ge.verbs.Lookup(kind)
+	if ok && v.Unique {
+		add = tx.Tx.MergeEdge
+	}
+	if err := tx.ge.checkEdge(tx.Tx, from, to, kind, props, ok && v.Unique); err != nil {
+		return "", err
+	}
+	return add(from, to, kind, props)
+}
+
+func (tx *engineTx) AddEdgeWithID(id, from, to, kind string, props map[string]any) error {
+	from, to, kind = tx.ge.edgeKind(from, to, kind)
+	if err := tx.ge.checkEdge(tx.Tx, from, to, kind, props, false); err != nil {
+		return err
+	}
+	return tx.Tx.AddEdgeWithID(id, from, to, kind, props)
+}
+
+func (tx *engineTx) MergeEdge(from, to, kind string, props map[string]any) (string, error) {
+	from, to, kind = tx.ge.edgeKind(from, to, kind)
+	if err := tx.ge.checkEdge(tx.Tx, from, to, kind, props, true); err != nil {
+		return "", err
+	}
+	return tx.Tx.MergeEdge(from, to, kind, props)
+}
+
+func (tx *engineTx) UpdateEdge(id string, props map[string]any) error {
+	if err := tx.ge.checkEdgeUpdate(tx.Tx, id, props); err != nil {
+		return err
+	}
+	return tx.Tx.UpdateEdge(id, props)
+}
+
+func (tx *engineTx) PatchEdge(id string, set map[string]any, unset []string) error {
+	if err := tx.ge.checkEdgeUpdate(tx.Tx, id, set); err != nil {
+		return err
+	}
+	return tx.Tx.PatchEdge(id, set, unset)
+}
+
+func (tx *engineTx) DeleteEdge(from, to, kind string) error {
+	from, to, kind = tx.ge.edgeKind(from, to, kind)
+	return tx.Tx.DeleteEdge(from, to, kind)
+}
+
+func (tx *engineTx) Commit() error {
+	if err := tx.Tx.Commit(); err != nil {
+		return err
+	}
+	// Best effort, like refreshNodes: the writes are committed either way
+	_ = tx.ge.RefreshViews()
+	return nil
+}
@@ -0,0 +1,92 @@
+package graph
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// EdgeViolation is a stored edge that breaks its verb's definition, or
+// whose kind is not a registered verb
+type EdgeViolation struct {
+	EdgeID string
+	Kind   string
+	Reason string
+}
+
+func (v EdgeViolation) String() string {
+	return v.EdgeID + ": " + v.Reason
+}
+
+// ValidateEdges checks every stored edge against the verb registry,
+// whatever the verb mode, and returns the violations in edge ID order.
+// Of the edges breaking a cardinality, the first one counts as valid.
+func (ge *GraphEngine) ValidateEdges() []EdgeViolation {
+	snap := ge.storage.Snapshot()
+	defer snap.Release()
+
+	edges := snap.GetAllEdges()
+	slices.SortFunc(edges, func(a, b *types.Edge) int {
+		return cmp.Or(cmp.Compare(len(a.ID), len(b.ID)), strings.Compare(a.ID, b.ID))
+	})
+
+	var list []EdgeViolation
+	report := func(e *types.Edge, err error) {
+		if err != nil {
+			list = append(list, EdgeViolation{EdgeID: e.ID, Kind: e.Kind, Reason: err.Error()})
+		}
+	}
+	// The first edge of a kind counted at a node end, or between two nodes
+	first := map[string]*types.Edge{}
+	counted := func(e *types.Edge, key string) *types.Edge {
+		key = e.Kind + "\x00" + key
+		if prev, ok := first[key]; ok {
+			return prev
+		}
+		first[key] = e
+		return nil
+	}
+
+	for _, e := range edges {
+		v, ok := ge.verbs.Lookup(e.Kind)
+		report(e, targetError(snap, e.To, e.Kind, v, ok))
+		if !ok {
+			continue
+		}
+		report(e, sourceError(snap, e.From, e.Kind, v))
+		report(e, checkEdgeProps(e.Kind, v, e.Props))
+
+		c := v.Cardinality
+		var ends []string
+		switch {
+		case v.Symmetric && c.OneOut():
+			ends = []string{e.From, e.To}
+		case !v.Symmetric:
+			if c.OneOut() {
+				ends = append(ends, "out\x00"+e.From)
+			}
+			if c.OneIn() {
+				ends = append(ends, "in\x00"+e.To)
+			}
+		}
+		for _, end := range ends {
+			if prev := counted(e, end); prev != nil {
+				id := end[strings.LastIndexByte(end, 0)+1:]
+				report(e, fmt.Errorf("%s is %s: %s already has edge %s", e.Kind, c, id, prev.ID))
+			}
+		}
+		if v.Unique {
+			pair := []string{e.From, e.To}
+			if v.Symmetric {
+				slices.Sort(pair)
+			}
+			if prev := counted(e, "pair\x00"+strings.Join(pair, "\x00")); prev != nil {
+				report(e, fmt.Errorf("%s is unique: edge %s already joins %s and %s", e.Kind, prev.ID, e.From, e.To))
+			}
+		}
+	}
+	return list
+}
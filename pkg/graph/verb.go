@@ -0,0 +1,218 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// Edges of a registered verb are checked on the writes made through the
+// engine and its transactions: the source label, the cardinality and the
+// allowed edge properties. An edge added under the inverse name of a
+// verb is stored as the verb, reversed. Edges of unregistered kinds and
+// edges ending at a node without the verb's TargetLabel are only checked
+// in the lenient and strict verb modes.
+
+// VerbMode sets how AddEdge treats edges the verb registry does not
+// describe
+type VerbMode string
+
+const (
+	// VerbsOff accepts them (the default)
+	VerbsOff VerbMode = "off"
+	// VerbsLenient accepts them with a warning
+	VerbsLenient VerbMode = "lenient"
+	// VerbsStrict rejects them
+	VerbsStrict VerbMode = "strict"
+)
+
+// ParseVerbMode accepts "off", "lenient" or "strict"; empty means off
+func ParseVerbMode(s string) (VerbMode, error) {
+	switch m := VerbMode(strings.ToLower(s)); m {
+	case "":
+		return VerbsOff, nil
+	case VerbsOff, VerbsLenient, VerbsStrict:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown verb mode %q (want off, lenient or strict)", s)
+}
+
+// WithVerbMode sets how edges of unregistered kinds, or ending at a node
+// without the verb's TargetLabel, are treated
+func (ge *GraphEngine) WithVerbMode(mode VerbMode) *GraphEngine {
+	ge.verbMode = mode
+	return ge
+}
+
+// VerbMode returns the engine's verb mode
+func (ge *GraphEngine) VerbMode() VerbMode {
+	if ge.verbMode == "" {
+		return VerbsOff
+	}
+	return ge.verbMode
+}
+
+// DefineVerb checks a verb definition and registers it. Unlike
+// RegisterVerb, it fails if the name or inverse clashes with another verb.
+func (ge *GraphEngine) DefineVerb(name string, def types.Verb) error {
+	if def.Cardinality != "" {
+		c, err := types.ParseCardinality(string(def.Cardinality))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		def.Cardinality = c
+	}
+	if err := def.Validate(name); err != nil {
+		return err
+	}
+
+	for other, v := range ge.verbs.All() {
+		if other == name {
+			continue
+		}
+		switch {
+		case v.Inverse == name:
+			return fmt.Errorf("%s is already the inverse of %s", name, other)
+		case def.Inverse != "" && def.Inverse == other:
+			return fmt.Errorf("inverse %s is already a verb", def.Inverse)
+		case def.Inverse != "" && def.Inverse == v.Inverse:
+			return fmt.Errorf("%s is already the inverse of %s", def.Inverse, other)
+		}
+	}
+	ge.RegisterVerb(name, def)
+	return nil
+}
+
+// edgeKind turns an edge given under a verb's inverse name into the
+// verb's own edge
+func (ge *GraphEngine) edgeKind(from, to, kind string) (string, string, string) {
+	if verb, _, inverse, ok := ge.verbs.Resolve(kind); ok && inverse {
+		return to, from, verb
+	}
+	return from, to, kind
+}
+
+// checkEdge checks a new edge against its verb, if registered. merge is
+// set when the edge replaces an existing one between the same nodes.
+func (ge *GraphEngine) checkEdge(r storage.Reader, from, to, kind string, props map[string]any, merge bool) error {
+	v, ok := ge.verbs.Lookup(kind)
+	if err := ge.checkRegistered(r, to, kind, v, ok); err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	if err := checkEdgeProps(kind, v, props); err != nil {
+		return err
+	}
+	if err := sourceError(r, from, kind, v); err != nil {
+		return err
+	}
+	return checkCardinality(r, kind, v, from, to, merge)
+}
+
+// checkRegistered applies the verb mode to an edge of an unregistered kind
+// or one ending at a node without the verb's TargetLabel
+func (ge *GraphEngine) checkRegistered(r storage.Reader, to, kind string, v types.Verb, ok bool) error {
+	mode := ge.VerbMode()
+	if mode == VerbsOff {
+		return nil
+	}
+	err := targetError(r, to, kind, v, ok)
+	if err == nil {
+		return nil
+	}
+	if mode == VerbsStrict {
+		return err
+	}
+	ge.logger.Warn(err.Error(), "kind", kind, "to", to)
+	return nil
+}
+
+func sourceError(r storage.Reader, from, kind string, v types.Verb) error {
+	if v.SourceLabel == "" {
+		return nil
+	}
+	if n, ok := r.GetNode(from); ok && !n.HasLabel(v.SourceLabel) {
+		return fmt.Errorf("%s edges must start at a %s node; %s is %s", kind, v.SourceLabel, from, n.LabelString())
+	}
+	return nil
+}
+
+func targetError(r storage.Reader, to, kind string, v types.Verb, ok bool) error {
+	if !ok {
+		return fmt.Errorf("%s is not a registered verb", kind)
+	}
+	if v.TargetLabel == "" {
+		return nil
+	}
+	if n, ok := r.GetNode(to); ok && !n.HasLabel(v.TargetLabel) {
+		return fmt.Errorf("%s edges must end at a %s node; %s is %s", kind, v.TargetLabel, to, n.LabelString())
+	}
+	return nil
+}
+
+// checkEdgeUpdate checks the props an existing edge is about to get
+func (ge *GraphEngine) checkEdgeUpdate(r storage.Reader, id string, props map[string]any) error {
+	e, ok := r.GetEdge(id)
+	if !ok {
+		return nil // let the storage report it
+	}
+	if v, ok := ge.verbs.Lookup(e.Kind); ok {
+		return checkEdgeProps(e.Kind, v, props)
+	}
+	return nil
+}
+
+func checkEdgeProps(kind string, v types.Verb, props map[string]any) error {
+	for key := range props {
+		switch {
+		case v.AllowsEdgeProp(key):
+		case len(v.EdgeProps) == 0:
+			return fmt.Errorf("%s edges cannot have properties; got %q", kind, key)
+		default:
+			return fmt.Errorf("%s edges cannot have property %q (allowed: %s)", kind, key, strings.Join(v.EdgeProps, ", "))
+		}
+	}
+	return nil
+}
+
+func checkCardinality(r storage.Reader, kind string, v types.Verb, from, to string, merge bool) error {
+	c := v.Cardinality
+	// Only the edge a merge replaces may already be there
+	other := func(edges []*types.Edge) *types.Edge {
+		for _, e := range edges {
+			if e.Kind == kind && !(merge && e.From == from && e.To == to) {
+				return e
+			}
+		}
+		return nil
+	}
+
+	if v.Symmetric {
+		// Either end could be the source, so both count all their edges
+		if !c.OneOut() {
+			return nil
+		}
+		for _, id := range []string{from, to} {
+			if e := other(append(r.GetEdgesFrom(id), r.GetEdgesTo(id)...)); e != nil {
+				return fmt.Errorf("%s is %s: %s already has edge %s", kind, c, id, e.ID)
+			}
+		}
+		return nil
+	}
+
+	if c.OneOut() {
+		if e := other(r.GetEdgesFrom(from)); e != nil {
+			return fmt.Errorf("%s is %s: %s already has edge %s", kind, c, from, e.ID)
+		}
+	}
+	if c.OneIn() {
+		if e := other(r.GetEdgesTo(to)); e != nil {
+			return fmt.Errorf("%s is %s: %s already has edge %s", kind, c, to, e.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/aprksy/knitknot/pkg/dsl"
+	"github.com/aprksy/knitknot/pkg/ports/query"
+)
+
+// Views are subgraphs whose members are the results of a DSL query. The
+// storage keeps the query with the subgraph; the engine keeps the members
+// up to date. A write made through the engine re-evaluates the views for
+// the nodes it touched (both ends of an edge) and their neighbours either
+// way, as a query follows edges from its first node in either direction
+// for inverse and symmetric verbs. A committed transaction re-evaluates
+// the views in full. Writes made on the storage directly are
+// not seen until RefreshViews.
+
+// CreateView defines a view and fills it
+func (ge *GraphEngine) CreateView(name, queryText string) error {
+	plan, err := ge.viewPlan(queryText)
+	if err != nil {
+		return err
+	}
+	if err := ge.storage.CreateView(name, queryText); err != nil {
+		return err
+	}
+	if err := ge.refreshView(name, plan); err != nil {
+		_ = ge.storage.DropSubgraph(name)
+		return err
+	}
+	return nil
+}
+
+// RefreshViews re-evaluates every view over the whole graph
+func (ge *GraphEngine) RefreshViews() error {
+	for _, sg := range ge.storage.ListSubgraphs() {
+		if !sg.IsView() {
+			continue
+		}
+		plan, err := ge.viewPlan(sg.Query)
+		if err != nil {
+			return fmt.Errorf("view %s: %w", sg.Name, err)
+		}
+		if err := ge.refreshView(sg.Name, plan); err != nil {
+			return fmt.Errorf("view %s: %w", sg.Name, err)
+		}
+	}
+	return nil
+}
+
+// viewPlan compiles the query of a view. Unlike other queries it does not
+// run in the engine's default subgraph.
+func (ge *GraphEngine) viewPlan(queryText string) (*query.QueryPlan, error) {
+	ast, err := dsl.NewParser(queryText).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("parse error: %w", err)
+	}
+	b, err := ge.Compile(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := b.plan
+	if !slices.ContainsFunc(ast.Methods, func(m *dsl.MethodCall) bool { return m.Name.Value == "In" }) {
+		plan.Subgraph = ""
+	}
+	if plan.LimitVal != nil {
+		return nil, fmt.Errorf("a view cannot use Limit")
+	}
+	if plan.Subgraph != "" && ge.isView(plan.Subgraph) {
+		return nil, fmt.Errorf("a view cannot be defined on view %s", plan.Subgraph)
+	}
+	return plan, nil
+}
+
+// refreshView sets the members of a view to the results of its query
+func (ge *GraphEngine) refreshView(name string, plan *query.QueryPlan) error {
+	result, err := ge.query.Execute(context.Background(), ge.storage, plan)
+	if err != nil {
+		return err
+	}
+
+	first := plan.Nodes[0].Var
+	want := make(map[string]bool)
+	for _, row := range result.Items() {
+		want[row[first].ID] = true
+	}
+
+	var add, remove []string
+	for _, n := range ge.storage.GetNodesIn(name) {
+		if !want[n.ID] {
+			remove = append(remove, n.ID)
+		}
+		delete(want, n.ID)
+	}
+	for id := range want {
+		add = append(add, id)
+	}
+	return ge.setMembers(name, add, remove)
+}
+
+// refreshNodes re-evaluates the views for some nodes and the nodes joined
+// to them by an edge either way. It is best effort: nodes deleted meanwhile are skipped.
+func (ge *GraphEngine) refreshNodes(ids ...string) {
+	var views []string
+	var plans []*query.QueryPlan
+	for _, sg := range ge.storage.ListSubgraphs() {
+		if !sg.IsView() {
+			continue
+		}
+		plan, err := ge.viewPlan(sg.Query)
+		if err != nil {
+			continue
+		}
+		views = append(views, sg.Name)
+		plans = append(plans, plan)
+	}
+	if len(views) == 0 {
+		return
+	}
+
+	affected := make(map[string]bool)
+	for _, id := range ids {
+		affected[id] = true
+		for _, n := range ge.neighbours(id) {
+			affected[n] = true
+		}
+	}
+
+	for i, name := range views {
+		var add, remove []string
+		for id := range affected {
+			n, ok := ge.storage.GetNode(id)
+			if !ok {
+				continue
+			}
+			member, err := ge.matches(plans[i], id)
+			switch {
+			case err != nil:
+				continue
+			case member && !n.InSubgraph(name):
+				add = append(add, id)
+			case !member && n.InSubgraph(name):
+				remove = append(remove, id)
+			}
+		}
+		_ = ge.setMembers(name, add, remove)
+	}
+}
+
+// matches reports whether a node is among the results of a plan, running
+// the plan for that node only
+func (ge *GraphEngine) matches(plan *query.QueryPlan, id string) (bool, error) {
+	one := *plan
+	one.Filters = append(slices.Clone(plan.Filters), query.Filter{Field: plan.Nodes[0].Var, Op: "=", Value: id})
+
+	result, err := ge.query.Execute(context.Background(), ge.storage, &one)
+	if err != nil {
+		return false, err
+	}
+	return result.Len() > 0, nil
+}
+
+func (ge *GraphEngine) setMembers(name string, add, remove []string) error {
+	if len(add) > 0 {
+		if err := ge.storage.AddNodesToSubgraph(name, add); err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		return ge.storage.RemoveNodesFromSubgraph(name, remove)
+	}
+	return nil
+}
+
+func (ge *GraphEngine) isView(name string) bool {
+	for _, sg := range ge.storage.ListSubgraphs() {
+		if sg.Name == name {
+			return sg.IsView()
+		}
+	}
+	return false
+}
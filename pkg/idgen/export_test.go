@@ -0,0 +1,12 @@
+package idgen
+
+import "time"
+
+// NewULIDAt and NewUUIDv7At build generators with a fixed clock
+func NewULIDAt(now func() time.Time) *ULID {
+	return &ULID{now: now}
+}
+
+func NewUUIDv7At(now func() time.Time) *UUIDv7 {
+	return &UUIDv7{now: now}
+}
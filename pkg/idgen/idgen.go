@@ -0,0 +1,201 @@
+// Package idgen provides node ID generators for storage engines
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+)
+
+var (
+	_ storage.IDGenerator      = (*Counter)(nil)
+	_ storage.IDGeneratorState = (*Counter)(nil)
+	_ storage.IDGenerator      = (*ULID)(nil)
+	_ storage.IDGenerator      = (*UUIDv7)(nil)
+)
+
+// Default is the scheme used when none is chosen
+const Default = "counter"
+
+var schemes = map[string]func() storage.IDGenerator{
+	"counter": func() storage.IDGenerator { return NewCounter("n") },
+	"ulid":    func() storage.IDGenerator { return NewULID() },
+	"uuidv7":  func() storage.IDGenerator { return NewUUIDv7() },
+}
+
+// New returns a generator for a scheme name
+func New(scheme string) (storage.IDGenerator, error) {
+	f, ok := schemes[strings.ToLower(scheme)]
+	if !ok {
+		return nil, fmt.Errorf("unknown ID scheme %q (want one of %s)", scheme, strings.Join(Schemes(), ", "))
+	}
+	return f(), nil
+}
+
+// Schemes lists the scheme names New accepts
+func Schemes() []string {
+	names := make([]string, 0, len(schemes))
+	for name := range schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Counter generates prefix1, prefix2, ... Its state is the last number
+// handed out.
+type Counter struct {
+	mu     sync.Mutex
+	prefix string
+	n      uint64
+}
+
+func NewCounter(prefix string) *Counter {
+	return &Counter{prefix: prefix}
+}
+
+func (c *Counter) Scheme() string { return "counter" }
+
+func (c *Counter) NewID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+	return c.prefix + strconv.FormatUint(c.n, 10)
+}
+
+func (c *Counter) State() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strconv.FormatUint(c.n, 10)
+}
+
+func (c *Counter) Restore(state string) error {
+	n, err := strconv.ParseUint(state, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid counter state %q", state)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n = n
+	return nil
+}
+
+// ULID generates 26-character ULIDs (https://github.com/ulid/spec): a
+// millisecond timestamp and 80 random bits, in Crockford base32. IDs made
+// in the same millisecond increment the random part, so they sort in
+// creation order.
+type ULID struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	lastMs  uint64
+	entropy [10]byte
+}
+
+func NewULID() *ULID {
+	return &ULID{now: time.Now}
+}
+
+func (g *ULID) Scheme() string { return "ulid" }
+
+func (g *ULID) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(g.now().UnixMilli())
+	if ms > g.lastMs {
+		g.lastMs = ms
+		randomBytes(g.entropy[:])
+	} else {
+		increment(g.entropy[:])
+	}
+
+	var b [16]byte
+	b[0] = byte(g.lastMs >> 40)
+	b[1] = byte(g.lastMs >> 32)
+	binary.BigEndian.PutUint32(b[2:], uint32(g.lastMs))
+	copy(b[6:], g.entropy[:])
+	return crockford(b)
+}
+
+// UUIDv7 generates RFC 9562 version 7 UUIDs: a millisecond timestamp,
+// a 12-bit counter for IDs made in the same millisecond, and random bits.
+type UUIDv7 struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	lastMs uint64
+	seq    uint16
+}
+
+func NewUUIDv7() *UUIDv7 {
+	return &UUIDv7{now: time.Now}
+}
+
+func (g *UUIDv7) Scheme() string { return "uuidv7" }
+
+func (g *UUIDv7) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(g.now().UnixMilli())
+	if ms > g.lastMs {
+		g.lastMs = ms
+		g.seq = 0
+	} else if g.seq++; g.seq > 0xfff {
+		// Counter exhausted: borrow the next millisecond
+		g.lastMs++
+		g.seq = 0
+	}
+
+	var b [16]byte
+	randomBytes(b[8:])
+	b[0] = byte(g.lastMs >> 40)
+	b[1] = byte(g.lastMs >> 32)
+	binary.BigEndian.PutUint32(b[2:], uint32(g.lastMs))
+	b[6] = 0x70 | byte(g.seq>>8) // version 7
+	b[7] = byte(g.seq)
+	b[8] = 0x80 | b[8]&0x3f // RFC 9562 variant
+
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("idgen: reading random bytes: %v", err))
+	}
+}
+
+// increment adds one to a big-endian number
+func increment(b []byte) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return
+		}
+	}
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// crockford encodes 128 bits as 26 base32 characters, most significant
+// first (the first character carries only 3 bits)
+func crockford(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
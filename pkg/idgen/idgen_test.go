@@ -0,0 +1,74 @@
+package idgen_test
+
+import (
+	"sort"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aprksy/knitknot/pkg/idgen"
+)
+
+var _ = Describe("ID generators", func() {
+	frozen := func() time.Time { return time.UnixMilli(1760000000000) }
+
+	Describe("New", func() {
+		It("should build every listed scheme", func() {
+			for _, scheme := range idgen.Schemes() {
+				g, err := idgen.New(scheme)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(g.Scheme()).To(Equal(scheme))
+			}
+		})
+
+		It("should reject an unknown scheme", func() {
+			_, err := idgen.New("random")
+			Expect(err).To(MatchError(ContainSubstring("unknown ID scheme")))
+		})
+	})
+
+	Describe("Counter", func() {
+		It("should count up from its restored state", func() {
+			c := idgen.NewCounter("n")
+			Expect(c.NewID()).To(Equal("n1"))
+			Expect(c.NewID()).To(Equal("n2"))
+			Expect(c.State()).To(Equal("2"))
+
+			restored := idgen.NewCounter("n")
+			Expect(restored.Restore(c.State())).To(Succeed())
+			Expect(restored.NewID()).To(Equal("n3"))
+		})
+
+		It("should reject a malformed state", func() {
+			Expect(idgen.NewCounter("n").Restore("x")).NotTo(Succeed())
+		})
+	})
+
+	Describe("ULID", func() {
+		It("should make sortable, unique IDs within one millisecond", func() {
+			g := idgen.NewULIDAt(frozen)
+			ids := make([]string, 1000)
+			for i := range ids {
+				ids[i] = g.NewID()
+				Expect(ids[i]).To(MatchRegexp(`^[0-9A-HJKMNP-TV-Z]{26}$`))
+			}
+			Expect(sort.StringsAreSorted(ids)).To(BeTrue())
+			Expect(ids[0]).NotTo(Equal(ids[1]))
+			Expect(ids[0][:10]).To(Equal("01K742SG00")) // timestamp part
+		})
+	})
+
+	Describe("UUIDv7", func() {
+		It("should make sortable version 7 UUIDs", func() {
+			g := idgen.NewUUIDv7At(frozen)
+			ids := make([]string, 5000)
+			for i := range ids {
+				ids[i] = g.NewID()
+				Expect(ids[i]).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+			}
+			Expect(sort.StringsAreSorted(ids)).To(BeTrue())
+			Expect(ids[0][:13]).To(Equal("0199c82c-c000"))
+		})
+	})
+})
@@ -0,0 +1,509 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/aprksy/knitknot/pkg/dsl"
+	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+	"github.com/aprksy/knitknot/pkg/script"
+)
+
+// operators offered as the second argument of Where/WhereEdge and the
+// third of Has
+var operators = []string{"=", "!=", ">", "<", ">=", "<="}
+
+// Diagnose reports syntax errors and unknown methods or verbs in every
+// query statement of the document. REPL commands are not checked.
+func Diagnose(engine *graph.GraphEngine, text string) []Diagnostic {
+	diags := []Diagnostic{}
+
+	stmts, err := script.Parse(text)
+	if err != nil {
+		line := 0
+		var serr *script.SyntaxError
+		if errors.As(err, &serr) {
+			line = serr.Line - 1
+		}
+		return append(diags, Diagnostic{
+			Range:    lineRange(line),
+			Severity: SeverityError,
+			Source:   "knitknot",
+			Message:  err.Error(),
+		})
+	}
+
+	for _, stmt := range stmts {
+		if !isQuery(stmt.Text) {
+			continue
+		}
+
+		if _, err := dsl.NewParser(stmt.Text).Parse(); err != nil {
+			pos := 0
+			var perr *dsl.ParseError
+			if errors.As(err, &perr) {
+				pos = perr.Pos
+			}
+			diags = append(diags, Diagnostic{
+				Range:    tokenRange(text, stmt.SourceOffset(pos)),
+				Severity: SeverityError,
+				Source:   "knitknot",
+				Message:  err.Error(),
+			})
+			continue
+		}
+
+		diags = append(diags, checkNames(engine, text, stmt)...)
+	}
+	return diags
+}
+
+// checkNames flags method names the builder does not know and Has()
+// relations that are not registered verbs
+func checkNames(engine *graph.GraphEngine, text string, stmt script.Statement) []Diagnostic {
+	var diags []Diagnostic
+
+	l := dsl.NewLexer(stmt.Text)
+	prev := dsl.Token{}
+	method := ""
+	arg := -1
+	for tok := l.NextToken(); tok.Type != dsl.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case dsl.LParen:
+			method, arg = prev.Literal, 0
+			if _, ok := dsl.LookupMethod(method); !ok {
+				diags = append(diags, Diagnostic{
+					Range:    spanRange(text, stmt.SourceOffset(prev.PosX), prev.End-prev.PosX),
+					Severity: SeverityError,
+					Source:   "knitknot",
+					Message:  fmt.Sprintf("unknown method: %s", method),
+				})
+			}
+		case dsl.Comma:
+			arg++
+		case dsl.String:
+			if method == "Has" && arg == 0 && engine != nil {
+				if _, _, _, ok := engine.Verbs().Resolve(tok.Literal); !ok {
+					diags = append(diags, Diagnostic{
+						Range:    spanRange(text, stmt.SourceOffset(tok.PosX), tok.End-tok.PosX),
+						Severity: SeverityWarning,
+						Source:   "knitknot",
+						Message:  fmt.Sprintf("verb '%s' is not defined; %s", tok.Literal, undefinedVerb(tok.Literal)),
+					})
+				}
+			}
+		}
+		prev = tok
+	}
+	return diags
+}
+
+// Complete returns completion items for the cursor at offset
+func Complete(engine *graph.GraphEngine, text string, offset int) []CompletionItem {
+	c := scanContext(text, offset)
+	vocab := newVocabulary(engine)
+
+	if !c.inString {
+		if c.afterDot || c.atStart {
+			return methodItems()
+		}
+		return []CompletionItem{}
+	}
+
+	// Replace everything typed so far inside the quotes
+	edit := Range{Start: positionAt(text, c.stringStart), End: positionAt(text, offset)}
+	typed := text[c.stringStart:offset]
+
+	var items []CompletionItem
+	add := func(label string, kind int, detail string) {
+		items = append(items, CompletionItem{
+			Label:    label,
+			Kind:     kind,
+			Detail:   detail,
+			TextEdit: &TextEdit{Range: edit, NewText: label},
+		})
+	}
+
+	switch {
+	case c.method == "Find" && c.arg == 0:
+		for _, label := range vocab.labels {
+			add(label, KindClass, "label")
+		}
+	case c.method == "Has" && c.arg == 0:
+		for _, verb := range vocab.verbs {
+			add(verb, KindValue, "verb")
+		}
+	case c.method == "Where" && c.arg == 0:
+		varName := "n"
+		if i := strings.Index(typed, "."); i != -1 {
+			varName = typed[:i]
+		}
+		for _, key := range vocab.nodeProps {
+			add(varName+"."+key, KindProperty, "node property")
+		}
+	case c.method == "WhereEdge" && c.arg == 0:
+		for _, key := range vocab.edgeProps {
+			add(key, KindProperty, "edge property")
+		}
+	case c.method == "In" && c.arg == 0:
+		for _, name := range vocab.subgraphs {
+			add(name, KindModule, "subgraph")
+		}
+	case (c.method == "Where" || c.method == "WhereEdge") && c.arg == 1,
+		c.method == "Has" && c.arg == 2:
+		for _, op := range operators {
+			add(op, KindOperator, "operator")
+		}
+	}
+
+	if items == nil {
+		items = []CompletionItem{}
+	}
+	return items
+}
+
+// Candidates returns the plain words that may replace text[start:offset],
+// for clients without LSP text edits such as the REPL
+func Candidates(engine *graph.GraphEngine, text string, offset int) (start int, words []string) {
+	start = offset
+	for start > 0 && isWordChar(text[start-1]) {
+		start--
+	}
+	if c := scanContext(text, offset); c.inString {
+		start = c.stringStart
+	}
+
+	for _, item := range Complete(engine, text, offset) {
+		words = append(words, item.Label)
+	}
+	return start, words
+}
+
+// HoverAt describes the method, verb or label under the cursor
+func HoverAt(engine *graph.GraphEngine, text string, offset int) *Hover {
+	c := scanContext(text, offset)
+
+	if c.inString {
+		value := stringAt(text, c.stringStart)
+		switch {
+		case c.method == "Has" && c.arg == 0 && engine != nil:
+			kind, verb, inverse, ok := engine.Verbs().Resolve(value)
+			if !ok {
+				return markdown(fmt.Sprintf("**%s** — undefined verb: %s", value, undefinedVerb(value)))
+			}
+			if inverse {
+				source := verb.SourceLabel
+				if source == "" {
+					source = "(any)"
+				}
+				return markdown(describeVerb(value, source, verb.MatchOn) + fmt.Sprintf("\n- inverse of: `%s`", kind))
+			}
+			return markdown(describeVerb(value, verb.TargetLabel, verb.MatchOn))
+		case c.method == "Find" && c.arg == 0 && engine != nil:
+			return markdown(fmt.Sprintf("**%s** — %d node(s)", value, countLabel(engine, value)))
+		}
+		return nil
+	}
+
+	word := wordAt(text, offset)
+	if spec, ok := dsl.LookupMethod(word); ok {
+		return markdown(fmt.Sprintf("```\n%s\n```\n%s", spec.Signature, spec.Doc))
+	}
+	return nil
+}
+
+// undefinedVerb says how Has() treats an edge kind with no verb
+func undefinedVerb(kind string) string {
+	return fmt.Sprintf("Has follows '%s' edges to %s nodes and compares their %s",
+		kind, types.DefaultTargetLabel, types.DefaultMatchProperty)
+}
+
+func describeVerb(name, target, matchOn string) string {
+	if target == "" {
+		target = types.DefaultTargetLabel
+	}
+	if matchOn == "" {
+		matchOn = "name (default)"
+	}
+	return fmt.Sprintf("**%s** (verb)\n\n- target label: `%s`\n- matched on: `%s`", name, target, matchOn)
+}
+
+func markdown(s string) *Hover {
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: s}}
+}
+
+func methodItems() []CompletionItem {
+	items := make([]CompletionItem, 0, len(dsl.Methods))
+	for _, m := range dsl.Methods {
+		items = append(items, CompletionItem{
+			Label:         m.Name,
+			Kind:          KindMethod,
+			Detail:        m.Signature,
+			Documentation: m.Doc,
+		})
+	}
+	return items
+}
+
+func countLabel(engine *graph.GraphEngine, label string) int {
+	n := 0
+	for _, node := range engine.Storage().GetAllNodes() {
+		if node.HasLabel(label) {
+			n++
+		}
+	}
+	return n
+}
+
+// vocabulary is the set of names the loaded graph knows about
+type vocabulary struct {
+	labels    []string
+	verbs     []string
+	nodeProps []string
+	edgeProps []string
+	subgraphs []string
+}
+
+func newVocabulary(engine *graph.GraphEngine) *vocabulary {
+	v := &vocabulary{}
+	if engine == nil {
+		return v
+	}
+
+	labels := map[string]bool{}
+	nodeProps := map[string]bool{}
+	for _, n := range engine.Storage().GetAllNodes() {
+		for _, l := range n.Labels {
+			labels[l] = true
+		}
+		for k := range n.Props {
+			nodeProps[k] = true
+		}
+	}
+
+	verbs := map[string]bool{}
+	for name, verb := range engine.Verbs().All() {
+		verbs[name] = true
+		if verb.Inverse != "" {
+			verbs[verb.Inverse] = true
+		}
+	}
+	edgeProps := map[string]bool{}
+	for _, e := range engine.Storage().GetAllEdges() {
+		verbs[e.Kind] = true
+		for k := range e.Props {
+			edgeProps[k] = true
+		}
+	}
+
+	v.labels = sortedKeys(labels)
+	v.verbs = sortedKeys(verbs)
+	v.nodeProps = sortedKeys(nodeProps)
+	v.edgeProps = sortedKeys(edgeProps)
+	for _, sg := range engine.ListSubgraphs() {
+		v.subgraphs = append(v.subgraphs, sg.Name)
+	}
+	return v
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cursorContext is what the text before the cursor tells us
+type cursorContext struct {
+	inString    bool
+	stringStart int    // offset just after the opening quote
+	method      string // innermost method whose parens enclose the cursor
+	arg         int    // argument index within that method
+	afterDot    bool   // cursor follows '.' (plus a partial method name)
+	atStart     bool   // cursor is on the first word of a statement
+}
+
+func scanContext(text string, offset int) cursorContext {
+	if offset > len(text) {
+		offset = len(text)
+	}
+
+	type frame struct {
+		method string
+		arg    int
+	}
+	var (
+		c         cursorContext
+		stack     []frame
+		word      strings.Builder
+		wordDone  bool
+		stmtStart int
+	)
+
+	for i := 0; i < offset; i++ {
+		ch := text[i]
+		if c.inString {
+			switch ch {
+			case '\\':
+				i++
+			case '\'':
+				c.inString = false
+			}
+			continue
+		}
+
+		switch {
+		case ch == '\'':
+			c.inString = true
+			c.stringStart = i + 1
+		case ch == '(':
+			stack = append(stack, frame{method: word.String()})
+		case ch == ')':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ch == ',':
+			if len(stack) > 0 {
+				stack[len(stack)-1].arg++
+			}
+		case ch == ';' || ch == '\n' && len(stack) == 0 && !continuesChain(text[i+1:]):
+			stack = stack[:0]
+			stmtStart = i + 1
+		}
+
+		// Keep the last word across blanks so "Find (" still names Find
+		switch {
+		case isWordChar(ch):
+			if wordDone {
+				word.Reset()
+				wordDone = false
+			}
+			word.WriteByte(ch)
+		case ch == ' ' || ch == '\t':
+			wordDone = true
+		default:
+			word.Reset()
+			wordDone = false
+		}
+	}
+
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		c.method, c.arg = top.method, top.arg
+	}
+	if !c.inString && len(stack) == 0 {
+		// Look behind the partial word being typed
+		before := strings.TrimRight(text[stmtStart:offset], "_abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+		before = strings.TrimRight(before, " \t\r\n")
+		c.afterDot = strings.HasSuffix(before, ".")
+		c.atStart = before == ""
+	}
+	return c
+}
+
+// continuesChain reports whether the next non-blank line starts with '.'
+func continuesChain(rest string) bool {
+	return strings.HasPrefix(strings.TrimLeft(rest, " \t\r\n"), ".")
+}
+
+func isWordChar(ch byte) bool {
+	return ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9'
+}
+
+func isQuery(stmt string) bool {
+	i := 0
+	for i < len(stmt) && isWordChar(stmt[i]) {
+		i++
+	}
+	return i > 0 && strings.HasPrefix(strings.TrimLeft(stmt[i:], " \t"), "(")
+}
+
+// stringAt returns the unescaped contents of the string starting at start
+func stringAt(text string, start int) string {
+	var sb strings.Builder
+	for i := start; i < len(text) && text[i] != '\'' && text[i] != '\n'; i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			i++
+		}
+		sb.WriteByte(text[i])
+	}
+	return sb.String()
+}
+
+func wordAt(text string, offset int) string {
+	start, end := offset, offset
+	for start > 0 && isWordChar(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isWordChar(text[end]) {
+		end++
+	}
+	return text[start:end]
+}
+
+// offsetAt converts an LSP position (UTF-16 columns) to a byte offset
+func offsetAt(text string, pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i == -1 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+
+	units := 0
+	for offset < len(text) && text[offset] != '\n' && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		units += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+// positionAt converts a byte offset to an LSP position
+func positionAt(text string, offset int) Position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	pos := Position{}
+	lineStart := 0
+	for i := 0; i < offset; i++ {
+		if text[i] == '\n' {
+			pos.Line++
+			lineStart = i + 1
+		}
+	}
+	for _, r := range text[lineStart:offset] {
+		pos.Character += len(utf16.Encode([]rune{r}))
+	}
+	return pos
+}
+
+func spanRange(text string, offset, length int) Range {
+	return Range{Start: positionAt(text, offset), End: positionAt(text, offset+length)}
+}
+
+// tokenRange covers the word at offset, or a single char
+func tokenRange(text string, offset int) Range {
+	length := len(wordAt(text, offset))
+	if length == 0 {
+		length = 1
+	}
+	return spanRange(text, offset, length)
+}
+
+// lineRange covers a whole (0-based) line
+func lineRange(line int) Range {
+	return Range{
+		Start: Position{Line: line},
+		End:   Position{Line: line + 1},
+	}
+}
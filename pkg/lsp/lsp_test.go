@@ -0,0 +1,251 @@
+package lsp_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/lsp"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+	"github.com/aprksy/knitknot/pkg/storage/inmem"
+)
+
+var _ = Describe("Language Server", func() {
+	var engine *graph.GraphEngine
+
+	labels := func(items []lsp.CompletionItem) []string {
+		var out []string
+		for _, it := range items {
+			out = append(out, it.Label)
+		}
+		return out
+	}
+
+	BeforeEach(func() {
+		engine = graph.NewGraphEngine(inmem.New())
+		engine.RegisterVerb("has_skill", types.Verb{TargetLabel: "Skill", MatchOn: "name"})
+
+		alice, _ := engine.AddNode("User", map[string]any{"name": "Alice", "age": 40})
+		goID, _ := engine.AddNode("Skill", map[string]any{"name": "Go"})
+		_, _ = engine.AddEdge(alice, goID, "has_skill", map[string]any{"level": 4})
+	})
+
+	Describe("Diagnose", func() {
+		It("should accept valid queries and REPL commands", func() {
+			text := "ADDNODE User name=Bob\nFind('User').Has('has_skill', 'Go')"
+			Expect(lsp.Diagnose(engine, text)).To(BeEmpty())
+		})
+
+		It("should report parse errors at the offending token", func() {
+			text := "VERBS\nFind('User').Limit('x' 'y')"
+			diags := lsp.Diagnose(engine, text)
+			Expect(diags).To(HaveLen(1))
+			Expect(diags[0].Severity).To(Equal(lsp.SeverityError))
+			Expect(diags[0].Range.Start.Line).To(Equal(1))
+			Expect(diags[0].Range.Start.Character).To(Equal(23))
+		})
+
+		It("should report unknown methods", func() {
+			diags := lsp.Diagnose(engine, "Find('User').Sort('n.age')")
+			Expect(diags).To(HaveLen(1))
+			Expect(diags[0].Message).To(ContainSubstring("unknown method: Sort"))
+			Expect(diags[0].Range.Start.Character).To(Equal(13))
+			Expect(diags[0].Range.End.Character).To(Equal(17))
+		})
+
+		It("should warn about undefined verbs", func() {
+			diags := lsp.Diagnose(engine, "Find('User').Has('has_skil', 'Go')")
+			Expect(diags).To(HaveLen(1))
+			Expect(diags[0].Severity).To(Equal(lsp.SeverityWarning))
+			Expect(diags[0].Message).To(Equal("verb 'has_skil' is not defined; Has follows 'has_skil' edges to Entity nodes and compares their name"))
+		})
+
+		It("should place errors after a comment inside a chain on their own line", func() {
+			text := "Find('User')\n  -- seniors only\n\n  .Wher('n.age', '>', 50)\n  .Limit(3 4)"
+			diags := lsp.Diagnose(engine, text)
+			Expect(diags).To(HaveLen(1))
+			Expect(diags[0].Range.Start).To(Equal(lsp.Position{Line: 4, Character: 11}))
+
+			diags = lsp.Diagnose(engine, "Find('User')\n  -- seniors only\n  .Wher('n.age', '>', 50)")
+			Expect(diags).To(HaveLen(1))
+			Expect(diags[0].Message).To(Equal("unknown method: Wher"))
+			Expect(diags[0].Range).To(Equal(lsp.Range{
+				Start: lsp.Position{Line: 2, Character: 3},
+				End:   lsp.Position{Line: 2, Character: 7},
+			}))
+		})
+
+		It("should report unterminated strings on their line", func() {
+			diags := lsp.Diagnose(engine, "VERBS\nFind('User)")
+			Expect(diags).To(HaveLen(1))
+			Expect(diags[0].Range.Start.Line).To(Equal(1))
+		})
+	})
+
+	Describe("Complete", func() {
+		complete := func(text string) []string {
+			return labels(lsp.Complete(engine, text, len(text)))
+		}
+
+		It("should offer methods after a dot", func() {
+			Expect(complete("Find('User').")).To(ContainElements("Has", "Where", "Limit"))
+			Expect(complete("Find('User').Wh")).To(ContainElement("WhereEdge"))
+		})
+
+		It("should offer labels inside Find", func() {
+			Expect(complete("Find('")).To(Equal([]string{"Skill", "User"}))
+		})
+
+		It("should offer verbs inside Has", func() {
+			Expect(complete("Find('User').Has('")).To(Equal([]string{"has_skill"}))
+		})
+
+		It("should offer property keys inside Where", func() {
+			Expect(complete("Find('User').Where('")).To(ContainElements("n.age", "n.name"))
+			Expect(complete("Find('User').Has('has_skill', 'Go').Where('v0.")).To(ContainElement("v0.name"))
+		})
+
+		It("should offer edge property keys inside WhereEdge", func() {
+			Expect(complete("Find('User').Has('has_skill', 'Go').WhereEdge('")).To(Equal([]string{"level"}))
+		})
+
+		It("should offer operators as the second Where argument", func() {
+			Expect(complete("Find('User').Where('n.age', '")).To(ContainElements("=", ">"))
+			Expect(complete("Find('User').Has('has_skill', 'level', '")).To(ContainElements(">=", "<="))
+		})
+
+		It("should replace the partially typed string", func() {
+			text := "Find('Us"
+			items := lsp.Complete(engine, text, len(text))
+			Expect(items).NotTo(BeEmpty())
+			Expect(items[0].TextEdit.Range.Start.Character).To(Equal(6))
+			Expect(items[0].TextEdit.Range.End.Character).To(Equal(8))
+		})
+	})
+
+	Describe("HoverAt", func() {
+		It("should show verb definitions", func() {
+			text := "Find('User').Has('has_skill', 'Go')"
+			hover := lsp.HoverAt(engine, text, strings.Index(text, "has_skill")+2)
+			Expect(hover).NotTo(BeNil())
+			Expect(hover.Contents.Value).To(ContainSubstring("`Skill`"))
+			Expect(hover.Contents.Value).To(ContainSubstring("`name`"))
+		})
+
+		It("should say how an undefined verb is matched", func() {
+			text := "Find('User').Has('mentors', 'Bob')"
+			hover := lsp.HoverAt(engine, text, strings.Index(text, "mentors")+2)
+			Expect(hover).NotTo(BeNil())
+			Expect(hover.Contents.Value).To(Equal("**mentors** — undefined verb: Has follows 'mentors' edges to Entity nodes and compares their name"))
+		})
+
+		It("should show the verb an inverse name belongs to", func() {
+			engine.RegisterVerb("taught_by", types.Verb{SourceLabel: "Skill", TargetLabel: "User", Inverse: "teaches"})
+			text := "Find('User').Has('teaches', 'Go')"
+			Expect(lsp.Diagnose(engine, text)).To(BeEmpty())
+
+			hover := lsp.HoverAt(engine, text, strings.Index(text, "teaches")+2)
+			Expect(hover).NotTo(BeNil())
+			Expect(hover.Contents.Value).To(ContainSubstring("inverse of: `taught_by`"))
+			Expect(hover.Contents.Value).To(ContainSubstring("`Skill`"))
+		})
+
+		It("should show method signatures", func() {
+			text := "Find('User').Where('n.age', '>', 30)"
+			hover := lsp.HoverAt(engine, text, strings.Index(text, "Where")+1)
+			Expect(hover).NotTo(BeNil())
+			Expect(hover.Contents.Value).To(ContainSubstring("Where(field, op, value)"))
+		})
+
+		It("should return nil elsewhere", func() {
+			Expect(lsp.HoverAt(engine, "Find('User')", 12)).To(BeNil())
+		})
+	})
+
+	Describe("Serve", func() {
+		frame := func(v any) string {
+			body, _ := json.Marshal(v)
+			return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+		}
+
+		readAll := func(r io.Reader) []map[string]any {
+			var msgs []map[string]any
+			br := bufio.NewReader(r)
+			for {
+				header, err := br.ReadString('\n')
+				if err != nil {
+					return msgs
+				}
+				n, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+				_, _ = br.ReadString('\n')
+				body := make([]byte, n)
+				_, _ = io.ReadFull(br, body)
+				var m map[string]any
+				Expect(json.Unmarshal(body, &m)).To(Succeed())
+				msgs = append(msgs, m)
+			}
+		}
+
+		It("should answer a full session", func() {
+			uri := "file:///q.kq"
+			in := strings.Join([]string{
+				frame(map[string]any{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]any{}}),
+				frame(map[string]any{"jsonrpc": "2.0", "method": "initialized", "params": map[string]any{}}),
+				frame(map[string]any{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": map[string]any{
+					"textDocument": map[string]any{"uri": uri, "languageId": "knitknot", "version": 1, "text": "Find('"},
+				}}),
+				frame(map[string]any{"jsonrpc": "2.0", "id": 2, "method": "textDocument/completion", "params": map[string]any{
+					"textDocument": map[string]any{"uri": uri},
+					"position":     map[string]any{"line": 0, "character": 6},
+				}}),
+				frame(map[string]any{"jsonrpc": "2.0", "id": 3, "method": "workspace/symbol", "params": map[string]any{}}),
+				frame(map[string]any{"jsonrpc": "2.0", "id": 4, "method": "shutdown"}),
+				frame(map[string]any{"jsonrpc": "2.0", "method": "exit"}),
+			}, "")
+
+			var out bytes.Buffer
+			Expect(lsp.NewServer(engine).Serve(strings.NewReader(in), &out)).To(Succeed())
+
+			msgs := readAll(&out)
+			Expect(msgs).To(HaveLen(5))
+
+			Expect(msgs[0]["result"]).To(HaveKey("capabilities"))
+			Expect(msgs[1]["method"]).To(Equal("textDocument/publishDiagnostics"))
+
+			items := msgs[2]["result"].([]any)
+			Expect(items).To(HaveLen(2))
+			Expect(items[0].(map[string]any)["label"]).To(Equal("Skill"))
+
+			Expect(msgs[3]["error"].(map[string]any)["code"]).To(BeNumerically("==", -32601))
+			Expect(msgs[3]).NotTo(HaveKey("result"))
+			Expect(msgs[4]["id"]).To(BeNumerically("==", 4))
+			Expect(msgs[4]).To(HaveKeyWithValue("result", BeNil()))
+			Expect(msgs[4]).NotTo(HaveKey("error"))
+		})
+
+		It("should answer a malformed request with an error and a null ID", func() {
+			in := "Content-Length: 5\r\n\r\n{oops"
+			var out bytes.Buffer
+			_ = lsp.NewServer(engine).Serve(strings.NewReader(in), &out)
+
+			msgs := readAll(&out)
+			Expect(msgs).To(HaveLen(1))
+			Expect(msgs[0]).To(HaveKeyWithValue("id", BeNil()))
+			Expect(msgs[0]).To(HaveKeyWithValue("error", HaveKeyWithValue("code", BeNumerically("==", -32700))))
+			Expect(msgs[0]).NotTo(HaveKey("result"))
+		})
+
+		It("should fail on exit without shutdown", func() {
+			in := frame(map[string]any{"jsonrpc": "2.0", "method": "exit"})
+			Expect(lsp.NewServer(nil).Serve(strings.NewReader(in), io.Discard)).NotTo(Succeed())
+		})
+	})
+})
@@ -0,0 +1,187 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/aprksy/knitknot/pkg/graph"
+)
+
+// Server is a Language Server Protocol server for the KnitKnot DSL. It
+// answers from a single loaded graph: completions and hovers reflect the
+// labels, properties and verbs of that graph.
+type Server struct {
+	engine *graph.GraphEngine
+
+	mu   sync.Mutex
+	docs map[string]string
+
+	wmu sync.Mutex
+	out io.Writer
+
+	shutdown bool
+}
+
+// NewServer creates a server backed by engine; engine may be nil, in
+// which case only syntax diagnostics and method completion are offered
+func NewServer(engine *graph.GraphEngine) *Server {
+	return &Server{
+		engine: engine,
+		docs:   make(map[string]string),
+	}
+}
+
+// Serve reads requests from r and writes responses to w until the client
+// sends "exit" or r is closed. An exit without a prior shutdown request
+// is reported as an error, as the protocol requires.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.out = w
+	reader := bufio.NewReader(r)
+
+	for {
+		body, err := readMessage(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit received before shutdown")
+			}
+			return nil
+		}
+
+		if err := s.handle(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) error {
+	switch msg.Method {
+	case "initialize":
+		return s.reply(msg.ID, map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": 1, // full document on every change
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{".", "'"},
+				},
+				"hoverProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "knitknot"},
+		})
+
+	case "initialized":
+		return nil
+
+	case "shutdown":
+		s.shutdown = true
+		return s.reply(msg.ID, nil)
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil
+		}
+		return s.update(p.TextDocument.URI, p.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil || len(p.ContentChanges) == 0 {
+			return nil
+		}
+		return s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil
+		}
+		s.mu.Lock()
+		delete(s.docs, p.TextDocument.URI)
+		s.mu.Unlock()
+		return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         p.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+
+	case "textDocument/completion":
+		text, offset, err := s.locate(msg)
+		if err != nil {
+			return s.replyError(msg.ID, codeInvalidParams, err.Error())
+		}
+		return s.reply(msg.ID, Complete(s.engine, text, offset))
+
+	case "textDocument/hover":
+		text, offset, err := s.locate(msg)
+		if err != nil {
+			return s.replyError(msg.ID, codeInvalidParams, err.Error())
+		}
+		return s.reply(msg.ID, HoverAt(s.engine, text, offset))
+	}
+
+	// Unknown notifications are ignored; unknown requests get an error
+	if msg.ID != nil {
+		return s.replyError(msg.ID, codeMethodNotFound, "method not found: "+msg.Method)
+	}
+	return nil
+}
+
+func (s *Server) update(uri, text string) error {
+	s.mu.Lock()
+	s.docs[uri] = text
+	s.mu.Unlock()
+
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: Diagnose(s.engine, text),
+	})
+}
+
+// locate resolves the document and byte offset of a position request
+func (s *Server) locate(msg *message) (string, int, error) {
+	var p positionParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		return "", 0, err
+	}
+
+	s.mu.Lock()
+	text, ok := s.docs[p.TextDocument.URI]
+	s.mu.Unlock()
+	if !ok {
+		return "", 0, errors.New("document not open: " + p.TextDocument.URI)
+	}
+	return text, offsetAt(text, p.Position), nil
+}
+
+func (s *Server) reply(id *json.RawMessage, result any) error {
+	return s.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, msg string) error {
+	return s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: &responseError{Code: code, Message: msg}})
+}
+
+func (s *Server) notify(method string, params any) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) write(v any) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return writeMessage(s.out, v)
+}
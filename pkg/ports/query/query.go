@@ -17,7 +17,12 @@ type QueryPlan struct {
 	Subgraph  string // if non-empty, restrict to this subgraph
 }
 
-// QueryEngine compiles and executes queries against a storage engine
+// QueryEngine compiles and executes queries against a storage engine, or
+// a transaction's view of it
 type QueryEngine interface {
-	Execute(ctx context.Context, storage store.StorageEngine, plan *QueryPlan) (ResultSet, error)
+	Execute(ctx context.Context, storage store.Reader, plan *QueryPlan) (ResultSet, error)
+
+	// Iterate streams the rows instead of collecting them. The storage
+	// must stay readable until the iterator is closed.
+	Iterate(ctx context.Context, storage store.Reader, plan *QueryPlan) (ResultIterator, error)
 }
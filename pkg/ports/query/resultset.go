@@ -1,6 +1,10 @@
 package query
 
-import "github.com/aprksy/knitknot/pkg/ports/types"
+import (
+	"context"
+
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
 
 // ResultSet holds the results of a query execution.
 // Each item is a mapping from variable name (e.g., "n", "s") to Node.
@@ -9,3 +13,14 @@ type ResultSet interface {
 	Empty() bool
 	Items() []map[string]*types.Node
 }
+
+// ResultIterator pulls the rows of a query one at a time, so that they
+// need not all be held in memory. Next advances to the next row, if any;
+// once it returns false, Err tells whether the rows ran out or something
+// (such as a cancelled ctx) stopped them. Close must always be called.
+type ResultIterator interface {
+	Next(ctx context.Context) bool
+	Row() map[string]*types.Node
+	Err() error
+	Close() error
+}
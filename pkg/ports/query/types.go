@@ -9,6 +9,8 @@ type PatternEdge struct {
 	From, To string
 	Kind     string
 	Filters  []Filter
+	// Undirected also matches edges of the kind from To to From
+	Undirected bool
 }
 
 type Filter struct {
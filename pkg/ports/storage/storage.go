@@ -1,11 +1,37 @@
 package storage
 
-import "github.com/aprksy/knitknot/pkg/ports/types"
+import (
+	"context"
+	"errors"
 
-// StorageEngine handles persistence of nodes/edges
-type StorageEngine interface {
-	AddNode(label string, props map[string]any) (string, error)
-	AddEdge(from, to, kind string, props map[string]any) error
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// ErrTxDone is returned when a transaction is used after Commit or Rollback
+var ErrTxDone = errors.New("transaction already committed or rolled back")
+
+// ErrNodeExists is returned when adding a node under an ID already in use
+var ErrNodeExists = errors.New("node already exists")
+
+// ErrEdgeExists is returned when adding an edge under an ID already in use
+var ErrEdgeExists = errors.New("edge already exists")
+
+// ErrNodeHasEdges is returned by DeleteNode for a node that still has edges
+var ErrNodeHasEdges = errors.New("node has edges")
+
+// ErrAmbiguousEdge is returned when an edge is addressed by its ends and
+// kind but several parallel edges match; address it by ID instead
+var ErrAmbiguousEdge = errors.New("more than one matching edge")
+
+// ErrSubgraphNotFound is returned for a subgraph that was not created
+var ErrSubgraphNotFound = errors.New("subgraph not found")
+
+// ErrConflict is returned by Commit when another writer changed a record the
+// transaction also changed; the transaction is rolled back
+var ErrConflict = errors.New("transaction conflicts with a concurrent write")
+
+// Reader gives read access to nodes/edges
+type Reader interface {
 	GetNode(id string) (*types.Node, bool)
 	GetEdge(id string) (*types.Edge, bool)
 	GetAllNodes() []*types.Node
@@ -15,9 +41,163 @@ type StorageEngine interface {
 	GetEdgesByKind(kind string) []*types.Edge
 	GetNodesIn(subgraph string) []*types.Node
 	GetEdgesIn(subgraph string) []*types.Edge
+	// GetNodesByProp returns the nodes of a label whose property equals
+	// value (compared as stored, so 1 and 1.0 differ). It uses an index
+	// if there is one, and scans all nodes otherwise.
+	GetNodesByProp(label, prop string, value any) []*types.Node
+}
+
+// NodeScanner is implemented by readers that can hand out their nodes one
+// at a time, so a scan that stops early reads no more of them than it used
+type NodeScanner interface {
+	ScanNodes() NodeCursor
+}
+
+// NodeCursor yields the nodes of a scan in no particular order
+type NodeCursor interface {
+	// Next returns the next node, or false once there are no more
+	Next() (*types.Node, bool)
+}
 
+// Writer mutates nodes/edges
+type Writer interface {
+	// AddNode stores a node with one label under an ID from the storage's
+	// IDGenerator
+	AddNode(label string, props map[string]any) (string, error)
+	// AddNodeWithID stores a node under a caller-supplied (natural) key
+	AddNodeWithID(id, label string, props map[string]any) error
+	// AddEdge stores a new edge under a generated ID, even if an edge of
+	// the same kind already joins the two nodes
+	AddEdge(from, to, kind string, props map[string]any) (string, error)
+	// AddEdgeWithID stores a new edge under a caller-supplied ID, e.g. to
+	// put back one that was deleted
+	AddEdgeWithID(id, from, to, kind string, props map[string]any) error
+	// MergeEdge keeps at most one edge of a kind between two nodes: it
+	// replaces the props of the existing edge, or adds one if there is none
+	MergeEdge(from, to, kind string, props map[string]any) (string, error)
+	// UpdateNode and UpdateEdge replace all props of a record
 	UpdateNode(id string, props map[string]any) error
 	UpdateEdge(id string, props map[string]any) error
+	// PatchNode and PatchEdge remove the unset keys, then set the others,
+	// leaving the rest of the props as they are
+	PatchNode(id string, set map[string]any, unset []string) error
+	PatchEdge(id string, set map[string]any, unset []string) error
+	// SetLabel replaces all labels of a node with one
+	SetLabel(id, label string) error
+	// AddLabel and RemoveLabel change one label of a node, doing nothing
+	// if it already has or lacks it; the last label cannot be removed
+	AddLabel(id, label string) error
+	RemoveLabel(id, label string) error
+	// DeleteNode fails with ErrNodeHasEdges if the node has edges
 	DeleteNode(id string) error
+	// DetachDeleteNode deletes the node together with all its edges
+	DetachDeleteNode(id string) error
+	// DeleteEdge deletes the edge of a kind between two nodes; it fails
+	// with ErrAmbiguousEdge if there are parallel ones
 	DeleteEdge(from, to, kind string) error
+	DeleteEdgeByID(id string) error
+}
+
+// SubgraphManager keeps the registry of named subgraphs and the membership
+// of nodes and edges in them. Its changes are not transactional.
+type SubgraphManager interface {
+	// CreateSubgraph registers an empty, induced subgraph
+	CreateSubgraph(name, description string) error
+	// CreateView registers an empty subgraph defined by a query. The
+	// storage only keeps the query; filling the view is up to the caller.
+	CreateView(name, query string) error
+	// DropSubgraph unregisters a subgraph and removes all memberships in
+	// it; the nodes and edges themselves stay
+	DropSubgraph(name string) error
+	ListSubgraphs() []*types.Subgraph
+	// SetSubgraphMode chooses whether edges between member nodes belong
+	// to a subgraph without being added
+	SetSubgraphMode(name string, mode types.SubgraphMode) error
+	// AddNodesToSubgraph adds all the nodes or, if one is missing, none
+	AddNodesToSubgraph(name string, ids []string) error
+	RemoveNodesFromSubgraph(name string, ids []string) error
+	AddEdgeToSubgraph(name, edgeID string) error
+	RemoveEdgeFromSubgraph(name, edgeID string) error
+}
+
+// Indexer keeps property indexes for GetNodesByProp. Like subgraphs,
+// indexes are not transactional; they cover every version of the nodes.
+type Indexer interface {
+	// CreateIndex indexes the existing nodes of the label and keeps the
+	// index up to date; it fails if the index exists
+	CreateIndex(label, prop string) error
+	DropIndex(label, prop string) error
+	ListIndexes() []types.PropertyIndex
+}
+
+// MetadataStore keeps the engine's definitions of the graph. Like
+// subgraphs, they are not transactional.
+type MetadataStore interface {
+	// Metadata returns the definitions last set, or loaded with the graph
+	Metadata() types.Metadata
+	// SetMetadata replaces the definitions
+	SetMetadata(meta types.Metadata)
+}
+
+// StorageEngine handles persistence of nodes/edges
+type StorageEngine interface {
+	Reader
+	Writer
+	SubgraphManager
+	Indexer
+	MetadataStore
+
+	// Snapshot opens a read-only view of the current state that later
+	// writes do not affect. Queries run against one.
+	Snapshot() Snapshot
+
+	// Begin starts a transaction. Its reads see the storage as of Begin
+	// plus its own writes, which become visible to others only on Commit.
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// Persister is implemented by storages that save the whole graph, records
+// and metadata, to a file and load it back
+type Persister interface {
+	Save(filename string) error
+	// Load replaces the graph with the saved one
+	Load(filename string) error
+}
+
+// Snapshot is a consistent, read-only view of the storage at one point in
+// time. Release it when done so the storage can drop old versions.
+type Snapshot interface {
+	Reader
+	Release()
+}
+
+// Tx groups mutations that are applied all together or not at all.
+// A Tx is not safe for concurrent use.
+type Tx interface {
+	Reader
+	Writer
+
+	// Commit applies the writes atomically. It fails with ErrConflict if a
+	// record written by the transaction was changed since Begin.
+	Commit() error
+
+	// Rollback discards the writes. After Commit it returns ErrTxDone, so
+	// it can be deferred right after Begin.
+	Rollback() error
+}
+
+// IDGenerator produces node IDs. Implementations must be safe for
+// concurrent use.
+type IDGenerator interface {
+	// Scheme names the kind of IDs (e.g. "counter"); it is saved with the
+	// graph so that loading it keeps generating the same kind
+	Scheme() string
+	NewID() string
+}
+
+// IDGeneratorState is implemented by generators with state that must
+// survive save and load, such as a counter
+type IDGeneratorState interface {
+	State() string
+	Restore(state string) error
 }
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ConstraintKind is what a constraint requires of the nodes of its label
+type ConstraintKind string
+
+const (
+	// ConstraintUnique forbids two nodes having the same values; nodes
+	// lacking one of the properties are not compared
+	ConstraintUnique ConstraintKind = "unique"
+	// ConstraintExists requires every node to have the properties
+	ConstraintExists ConstraintKind = "exists"
+	// ConstraintNodeKey is both: the properties identify the node
+	ConstraintNodeKey ConstraintKind = "node_key"
+)
+
+func ParseConstraintKind(s string) (ConstraintKind, error) {
+	switch k := ConstraintKind(strings.ToLower(strings.ReplaceAll(s, " ", "_"))); k {
+	case ConstraintUnique, ConstraintExists, ConstraintNodeKey:
+		return k, nil
+	case "key":
+		return ConstraintNodeKey, nil
+	}
+	return "", fmt.Errorf("unknown constraint kind %q (want unique, exists or node key)", s)
+}
+
+// Constraint restricts the properties of the nodes carrying a label
+type Constraint struct {
+	Name       string
+	Kind       ConstraintKind
+	Label      string
+	Properties []string
+}
+
+// DefaultName names a constraint after what it constrains, e.g.
+// "user_email_unique"
+func (c Constraint) DefaultName() string {
+	return strings.ToLower(c.Label) + "_" + strings.Join(c.Properties, "_") + "_" + string(c.Kind)
+}
+
+// Requires reports whether nodes must have the properties
+func (c Constraint) Requires() bool {
+	return c.Kind == ConstraintExists || c.Kind == ConstraintNodeKey
+}
+
+// Distinct reports whether nodes must have different values
+func (c Constraint) Distinct() bool {
+	return c.Kind == ConstraintUnique || c.Kind == ConstraintNodeKey
+}
+
+func (c Constraint) Validate() error {
+	if c.Label == "" {
+		return errors.New("constraint needs a label")
+	}
+	if len(c.Properties) == 0 {
+		return errors.New("constraint needs at least one property")
+	}
+	if _, err := ParseConstraintKind(string(c.Kind)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// String describes the constraint, e.g. "UNIQUE User.email" or
+// "NODE KEY User(first, last)"
+func (c Constraint) String() string {
+	kind := strings.ToUpper(strings.ReplaceAll(string(c.Kind), "_", " "))
+	if len(c.Properties) == 1 {
+		return fmt.Sprintf("%s %s.%s", kind, c.Label, c.Properties[0])
+	}
+	return fmt.Sprintf("%s %s(%s)", kind, c.Label, strings.Join(c.Properties, ", "))
+}
+
+// PropertyIndex names an index of the nodes of a label by the value of
+// one of their properties
+type PropertyIndex struct {
+	Label    string
+	Property string
+}
+
+func (pi PropertyIndex) String() string {
+	return pi.Label + "." + pi.Property
+}
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"sort"
+	"sync"
+)
+
+// ConstraintRegistry stores constraints by name
+type ConstraintRegistry struct {
+	mu          sync.RWMutex
+	constraints map[string]Constraint
+}
+
+func NewConstraintRegistry() *ConstraintRegistry {
+	return &ConstraintRegistry{
+		constraints: make(map[string]Constraint),
+	}
+}
+
+func (cr *ConstraintRegistry) Register(c Constraint) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.constraints[c.Name] = c
+}
+
+func (cr *ConstraintRegistry) Remove(name string) bool {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	_, ok := cr.constraints[name]
+	delete(cr.constraints, name)
+	return ok
+}
+
+func (cr *ConstraintRegistry) Lookup(name string) (Constraint, bool) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	c, ok := cr.constraints[name]
+	return c, ok
+}
+
+// All returns the constraints sorted by name
+func (cr *ConstraintRegistry) All() []Constraint {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	list := make([]Constraint, 0, len(cr.constraints))
+	for _, c := range cr.constraints {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
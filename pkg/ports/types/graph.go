@@ -1,23 +1,89 @@
 package types
 
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
 // Node and Edge remain concrete types
 type Node struct {
-	ID        string               `json:"id"`
-	Label     string               `json:"label"`
-	Props     map[string]any       `json:"props"`
-	Subgraphs map[string]*Subgraph `json:"subgraphs,omitempty"`
+	ID     string         `json:"id"`
+	Labels []string       `json:"labels"`
+	Props  map[string]any `json:"props"`
+	// Subgraphs names the subgraphs the node belongs to
+	Subgraphs []string `json:"subgraphs,omitempty"`
+}
+
+// HasLabel reports whether the node carries the label
+func (n *Node) HasLabel(label string) bool {
+	return slices.Contains(n.Labels, label)
+}
+
+// LabelString joins the labels as written in ADDNODE, e.g. "Employee:Mentor"
+func (n *Node) LabelString() string {
+	return strings.Join(n.Labels, ":")
+}
+
+func (n *Node) InSubgraph(name string) bool {
+	return slices.Contains(n.Subgraphs, name)
 }
 
 type Edge struct {
-	ID        string               `json:"id"`
-	From      string               `json:"from"`
-	To        string               `json:"to"`
-	Kind      string               `json:"kind"`
-	Props     map[string]any       `json:"props"`
-	Subgraphs map[string]*Subgraph `json:"subgraphs,omitempty"`
+	ID        string         `json:"id"`
+	From      string         `json:"from"`
+	To        string         `json:"to"`
+	Kind      string         `json:"kind"`
+	Props     map[string]any `json:"props"`
+	Subgraphs []string       `json:"subgraphs,omitempty"`
+}
+
+func (e *Edge) InSubgraph(name string) bool {
+	return slices.Contains(e.Subgraphs, name)
 }
 
+// Subgraph is a named group of nodes and edges. Each is registered once
+// with the storage; nodes and edges refer to it by name.
+//
+// Nodes are members when added explicitly (or, for a view, when they are
+// results of its query). Edges are members when added explicitly and, in
+// an induced subgraph, when they join two member nodes.
 type Subgraph struct {
-	Name        string
-	Description string
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Mode        SubgraphMode `json:"mode,omitempty"`
+	// Query is the DSL query defining a view; its members are the query's
+	// results. Empty for a subgraph whose members are added by hand.
+	Query string `json:"query,omitempty"`
+}
+
+func (sg *Subgraph) IsView() bool {
+	return sg.Query != ""
+}
+
+// Induced reports whether edges between member nodes belong to the
+// subgraph without being added. Subgraphs saved before modes existed,
+// with no Mode, are induced.
+func (sg *Subgraph) Induced() bool {
+	return sg.Mode != SubgraphExplicit
+}
+
+// SubgraphMode decides which edges belong to a subgraph
+type SubgraphMode string
+
+const (
+	// SubgraphInduced holds the edges added to it and every edge between
+	// two of its nodes
+	SubgraphInduced SubgraphMode = "induced"
+	// SubgraphExplicit holds only the edges added to it
+	SubgraphExplicit SubgraphMode = "explicit"
+)
+
+// ParseSubgraphMode parses "induced" or "explicit", in any case
+func ParseSubgraphMode(s string) (SubgraphMode, error) {
+	switch m := SubgraphMode(strings.ToLower(s)); m {
+	case SubgraphInduced, SubgraphExplicit:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown subgraph mode %q (want induced or explicit)", s)
 }
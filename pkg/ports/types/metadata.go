@@ -0,0 +1,14 @@
+package types
+
+// Metadata is what an engine defines about a graph besides its records:
+// verbs, label schemas, constraints and the default subgraph. Storages
+// keep it so that it is persisted with the graph. Property indexes are
+// left out: the engine creates the ones its unique properties and
+// Distinct constraints need from these definitions, and any others are
+// the storage's own to keep.
+type Metadata struct {
+	Verbs           map[string]Verb
+	Schemas         map[string]LabelSchema
+	Constraints     []Constraint
+	DefaultSubgraph string
+}
@@ -0,0 +1,156 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LabelSchema declares properties of the nodes carrying a label. Nodes
+// may have undeclared properties too.
+type LabelSchema struct {
+	Label      string
+	Properties []PropertyDef
+}
+
+// PropertyDef declares one property of a label
+type PropertyDef struct {
+	Name     string
+	Type     PropType
+	Required bool
+	// Unique forbids two nodes of the label having the same value
+	Unique bool
+	// Default is set on new nodes that lack the property; nil for none
+	Default any
+}
+
+// PropType is the type of a declared property
+type PropType string
+
+const (
+	PropString PropType = "string"
+	PropInt    PropType = "int"
+	PropFloat  PropType = "float"
+	PropBool   PropType = "bool"
+)
+
+func ParsePropType(s string) (PropType, error) {
+	switch t := PropType(strings.ToLower(s)); t {
+	case PropString, PropInt, PropFloat, PropBool:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown property type %q (want string, int, float or bool)", s)
+}
+
+// Coerce converts a value to the type, accepting its string form (as
+// typed in the REPL) and, for numbers, the other numeric types when no
+// precision is lost
+func (t PropType) Coerce(v any) (any, error) {
+	switch t {
+	case PropString:
+		switch v.(type) {
+		case string:
+			return v, nil
+		case int, int64, float64, bool:
+			return fmt.Sprint(v), nil
+		}
+	case PropInt:
+		switch n := v.(type) {
+		case int:
+			return n, nil
+		case int64:
+			return int(n), nil
+		case float64:
+			if n == float64(int(n)) {
+				return int(n), nil
+			}
+		case string:
+			if i, err := strconv.Atoi(n); err == nil {
+				return i, nil
+			}
+		}
+	case PropFloat:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		case string:
+			if f, err := strconv.ParseFloat(n, 64); err == nil {
+				return f, nil
+			}
+		}
+	case PropBool:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			if parsed, err := strconv.ParseBool(b); err == nil {
+				return parsed, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("want %s, got %T %#v", t, v, v)
+}
+
+// Property returns the declaration of a property
+func (ls LabelSchema) Property(name string) (PropertyDef, bool) {
+	for _, p := range ls.Properties {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return PropertyDef{}, false
+}
+
+// Validate checks the declarations themselves
+func (ls LabelSchema) Validate() error {
+	seen := make(map[string]bool)
+	for _, p := range ls.Properties {
+		if seen[p.Name] {
+			return fmt.Errorf("%s.%s declared twice", ls.Label, p.Name)
+		}
+		seen[p.Name] = true
+		if _, err := ParsePropType(string(p.Type)); err != nil {
+			return fmt.Errorf("%s.%s: %w", ls.Label, p.Name, err)
+		}
+		if p.Default != nil {
+			if _, err := p.Type.Coerce(p.Default); err != nil {
+				return fmt.Errorf("%s.%s default: %w", ls.Label, p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Check returns the props with declared ones converted to their types,
+// and, for a new node, missing ones set to their defaults. It fails if a
+// value has the wrong type or a required property is missing.
+func (ls LabelSchema) Check(props map[string]any, create bool) (map[string]any, error) {
+	checked := make(map[string]any, len(props))
+	for k, v := range props {
+		checked[k] = v
+	}
+
+	for _, p := range ls.Properties {
+		v, ok := checked[p.Name]
+		if !ok && create && p.Default != nil {
+			v, ok = p.Default, true
+		}
+		if !ok {
+			if p.Required {
+				return nil, fmt.Errorf("%s.%s is required", ls.Label, p.Name)
+			}
+			continue
+		}
+
+		typed, err := p.Type.Coerce(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", ls.Label, p.Name, err)
+		}
+		checked[p.Name] = typed
+	}
+	return checked, nil
+}
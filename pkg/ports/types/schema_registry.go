@@ -0,0 +1,38 @@
+package types
+
+import "sync"
+
+// SchemaRegistry stores the schemas of labels
+type SchemaRegistry struct {
+	mu      sync.RWMutex
+	schemas map[string]LabelSchema
+}
+
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		schemas: make(map[string]LabelSchema),
+	}
+}
+
+func (sr *SchemaRegistry) Register(schema LabelSchema) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.schemas[schema.Label] = schema
+}
+
+func (sr *SchemaRegistry) Lookup(label string) (LabelSchema, bool) {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+	s, ok := sr.schemas[label]
+	return s, ok
+}
+
+func (sr *SchemaRegistry) All() map[string]LabelSchema {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+	cp := make(map[string]LabelSchema, len(sr.schemas))
+	for k, v := range sr.schemas {
+		cp[k] = v
+	}
+	return cp
+}
@@ -1,14 +1,116 @@
 package types
 
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
 // Verb defines the meaning of a relationship type (edge kind)
 type Verb struct {
 	// TargetLabel is the expected label of the destination node
 	TargetLabel string
 
 	// MatchOn is the property key used in .Has(rel, value) filtering
-	// e.g., for "has_skill" → MatchOn = "name" → WHERE v.name = 'Go'
+	// e.g., for "has_skill" → MatchOn = "name" → WHERE v.name = 'Go'.
+	// MatchOnID matches the node ID instead.
 	MatchOn string
+
+	// Unique allows at most one edge of this kind between two nodes;
+	// adding another replaces the props of the existing one
+	Unique bool
+
+	// SourceLabel is the required label of the origin node; empty for any
+	SourceLabel string
+
+	// Cardinality limits how many edges of this kind a node may have;
+	// empty means many-to-many
+	Cardinality Cardinality
+
+	// Inverse names the same edges followed from their target, e.g.
+	// "manages" for "reports_to"; queries may use either name
+	Inverse string
+
+	// Symmetric edges mean the same in both directions (e.g. "knows"):
+	// queries follow them either way
+	Symmetric bool
+
+	// EdgeProps lists the properties edges of this kind may have; nil
+	// allows any
+	EdgeProps []string
 }
 
 // DefaultMatchProperty is used if MatchOn is empty
 const DefaultMatchProperty = "name"
+
+// DefaultTargetLabel is used if TargetLabel is empty, and for Has() on
+// an edge kind with no verb
+const DefaultTargetLabel = "Entity"
+
+// MatchOnID as MatchOn (or as a property in Has) stands for the node ID
+const MatchOnID = "@id"
+
+// Cardinality is how many edges of a kind may leave and reach a node
+type Cardinality string
+
+const (
+	ManyToMany Cardinality = "many_to_many"
+	// ManyToOne allows each source one edge, e.g. reports_to
+	ManyToOne Cardinality = "many_to_one"
+	// OneToMany allows each target one edge, e.g. parent_of
+	OneToMany Cardinality = "one_to_many"
+	OneToOne  Cardinality = "one_to_one"
+)
+
+// ParseCardinality accepts "many_to_one", "many-to-one" or "many to one"
+func ParseCardinality(s string) (Cardinality, error) {
+	c := Cardinality(strings.ToLower(strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_'
+	}), "_")))
+	switch c {
+	case "":
+		return ManyToMany, nil
+	case ManyToMany, ManyToOne, OneToMany, OneToOne:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown cardinality %q (want one-to-one, one-to-many, many-to-one or many-to-many)", s)
+}
+
+// OneOut reports whether a source may have only one edge of the kind
+func (c Cardinality) OneOut() bool {
+	return c == ManyToOne || c == OneToOne
+}
+
+// OneIn reports whether a target may have only one edge of the kind
+func (c Cardinality) OneIn() bool {
+	return c == OneToMany || c == OneToOne
+}
+
+func (c Cardinality) String() string {
+	if c == "" {
+		c = ManyToMany
+	}
+	return strings.ReplaceAll(string(c), "_", "-")
+}
+
+// Validate checks the definition itself
+func (v Verb) Validate(name string) error {
+	if _, err := ParseCardinality(string(v.Cardinality)); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if v.Inverse == name {
+		return fmt.Errorf("%s cannot be its own inverse", name)
+	}
+	if v.Symmetric && v.Inverse != "" {
+		return fmt.Errorf("%s is symmetric, so it needs no inverse", name)
+	}
+	if v.Symmetric && v.Cardinality != "" && v.Cardinality.OneOut() != v.Cardinality.OneIn() {
+		return fmt.Errorf("%s is symmetric, so it cannot be %s", name, v.Cardinality)
+	}
+	return nil
+}
+
+// AllowsEdgeProp reports whether edges of the verb may have a property
+func (v Verb) AllowsEdgeProp(key string) bool {
+	return v.EdgeProps == nil || slices.Contains(v.EdgeProps, key)
+}
@@ -37,3 +37,20 @@ func (vr *VerbRegistry) All() map[string]Verb {
 	}
 	return cp
 }
+
+// Resolve finds the verb a name refers to, either directly or as the
+// inverse of a verb. inverse is true in the second case; kind is the
+// edge kind the verb is stored as.
+func (vr *VerbRegistry) Resolve(name string) (kind string, def Verb, inverse bool, ok bool) {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+	if def, ok := vr.verbs[name]; ok {
+		return name, def, false, true
+	}
+	for kind, def := range vr.verbs {
+		if def.Inverse == name {
+			return kind, def, true, true
+		}
+	}
+	return "", Verb{}, false, false
+}
@@ -20,41 +20,27 @@ func NewDefaultQueryEngine() *DefaultQueryEngine {
 
 func (qe *DefaultQueryEngine) Execute(
 	ctx context.Context,
-	storage storage.StorageEngine,
+	storage storage.Reader,
 	plan *query.QueryPlan,
 ) (query.ResultSet, error) {
-	var results []map[string]*types.Node
-
-	// Start with first node pattern
 	if len(plan.Nodes) == 0 {
-		return &ResultSet{items: results}, nil
+		return &ResultSet{}, nil
 	}
 
-	first := plan.Nodes[0]
-	candidates := filterNodesByLabel(storage.GetAllNodes(), first.Label)
-
-	for _, node := range candidates {
-		row := map[string]*types.Node{
-			first.Var: node,
-		}
-
-		results = append(results, row)
+	it, err := qe.Iterate(ctx, storage, plan)
+	if err != nil {
+		return nil, err
 	}
+	defer it.Close()
 
-	// Now extend with remaining nodes + edges
-	for _, edgePattern := range plan.Edges {
-		results = qe.expandViaEdge(storage, results, edgePattern, plan.Nodes, plan.Filters)
+	var results []map[string]*types.Node
+	for it.Next(ctx) {
+		results = append(results, it.Row())
 	}
-
-	// Apply final filters (some may involve multiple vars)
-	filtered := qe.applyAllFilters(results, plan.Filters)
-
-	// Apply limit
-	if plan.LimitVal != nil && len(filtered) > *plan.LimitVal {
-		filtered = filtered[:*plan.LimitVal]
+	if err := it.Err(); err != nil {
+		return nil, err
 	}
-
-	return NewResultSet(filtered), nil
+	return NewResultSet(results), nil
 }
 
 func (qe *DefaultQueryEngine) matchFilters(row map[string]*types.Node, filters []query.Filter) bool {
@@ -62,6 +48,11 @@ func (qe *DefaultQueryEngine) matchFilters(row map[string]*types.Node, filters [
 		// Extract var name: e.g., "n.age" → var="n", prop="age"
 		parts := strings.SplitN(f.Field, ".", 2)
 		if len(parts) != 2 {
+			// A bare variable ("n") compares the node ID
+			node, ok := row[f.Field]
+			if !ok || !compare(node.ID, f.Op, f.Value) {
+				return false
+			}
 			continue
 		}
 		varName, prop := parts[0], parts[1]
@@ -83,17 +74,6 @@ func (qe *DefaultQueryEngine) matchFilters(row map[string]*types.Node, filters [
 	return true
 }
 
-func (qe *DefaultQueryEngine) applyAllFilters(rows []map[string]*types.Node, filters []query.Filter) []map[string]*types.Node {
-	var result []map[string]*types.Node
-	for _, row := range rows {
-		if qe.matchFilters(row, filters) {
-			result = append(result, row)
-		}
-	}
-
-	return result
-}
-
 func (qe *DefaultQueryEngine) findLabelForVar(varName string, nodes []*query.PatternNode) string {
 	for _, n := range nodes {
 		if n.Var == varName {
@@ -103,56 +83,30 @@ func (qe *DefaultQueryEngine) findLabelForVar(varName string, nodes []*query.Pat
 	return ""
 }
 
-func (qe *DefaultQueryEngine) expandViaEdge(
-	storage storage.StorageEngine,
-	rows []map[string]*types.Node,
-	edgePattern *query.PatternEdge,
-	allNodes []*query.PatternNode,
-	filters []query.Filter,
-) []map[string]*types.Node {
-	var expanded []map[string]*types.Node
-
-	fromVar := edgePattern.From
-	toVar := edgePattern.To
-	kind := edgePattern.Kind
-
-	for _, row := range rows {
-		fromNode, ok := row[fromVar]
-		if !ok {
-			continue
-		}
-
-		// Get ALL outgoing edges of this kind
-		for _, e := range storage.GetEdgesFrom(fromNode.ID) {
-			if e.Kind != kind {
-				continue
-			}
-
-			// Check edge filters BEFORE accepting
-			if !qe.matchEdgeFilters(e, edgePattern.Filters) {
-				continue
-			}
-
-			toNode, ok := storage.GetNode(e.To)
-			if !ok {
-				continue
-			}
+// step is an edge followed from a node, and the node at its other end
+type step struct {
+	edge  *types.Edge
+	other string
+}
 
-			expectedLabel := qe.findLabelForVar(toVar, allNodes)
-			if expectedLabel != "" && toNode.Label != expectedLabel {
-				continue
+// steps returns the edges leaving a node (or, if not forward, reaching
+// it); undirected adds those in the other direction
+func steps(storage storage.Reader, id string, forward, undirected bool) []step {
+	var result []step
+	if forward || undirected {
+		for _, e := range storage.GetEdgesFrom(id) {
+			result = append(result, step{edge: e, other: e.To})
+		}
+	}
+	if !forward || undirected {
+		for _, e := range storage.GetEdgesTo(id) {
+			if undirected && e.From == e.To {
+				continue // a loop is already listed
 			}
-
-			newRow := copyMap(row)
-			// newRow := map[string]*types.Node{}
-			newRow[toVar] = toNode
-
-			// Node/prop filters applied later
-			expanded = append(expanded, newRow)
+			result = append(result, step{edge: e, other: e.From})
 		}
 	}
-
-	return expanded
+	return result
 }
 
 func (qe *DefaultQueryEngine) matchEdgeFilters(edge *types.Edge, filters []query.Filter) bool {
@@ -179,14 +133,44 @@ func copyMap(m map[string]*types.Node) map[string]*types.Node {
 	return cp
 }
 
-func filterNodesByLabel(nodes []*types.Node, label string) []*types.Node {
-	var filtered []*types.Node
-	for _, n := range nodes {
-		if n.Label == label {
-			filtered = append(filtered, n)
+// startNodes returns the nodes the first pattern node may bind to: the one
+// its ID is compared to, if any, else those of the graph, read one at a
+// time if the storage can; scanOp keeps those of the label and subgraph
+func startNodes(r storage.Reader, plan *query.QueryPlan) storage.NodeCursor {
+	first := plan.Nodes[0]
+	for _, f := range plan.Filters {
+		id, ok := f.Value.(string)
+		if f.Field != first.Var || f.Op != "=" || !ok {
+			continue
+		}
+		n, found := r.GetNode(id)
+		if !found {
+			return &sliceCursor{}
 		}
+		return &sliceCursor{nodes: []*types.Node{n}}
+	}
+
+	if scanner, ok := r.(storage.NodeScanner); ok {
+		return scanner.ScanNodes()
+	}
+	if plan.Subgraph != "" {
+		return &sliceCursor{nodes: r.GetNodesIn(plan.Subgraph)}
 	}
-	return filtered
+	return &sliceCursor{nodes: r.GetAllNodes()}
+}
+
+// sliceCursor yields nodes a storage has already read
+type sliceCursor struct {
+	nodes []*types.Node
+}
+
+func (c *sliceCursor) Next() (*types.Node, bool) {
+	if len(c.nodes) == 0 {
+		return nil, false
+	}
+	n := c.nodes[0]
+	c.nodes = c.nodes[1:]
+	return n, true
 }
 
 func compare(a any, op string, b any) bool {
@@ -207,6 +191,18 @@ func compare(a any, op string, b any) bool {
 				return ai < bi
 			}
 		}
+	case ">=":
+		if ai, ok := toFloat(a); ok {
+			if bi, ok := toFloat(b); ok {
+				return ai >= bi
+			}
+		}
+	case "<=":
+		if ai, ok := toFloat(a); ok {
+			if bi, ok := toFloat(b); ok {
+				return ai <= bi
+			}
+		}
 	}
 	return false
 }
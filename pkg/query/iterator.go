@@ -0,0 +1,249 @@
+package query
+
+import (
+	"context"
+
+	"github.com/aprksy/knitknot/pkg/ports/query"
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+var _ query.ResultIterator = (*ResultIterator)(nil)
+
+// operator is one stage of a query pipeline. next returns the stage's
+// next row, or nil once it has no more.
+type operator interface {
+	next(ctx context.Context) (map[string]*types.Node, error)
+}
+
+// scanOp binds the first pattern node to each of its candidates, pulling
+// them from the storage as it goes
+type scanOp struct {
+	varName  string
+	label    string
+	subgraph string
+	nodes    storage.NodeCursor
+}
+
+func (op *scanOp) next(ctx context.Context) (map[string]*types.Node, error) {
+	for {
+		n, ok := op.nodes.Next()
+		if !ok {
+			return nil, nil
+		}
+		if !n.HasLabel(op.label) || (op.subgraph != "" && !n.InSubgraph(op.subgraph)) {
+			continue
+		}
+		return map[string]*types.Node{op.varName: n}, nil
+	}
+}
+
+// expandOp extends each row of its input along an edge pattern. Only the
+// rows grown from a single input row are held at once.
+type expandOp struct {
+	qe       *DefaultQueryEngine
+	input    operator
+	storage  storage.Reader
+	pattern  *query.PatternEdge
+	nodes    []*query.PatternNode
+	subgraph string
+	allowed  map[string]bool
+	pending  []map[string]*types.Node
+}
+
+func (op *expandOp) next(ctx context.Context) (map[string]*types.Node, error) {
+	for len(op.pending) == 0 {
+		row, err := op.input.next(ctx)
+		if row == nil || err != nil {
+			return nil, err
+		}
+		op.pending = op.expand(row)
+	}
+	row := op.pending[0]
+	op.pending = op.pending[1:]
+	return row, nil
+}
+
+func (op *expandOp) expand(row map[string]*types.Node) []map[string]*types.Node {
+	// Follow the edge from whichever end is bound; From usually is
+	bound, other, forward := op.pattern.From, op.pattern.To, true
+	if _, ok := row[bound]; !ok {
+		bound, other, forward = op.pattern.To, op.pattern.From, false
+	}
+	boundNode, ok := row[bound]
+	if !ok {
+		return nil
+	}
+
+	var expanded []map[string]*types.Node
+	for _, step := range steps(op.storage, boundNode.ID, forward, op.pattern.Undirected) {
+		e := step.edge
+		if e.Kind != op.pattern.Kind || (op.allowed != nil && !op.allowed[e.ID]) {
+			continue
+		}
+
+		// Check edge filters BEFORE accepting
+		if !op.qe.matchEdgeFilters(e, op.pattern.Filters) {
+			continue
+		}
+
+		otherNode, ok := op.storage.GetNode(step.other)
+		if !ok || (op.subgraph != "" && !otherNode.InSubgraph(op.subgraph)) {
+			continue
+		}
+
+		expectedLabel := op.qe.findLabelForVar(other, op.nodes)
+		if expectedLabel != "" && !otherNode.HasLabel(expectedLabel) {
+			continue
+		}
+
+		newRow := copyMap(row)
+		newRow[other] = otherNode
+		expanded = append(expanded, newRow)
+	}
+	return expanded
+}
+
+// filterOp drops the rows that fail the plan's filters, which may
+// involve several variables
+type filterOp struct {
+	qe      *DefaultQueryEngine
+	input   operator
+	filters []query.Filter
+}
+
+func (op *filterOp) next(ctx context.Context) (map[string]*types.Node, error) {
+	for {
+		row, err := op.input.next(ctx)
+		if row == nil || err != nil {
+			return nil, err
+		}
+		if op.qe.matchFilters(row, op.filters) {
+			return row, nil
+		}
+	}
+}
+
+// limitOp stops pulling from its input once it has passed n rows
+type limitOp struct {
+	input operator
+	n     int
+}
+
+func (op *limitOp) next(ctx context.Context) (map[string]*types.Node, error) {
+	if op.n <= 0 {
+		return nil, nil
+	}
+	row, err := op.input.next(ctx)
+	if row != nil {
+		op.n--
+	}
+	return row, err
+}
+
+// emptyOp yields no rows
+type emptyOp struct{}
+
+func (emptyOp) next(ctx context.Context) (map[string]*types.Node, error) {
+	return nil, nil
+}
+
+// ResultIterator pulls rows through a pipeline of operators, so a query
+// only does as much work as its caller reads.
+type ResultIterator struct {
+	root operator
+	row  map[string]*types.Node
+	err  error
+	done bool
+}
+
+func newResultIterator(root operator) *ResultIterator {
+	return &ResultIterator{root: root}
+}
+
+// Next advances to the next row and reports whether there is one
+func (it *ResultIterator) Next(ctx context.Context) bool {
+	if it.done {
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		it.stop(err)
+		return false
+	}
+	row, err := it.root.next(ctx)
+	if row == nil || err != nil {
+		it.stop(err)
+		return false
+	}
+	it.row = row
+	return true
+}
+
+func (it *ResultIterator) stop(err error) {
+	it.row, it.err, it.done = nil, err, true
+}
+
+// Row returns the current row; nil before the first Next or after the last
+func (it *ResultIterator) Row() map[string]*types.Node {
+	return it.row
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *ResultIterator) Err() error {
+	return it.err
+}
+
+// Close ends the iteration; closing more than once is harmless
+func (it *ResultIterator) Close() error {
+	it.root, it.row, it.done = emptyOp{}, nil, true
+	return nil
+}
+
+// Iterate builds the pipeline for a plan without running it
+func (qe *DefaultQueryEngine) Iterate(
+	ctx context.Context,
+	storage storage.Reader,
+	plan *query.QueryPlan,
+) (query.ResultIterator, error) {
+	if len(plan.Nodes) == 0 {
+		return newResultIterator(emptyOp{}), nil
+	}
+
+	first := plan.Nodes[0]
+	var root operator = &scanOp{
+		varName:  first.Var,
+		label:    first.Label,
+		subgraph: plan.Subgraph,
+		nodes:    startNodes(storage, plan),
+	}
+
+	// Within a subgraph, follow only the edges that belong to it
+	var allowed map[string]bool
+	if plan.Subgraph != "" && len(plan.Edges) > 0 {
+		allowed = make(map[string]bool)
+		for _, e := range storage.GetEdgesIn(plan.Subgraph) {
+			allowed[e.ID] = true
+		}
+	}
+
+	for _, edgePattern := range plan.Edges {
+		root = &expandOp{
+			qe:       qe,
+			input:    root,
+			storage:  storage,
+			pattern:  edgePattern,
+			nodes:    plan.Nodes,
+			subgraph: plan.Subgraph,
+			allowed:  allowed,
+		}
+	}
+
+	if len(plan.Filters) > 0 {
+		root = &filterOp{qe: qe, input: root, filters: plan.Filters}
+	}
+	if plan.LimitVal != nil {
+		root = &limitOp{input: root, n: *plan.LimitVal}
+	}
+
+	return newResultIterator(root), nil
+}
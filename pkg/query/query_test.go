@@ -8,6 +8,7 @@ import (
 
 	"github.com/aprksy/knitknot/pkg/graph"
 	q "github.com/aprksy/knitknot/pkg/ports/query"
+	"github.com/aprksy/knitknot/pkg/ports/storage"
 	"github.com/aprksy/knitknot/pkg/ports/types"
 	"github.com/aprksy/knitknot/pkg/query"
 	"github.com/aprksy/knitknot/pkg/storage/inmem"
@@ -106,6 +107,23 @@ var _ = Describe("DefaultQueryEngine", func() {
 		)
 	})
 
+	Context("when filtering on a bare variable", func() {
+		It("should compare the node ID", func() {
+			beforeEach()
+			_, _ = engine.AddNode("User", map[string]any{"name": "Alice"})
+			bobID, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
+
+			plan := &q.QueryPlan{
+				Nodes:   []*q.PatternNode{{Var: "n", Label: "User"}},
+				Filters: []q.Filter{{Field: "n", Op: "=", Value: bobID}},
+			}
+			result, err := qe.Execute(context.Background(), storage, plan)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+			Expect(result.Items()[0]["n"].ID).To(Equal(bobID))
+		})
+	})
+
 	Context("with edge traversal", func() {
 		It("should follow Has relationship", func() {
 			// Register verb
@@ -117,7 +135,7 @@ var _ = Describe("DefaultQueryEngine", func() {
 			// Create data
 			aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
 			goID, _ := engine.AddNode("Skill", map[string]any{"name": "Go"})
-			_ = engine.AddEdge(aliceID, goID, "has_skill", nil)
+			_, _ = engine.AddEdge(aliceID, goID, "has_skill", nil)
 
 			// Build plan manually
 			plan := &q.QueryPlan{
@@ -141,6 +159,27 @@ var _ = Describe("DefaultQueryEngine", func() {
 			Expect(row).To(HaveKey("n"))
 			Expect(row["n"].Props["name"]).To(Equal("Alice"))
 		})
+		It("should follow edges from a bound target and both ways when undirected", func() {
+			aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+			bobID, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
+			_, _ = engine.AddEdge(aliceID, bobID, "knows", nil)
+
+			plan := &q.QueryPlan{
+				Nodes:   []*q.PatternNode{{Var: "n", Label: "User"}, {Var: "v0", Label: "User"}},
+				Edges:   []*q.PatternEdge{{From: "v0", To: "n", Kind: "knows"}},
+				Filters: []q.Filter{{Field: "n.name", Op: "=", Value: "Bob"}},
+			}
+			result, err := qe.Execute(context.Background(), storage, plan)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+			Expect(result.Items()[0]["v0"].ID).To(Equal(aliceID))
+
+			plan.Edges = []*q.PatternEdge{{From: "n", To: "v0", Kind: "knows", Undirected: true}}
+			plan.Filters = nil
+			result, err = qe.Execute(context.Background(), storage, plan)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(2))
+		})
 	})
 
 	Context("with edge property filter", func() {
@@ -153,8 +192,8 @@ var _ = Describe("DefaultQueryEngine", func() {
 			userID1, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
 			userID2, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
 			projID, _ := engine.AddNode("Project", map[string]any{"name": "KnitKnot"})
-			_ = engine.AddEdge(userID1, projID, "contributes_to", map[string]any{"level": 5})
-			_ = engine.AddEdge(userID2, projID, "contributes_to", map[string]any{"level": 2})
+			_, _ = engine.AddEdge(userID1, projID, "contributes_to", map[string]any{"level": 5})
+			_, _ = engine.AddEdge(userID2, projID, "contributes_to", map[string]any{"level": 2})
 
 			plan := &q.QueryPlan{
 				Nodes: []*q.PatternNode{
@@ -177,4 +216,198 @@ var _ = Describe("DefaultQueryEngine", func() {
 			Expect(result.Len()).To(Equal(1))
 		})
 	})
+
+	Context("within a subgraph", func() {
+		It("should only match and follow member nodes", func() {
+			beforeEach()
+			engine.RegisterVerb("knows", types.Verb{TargetLabel: "User", MatchOn: "name"})
+			aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+			bobID, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
+			carolID, _ := engine.AddNode("User", map[string]any{"name": "Carol"})
+			_, _ = engine.AddEdge(aliceID, bobID, "knows", nil)
+			_, _ = engine.AddEdge(aliceID, carolID, "knows", nil)
+			Expect(engine.CreateSubgraph("org", "")).To(Succeed())
+			Expect(engine.AddNodesToSubgraph("org", []string{aliceID, bobID})).To(Succeed())
+
+			result, err := engine.Find("User").In("org").Exec(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(2))
+
+			plan := &q.QueryPlan{
+				Nodes:    []*q.PatternNode{{Var: "n", Label: "User"}, {Var: "v0", Label: "User"}},
+				Edges:    []*q.PatternEdge{{From: "n", To: "v0", Kind: "knows"}},
+				Subgraph: "org",
+			}
+			result, err = qe.Execute(context.Background(), storage, plan)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+			Expect(result.Items()[0]["v0"].ID).To(Equal(bobID))
+		})
+
+		It("should only follow member edges of an explicit subgraph", func() {
+			beforeEach()
+			aliceID, _ := engine.AddNode("User", map[string]any{"name": "Alice"})
+			bobID, _ := engine.AddNode("User", map[string]any{"name": "Bob"})
+			knows, _ := engine.AddEdge(aliceID, bobID, "knows", nil)
+			_, _ = engine.AddEdge(aliceID, bobID, "knows", map[string]any{"since": 2020})
+			Expect(engine.CreateSubgraph("org", "")).To(Succeed())
+			Expect(engine.AddNodesToSubgraph("org", []string{aliceID, bobID})).To(Succeed())
+			Expect(engine.AddEdgeToSubgraph("org", knows)).To(Succeed())
+
+			plan := &q.QueryPlan{
+				Nodes:    []*q.PatternNode{{Var: "n", Label: "User"}, {Var: "v0", Label: "User"}},
+				Edges:    []*q.PatternEdge{{From: "n", To: "v0", Kind: "knows"}},
+				Subgraph: "org",
+			}
+			result, err := qe.Execute(context.Background(), storage, plan)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(2))
+
+			Expect(engine.SetSubgraphMode("org", types.SubgraphExplicit)).To(Succeed())
+			result, err = qe.Execute(context.Background(), storage, plan)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+		})
+	})
+
+	Context("when iterating", func() {
+		var plan *q.QueryPlan
+
+		setup := func() {
+			beforeEach()
+			for _, name := range []string{"Alice", "Bob", "Carol"} {
+				userID, _ := engine.AddNode("User", map[string]any{"name": name})
+				skillID, _ := engine.AddNode("Skill", map[string]any{"name": name + "'s skill"})
+				_, _ = engine.AddEdge(userID, skillID, "has_skill", nil)
+			}
+			plan = &q.QueryPlan{
+				Nodes: []*q.PatternNode{{Var: "n", Label: "User"}, {Var: "v0", Label: "Skill"}},
+				Edges: []*q.PatternEdge{{From: "n", To: "v0", Kind: "has_skill"}},
+			}
+		}
+
+		It("should stream the rows Execute returns", func() {
+			setup()
+			ctx := context.Background()
+			it, err := qe.Iterate(ctx, storage, plan)
+			Expect(err).NotTo(HaveOccurred())
+			defer it.Close()
+
+			var names []any
+			for it.Next(ctx) {
+				Expect(it.Row()).To(HaveKey("v0"))
+				names = append(names, it.Row()["n"].Props["name"])
+			}
+			Expect(it.Err()).NotTo(HaveOccurred())
+			Expect(it.Row()).To(BeNil())
+			Expect(names).To(ConsistOf("Alice", "Bob", "Carol"))
+		})
+
+		It("should stop pulling rows once the limit is reached", func() {
+			setup()
+			limit := 1
+			plan.LimitVal = &limit
+			reader := &countingReader{Reader: storage}
+
+			ctx := context.Background()
+			it, err := qe.Iterate(ctx, reader, plan)
+			Expect(err).NotTo(HaveOccurred())
+			defer it.Close()
+			Expect(it.Next(ctx)).To(BeTrue())
+			Expect(it.Next(ctx)).To(BeFalse())
+			Expect(reader.edgesFrom).To(Equal(1))
+
+			result, err := qe.Execute(ctx, reader, plan)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Len()).To(Equal(1))
+			Expect(reader.edgesFrom).To(Equal(2))
+		})
+
+		It("should read the start nodes one at a time from a scanning storage", func() {
+			setup()
+			limit := 1
+			plan.LimitVal = &limit
+			reader := &scanningReader{Storage: storage}
+
+			ctx := context.Background()
+			it, err := qe.Iterate(ctx, reader, plan)
+			Expect(err).NotTo(HaveOccurred())
+			defer it.Close()
+			Expect(it.Next(ctx)).To(BeTrue())
+			Expect(it.Next(ctx)).To(BeFalse())
+			Expect(reader.allNodes).To(BeZero())
+			// At worst the three skills come before the first user
+			Expect(reader.scanned).To(BeNumerically("<=", 4))
+		})
+
+		It("should stop with the context's error when it is cancelled", func() {
+			setup()
+			ctx, cancel := context.WithCancel(context.Background())
+			it, err := qe.Iterate(ctx, storage, plan)
+			Expect(err).NotTo(HaveOccurred())
+			defer it.Close()
+
+			Expect(it.Next(ctx)).To(BeTrue())
+			cancel()
+			Expect(it.Next(ctx)).To(BeFalse())
+			Expect(it.Err()).To(MatchError(context.Canceled))
+
+			_, err = qe.Execute(ctx, storage, plan)
+			Expect(err).To(MatchError(context.Canceled))
+		})
+
+		It("should yield no more rows once closed", func() {
+			setup()
+			ctx := context.Background()
+			it, err := qe.Iterate(ctx, storage, plan)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(it.Next(ctx)).To(BeTrue())
+			Expect(it.Close()).To(Succeed())
+			Expect(it.Close()).To(Succeed())
+			Expect(it.Next(ctx)).To(BeFalse())
+			Expect(it.Row()).To(BeNil())
+			Expect(it.Err()).NotTo(HaveOccurred())
+		})
+	})
 })
+
+// countingReader counts the edge lookups a query makes
+type countingReader struct {
+	storage.Reader
+	edgesFrom int
+}
+
+func (r *countingReader) GetEdgesFrom(id string) []*types.Edge {
+	r.edgesFrom++
+	return r.Reader.GetEdgesFrom(id)
+}
+
+// scanningReader counts the nodes a query reads, one at a time or all at once
+type scanningReader struct {
+	*inmem.Storage
+	allNodes int
+	scanned  int
+}
+
+func (r *scanningReader) GetAllNodes() []*types.Node {
+	r.allNodes++
+	return r.Storage.GetAllNodes()
+}
+
+func (r *scanningReader) ScanNodes() storage.NodeCursor {
+	return &countingCursor{NodeCursor: r.Storage.ScanNodes(), n: &r.scanned}
+}
+
+type countingCursor struct {
+	storage.NodeCursor
+	n *int
+}
+
+func (c *countingCursor) Next() (*types.Node, bool) {
+	n, ok := c.NodeCursor.Next()
+	if ok {
+		*c.n++
+	}
+	return n, ok
+}
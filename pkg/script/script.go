@@ -0,0 +1,177 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Statement is a single command extracted from a script
+type Statement struct {
+	Text   string // statement source, trimmed
+	Line   int    // 1-based line where the statement starts
+	Offset int    // byte offset in the script where the statement starts
+
+	lines []int // byte offset in the script of each line of Text after the first
+}
+
+// SourceOffset converts a byte offset in Text to one in the script. Text
+// leaves out comments and blank lines, so the two can differ by more than
+// Offset.
+func (s Statement) SourceOffset(i int) int {
+	line, lineStart := 0, 0
+	for j := 0; j < i && j < len(s.Text); j++ {
+		if s.Text[j] == '\n' {
+			line, lineStart = line+1, j+1
+		}
+	}
+	if line == 0 {
+		return s.Offset + i
+	}
+	return s.lines[line-1] + i - lineStart
+}
+
+// SyntaxError reports a statement that could not be delimited
+type SyntaxError struct {
+	Line int
+	Msg  string
+
+	open bool // the script ended inside a string or parentheses
+}
+
+func (e *SyntaxError) Error() string { return fmt.Sprintf("line %d: %s", e.Line, e.Msg) }
+
+// Parse splits a script into statements.
+//
+// Statements are separated by ';' or newlines. A newline does not end a
+// statement while parentheses are still open, or when the next non-blank
+// line starts with '.' (a continued DSL chain). Lines whose first
+// non-blank characters are "--" are comments, and so is the rest of a
+// line after a " -- " outside quotes, unless a "-->" follows it (a
+// spaced CONNECT arrow). Separators inside quoted strings, and characters
+// escaped with '\', are kept as-is.
+func Parse(src string) ([]Statement, error) {
+	var (
+		stmts  []Statement
+		cur    strings.Builder
+		starts []int // offsets of the lines of cur after the first
+		start  int
+		pos    int
+		depth  int
+		quote  byte
+	)
+
+	flush := func() {
+		text := strings.TrimSpace(cur.String())
+		if text != "" {
+			stmts = append(stmts, Statement{Text: text, Line: start, Offset: pos, lines: starts})
+		}
+		cur.Reset()
+		starts = nil
+		start = 0
+		depth = 0
+	}
+
+	lineStart := 0
+	lines := strings.Split(src, "\n")
+	for i, raw := range lines {
+		lineNo := i + 1
+		offset := lineStart
+		lineStart += len(raw) + 1
+		line := strings.TrimRight(raw, "\r")
+		trimmed := strings.TrimSpace(line)
+
+		if quote == 0 {
+			if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+				continue
+			}
+			// A line that does not continue the previous one ends it
+			if cur.Len() > 0 && depth == 0 && !strings.HasPrefix(trimmed, ".") {
+				flush()
+			}
+		}
+
+		if cur.Len() > 0 {
+			cur.WriteByte('\n')
+			// Blanks before the statement are trimmed along with this newline
+			if start != 0 {
+				starts = append(starts, offset)
+			}
+		}
+
+		for j := 0; j < len(line); j++ {
+			ch := line[j]
+			if quote == 0 && isComment(line, j) {
+				break
+			}
+			if start == 0 && ch != ' ' && ch != '\t' && ch != ';' {
+				start = lineNo
+				pos = offset + j
+			}
+
+			switch {
+			case quote != 0:
+				if ch == '\\' && j+1 < len(line) {
+					cur.WriteByte(ch)
+					j++
+					ch = line[j]
+				} else if ch == quote {
+					quote = 0
+				}
+			case ch == '\\' && j+1 < len(line):
+				// An escaped quote outside a string does not open one
+				cur.WriteByte(ch)
+				j++
+				ch = line[j]
+			case ch == '\'' || ch == '"':
+				quote = ch
+			case ch == '(':
+				depth++
+			case ch == ')':
+				if depth == 0 {
+					return nil, &SyntaxError{Line: lineNo, Msg: "unbalanced parentheses"}
+				}
+				depth--
+			case ch == ';':
+				flush()
+				continue
+			}
+			cur.WriteByte(ch)
+		}
+	}
+
+	if quote != 0 {
+		return nil, &SyntaxError{Line: start, Msg: "unterminated string", open: true}
+	}
+	if depth > 0 {
+		return nil, &SyntaxError{Line: start, Msg: "unbalanced parentheses", open: true}
+	}
+	flush()
+
+	return stmts, nil
+}
+
+// isComment reports whether a trailing comment starts at line[i]: a "--"
+// with blanks (or the line's ends) on both sides, so that CONNECT arrows
+// such as "--knows-->" are not mistaken for one. A "--" that a "-->"
+// follows starts a spaced arrow, "a -- knows --> b", not a comment.
+func isComment(line string, i int) bool {
+	if !strings.HasPrefix(line[i:], "--") {
+		return false
+	}
+	before := i == 0 || line[i-1] == ' ' || line[i-1] == '\t'
+	after := i+2 == len(line) || line[i+2] == ' ' || line[i+2] == '\t'
+	return before && after && !strings.Contains(line[i+2:], "-->")
+}
+
+// Incomplete reports whether src needs more input before it can be run:
+// a string or parenthesis is still open, or the text ends with '.'. A
+// stray ')' is an error more input cannot fix, so it is not incomplete.
+func Incomplete(src string) bool {
+	if strings.HasSuffix(strings.TrimSpace(src), ".") {
+		return true
+	}
+	_, err := Parse(src)
+	var se *SyntaxError
+	return errors.As(err, &se) && se.open
+}
@@ -0,0 +1,173 @@
+package script_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aprksy/knitknot/pkg/script"
+)
+
+var _ = Describe("Script Parser", func() {
+	texts := func(stmts []script.Statement) []string {
+		var out []string
+		for _, s := range stmts {
+			out = append(out, s.Text)
+		}
+		return out
+	}
+
+	It("should split statements on newlines", func() {
+		stmts, err := script.Parse("ADDNODE User name=Alice\nADDNODE Skill name=Go\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(texts(stmts)).To(Equal([]string{
+			"ADDNODE User name=Alice",
+			"ADDNODE Skill name=Go",
+		}))
+		Expect(stmts[1].Line).To(Equal(2))
+	})
+
+	It("should split statements on semicolons", func() {
+		stmts, err := script.Parse("VERBS; Find('User');")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(texts(stmts)).To(Equal([]string{"VERBS", "Find('User')"}))
+	})
+
+	It("should skip comments and blank lines", func() {
+		src := "-- setup\n\nDEFINE has_skill TO Skill VIA name\n  -- indented comment\nVERBS"
+		stmts, err := script.Parse(src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(texts(stmts)).To(Equal([]string{"DEFINE has_skill TO Skill VIA name", "VERBS"}))
+		Expect(stmts[0].Line).To(Equal(3))
+		Expect(stmts[1].Line).To(Equal(5))
+	})
+
+	It("should not treat CONNECT arrows as comments", func() {
+		stmts, err := script.Parse("CONNECT n1 --has_skill--> n2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(texts(stmts)).To(Equal([]string{"CONNECT n1 --has_skill--> n2"}))
+	})
+
+	It("should not treat spaced CONNECT arrows as comments", func() {
+		stmts, err := script.Parse("CONNECT n1 -- has_skill level=3 --> n2 -- mentor\nVERBS")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(texts(stmts)).To(Equal([]string{"CONNECT n1 -- has_skill level=3 --> n2", "VERBS"}))
+	})
+
+	It("should strip trailing comments outside quotes", func() {
+		src := "ADDNODE User name='x' -- note\nFind('a -- b').Limit(1) --\nVERBS;\t-- done"
+		stmts, err := script.Parse(src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(texts(stmts)).To(Equal([]string{
+			"ADDNODE User name='x'",
+			"Find('a -- b').Limit(1)",
+			"VERBS",
+		}))
+	})
+
+	It("should not let a trailing comment open parentheses or strings", func() {
+		stmts, err := script.Parse("Find('User') -- (it's\nVERBS")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(texts(stmts)).To(Equal([]string{"Find('User')", "VERBS"}))
+	})
+
+	It("should handle escaped quotes", func() {
+		src := `ADDNODE User name='O\'Brien'; Find('a\\').Limit(1) -- c` + "\nADDNODE User name=it\\'s -- quote"
+		stmts, err := script.Parse(src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(texts(stmts)).To(Equal([]string{
+			`ADDNODE User name='O\'Brien'`,
+			`Find('a\\').Limit(1)`,
+			`ADDNODE User name=it\'s`,
+		}))
+	})
+
+	It("should keep separators inside quotes", func() {
+		stmts, err := script.Parse("Find('a;b').Where('n.x', '=', \"(\")")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stmts).To(HaveLen(1))
+	})
+
+	It("should join chains continued on the next line", func() {
+		src := "Find('User')\n  .Has('has_skill', 'Go')\n  .Limit(5)\nVERBS"
+		stmts, err := script.Parse(src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stmts).To(HaveLen(2))
+		Expect(stmts[0].Text).To(ContainSubstring(".Limit(5)"))
+		Expect(stmts[0].Line).To(Equal(1))
+	})
+
+	It("should join lines while parentheses are open", func() {
+		src := "Find('User').Where(\n  'n.age', '>', 30\n)"
+		stmts, err := script.Parse(src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stmts).To(HaveLen(1))
+	})
+
+	It("should record the byte offset of each statement", func() {
+		src := "VERBS;  Find('User')\n  ADDNODE X"
+		stmts, err := script.Parse(src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stmts).To(HaveLen(3))
+		for _, s := range stmts {
+			Expect(src[s.Offset:]).To(HavePrefix(s.Text))
+		}
+	})
+
+	It("should map offsets in a statement back to the script", func() {
+		src := "VERBS; Find('User')\n  -- seniors\n\n  .Limit(3)"
+		stmts, err := script.Parse(src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stmts).To(HaveLen(2))
+
+		chain := stmts[1]
+		Expect(chain.Text).To(Equal("Find('User')\n  .Limit(3)"))
+		for _, word := range []string{"Find", "User", "Limit", "3"} {
+			i := strings.Index(chain.Text, word)
+			Expect(src[chain.SourceOffset(i):]).To(HavePrefix(word))
+		}
+	})
+
+	It("should reject unterminated strings", func() {
+		_, err := script.Parse("Find('User)")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("unterminated string"))
+	})
+
+	It("should reject unbalanced parentheses", func() {
+		_, err := script.Parse("Find('User'")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject a stray closing parenthesis on its line", func() {
+		_, err := script.Parse("VERBS\nFind('User'))\nADDNODE User name=Alice\nVERBS")
+		Expect(err).To(MatchError("line 2: unbalanced parentheses"))
+	})
+
+	It("should not count parentheses in strings", func() {
+		stmts, err := script.Parse("Find('User').Where('n.name', '=', ':)')\nVERBS")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stmts).To(HaveLen(2))
+	})
+
+	Describe("Incomplete", func() {
+		It("should ask for more input while parentheses are open", func() {
+			Expect(script.Incomplete("Find('User').Where(")).To(BeTrue())
+			Expect(script.Incomplete("Find('User').Where(\n'n.age', '>', 3)")).To(BeFalse())
+		})
+
+		It("should ask for more input after a trailing dot", func() {
+			Expect(script.Incomplete("Find('User').")).To(BeTrue())
+		})
+
+		It("should ask for more input inside a string", func() {
+			Expect(script.Incomplete("Find('Us")).To(BeTrue())
+		})
+
+		It("should accept complete commands", func() {
+			Expect(script.Incomplete("ADDNODE User name=Alice")).To(BeFalse())
+			Expect(script.Incomplete("Find('User'))")).To(BeFalse())
+		})
+	})
+})
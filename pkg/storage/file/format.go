@@ -1,15 +1,133 @@
 package file
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/aprksy/knitknot/pkg/ports/types"
 )
 
 // SavedGraph represents serialized state
 type SavedGraph struct {
-	Version string                 `json:"version"`
-	Nodes   map[string]*types.Node `json:"nodes"`
-	Edges   map[string]*types.Edge `json:"edges"`
-	Verbs   map[string]types.Verb  `json:"verbs"`
+	Version   string                       `json:"version"`
+	Nodes     map[string]*Node             `json:"nodes"`
+	Edges     map[string]*Edge             `json:"edges"`
+	Verbs     map[string]types.Verb        `json:"verbs"`
+	Schemas   map[string]types.LabelSchema `json:"schemas,omitempty"`
+	Subgraphs map[string]*types.Subgraph   `json:"subgraphs"`
+	Indexes   []types.PropertyIndex        `json:"indexes,omitempty"`
+	// Constraints are checked again when the graph is loaded
+	Constraints     []types.Constraint `json:"constraints,omitempty"`
+	DefaultSubgraph string             `json:"default_subgraph,omitempty"`
+	IDs             IDGenState         `json:"ids"`
+	EdgeIDs         IDGenState         `json:"edge_ids"`
+}
+
+// Node is a saved node. Older files stored a single Label (v0.1) and a
+// copy of each subgraph in the node (up to v0.2); Migrate moves them to
+// Labels and InSubgraphs.
+type Node struct {
+	ID          string                     `json:"id"`
+	Label       string                     `json:"label,omitempty"`
+	Labels      []string                   `json:"labels"`
+	Props       map[string]any             `json:"props"`
+	Subgraphs   map[string]*types.Subgraph `json:"subgraphs,omitempty"`
+	InSubgraphs []string                   `json:"in_subgraphs,omitempty"`
+}
+
+func NewNode(n *types.Node) *Node {
+	return &Node{ID: n.ID, Labels: n.Labels, Props: n.Props, InSubgraphs: n.Subgraphs}
+}
+
+func (n *Node) ToNode() *types.Node {
+	return &types.Node{ID: n.ID, Labels: n.Labels, Props: n.Props, Subgraphs: n.InSubgraphs}
+}
+
+// Edge is a saved edge; see Node for the old Subgraphs field
+type Edge struct {
+	ID          string                     `json:"id"`
+	From        string                     `json:"from"`
+	To          string                     `json:"to"`
+	Kind        string                     `json:"kind"`
+	Props       map[string]any             `json:"props"`
+	Subgraphs   map[string]*types.Subgraph `json:"subgraphs,omitempty"`
+	InSubgraphs []string                   `json:"in_subgraphs,omitempty"`
+}
+
+func NewEdge(e *types.Edge) *Edge {
+	return &Edge{ID: e.ID, From: e.From, To: e.To, Kind: e.Kind, Props: e.Props, InSubgraphs: e.Subgraphs}
 }
 
-const CurrentVersion = "knitknot/v0.1"
+func (e *Edge) ToEdge() *types.Edge {
+	return &types.Edge{ID: e.ID, From: e.From, To: e.To, Kind: e.Kind, Props: e.Props, Subgraphs: e.InSubgraphs}
+}
+
+// IDGenState is an ID generator of a saved graph, so that IDs made
+// after loading it follow the same scheme and do not repeat
+type IDGenState struct {
+	Scheme string `json:"scheme"`
+	State  string `json:"state,omitempty"`
+}
+
+const CurrentVersion = "knitknot/v0.3"
+
+// Older formats Migrate can read
+const (
+	versionSingleLabel    = "knitknot/v0.1"
+	versionSubgraphCopies = "knitknot/v0.2"
+)
+
+// Migrate upgrades a graph read from an older file to CurrentVersion
+func (g *SavedGraph) Migrate() error {
+	switch g.Version {
+	case versionSingleLabel:
+		for _, n := range g.Nodes {
+			if len(n.Labels) == 0 && n.Label != "" {
+				n.Labels = []string{n.Label}
+			}
+			n.Label = ""
+		}
+		fallthrough
+	case versionSubgraphCopies:
+		g.migrateSubgraphs()
+	case CurrentVersion:
+	default:
+		return fmt.Errorf("unsupported version: %s (expected %s)", g.Version, CurrentVersion)
+	}
+	g.Version = CurrentVersion
+	return nil
+}
+
+// migrateSubgraphs builds the registry from the per-record copies
+func (g *SavedGraph) migrateSubgraphs() {
+	if g.Subgraphs == nil {
+		g.Subgraphs = make(map[string]*types.Subgraph)
+	}
+	register := func(copies map[string]*types.Subgraph) []string {
+		names := make([]string, 0, len(copies))
+		for name, sg := range copies {
+			if _, ok := g.Subgraphs[name]; !ok {
+				g.Subgraphs[name] = &types.Subgraph{Name: name}
+				if sg != nil {
+					g.Subgraphs[name].Description = sg.Description
+				}
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	for _, n := range g.Nodes {
+		if len(n.Subgraphs) > 0 {
+			n.InSubgraphs = register(n.Subgraphs)
+		}
+		n.Subgraphs = nil
+	}
+	for _, e := range g.Edges {
+		if len(e.Subgraphs) > 0 {
+			e.InSubgraphs = register(e.Subgraphs)
+		}
+		e.Subgraphs = nil
+	}
+}
@@ -1,9 +1,15 @@
 package inmem_test
 
 import (
+	"fmt"
+	"sync"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/aprksy/knitknot/pkg/idgen"
+	ports "github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/ports/types"
 	"github.com/aprksy/knitknot/pkg/storage/inmem"
 )
 
@@ -25,7 +31,7 @@ var _ = Describe("In-Memory Storage CRUD", func() {
 
 			node, ok := storage.GetNode(id)
 			Expect(ok).To(BeTrue())
-			Expect(node.Label).To(Equal("User"))
+			Expect(node.Labels).To(Equal([]string{"User"}))
 			Expect(node.Props["name"]).To(Equal("Alice"))
 			Expect(node.Props["age"]).To(Equal(35))
 		})
@@ -36,6 +42,45 @@ var _ = Describe("In-Memory Storage CRUD", func() {
 		})
 	})
 
+	Describe("AddNode IDs", func() {
+		It("should not run out of IDs", func() {
+			seen := map[string]bool{}
+			for range 20000 {
+				id, err := storage.AddNode("User", nil)
+				Expect(err).NotTo(HaveOccurred())
+				seen[id] = true
+			}
+			Expect(seen).To(HaveLen(20000))
+		})
+
+		It("should skip IDs taken by natural keys", func() {
+			Expect(storage.AddNodeWithID("n1", "User", nil)).To(Succeed())
+			id, err := storage.AddNode("User", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal("n2"))
+		})
+
+		It("should use an injected generator", func() {
+			storage.WithIDGenerator(idgen.NewCounter("user-"))
+			id, _ := storage.AddNode("User", nil)
+			Expect(id).To(Equal("user-1"))
+		})
+	})
+
+	Describe("AddNodeWithID", func() {
+		It("should store the node under the given key", func() {
+			Expect(storage.AddNodeWithID("alice", "User", map[string]any{"name": "Alice"})).To(Succeed())
+			n, ok := storage.GetNode("alice")
+			Expect(ok).To(BeTrue())
+			Expect(n.Props["name"]).To(Equal("Alice"))
+		})
+
+		It("should reject a key in use", func() {
+			Expect(storage.AddNodeWithID("alice", "User", nil)).To(Succeed())
+			Expect(storage.AddNodeWithID("alice", "User", nil)).To(MatchError(ports.ErrNodeExists))
+		})
+	})
+
 	Describe("UpdateNode", func() {
 		Context("when node exists", func() {
 			var nodeID string
@@ -69,7 +114,7 @@ var _ = Describe("In-Memory Storage CRUD", func() {
 				Expect(err).NotTo(HaveOccurred())
 
 				node, _ := storage.GetNode(nodeID)
-				Expect(node.Label).To(Equal("User")) // unchanged
+				Expect(node.Labels).To(Equal([]string{"User"})) // unchanged
 			})
 		})
 
@@ -93,7 +138,7 @@ var _ = Describe("In-Memory Storage CRUD", func() {
 		})
 
 		It("should create edge with kind and props", func() {
-			err := storage.AddEdge(fromID, toID, "has_skill", map[string]any{
+			_, err := storage.AddEdge(fromID, toID, "has_skill", map[string]any{
 				"level": 4,
 				"since": "2023-01-01",
 			})
@@ -108,16 +153,65 @@ var _ = Describe("In-Memory Storage CRUD", func() {
 		})
 
 		It("should fail if source node missing", func() {
-			err := storage.AddEdge("missing", toID, "rel", nil)
+			_, err := storage.AddEdge("missing", toID, "rel", nil)
 			Expect(err).To(HaveOccurred())
 		})
 
 		It("should fail if target node missing", func() {
-			err := storage.AddEdge(fromID, "missing", "rel", nil)
+			_, err := storage.AddEdge(fromID, "missing", "rel", nil)
 			Expect(err).To(HaveOccurred())
 		})
 	})
 
+	Describe("Parallel edges", func() {
+		var fromID, toID string
+
+		BeforeEach(func() {
+			fromID, _ = storage.AddNode("Customer", nil)
+			toID, _ = storage.AddNode("Product", nil)
+		})
+
+		It("should keep every edge of the same kind under its own ID", func() {
+			first, err := storage.AddEdge(fromID, toID, "purchase", map[string]any{"amount": 10})
+			Expect(err).NotTo(HaveOccurred())
+			second, err := storage.AddEdge(fromID, toID, "purchase", map[string]any{"amount": 20})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(second).NotTo(Equal(first))
+			Expect(storage.GetEdgesFrom(fromID)).To(HaveLen(2))
+
+			e, ok := storage.GetEdge(first)
+			Expect(ok).To(BeTrue())
+			Expect(e.Props["amount"]).To(Equal(10))
+		})
+
+		It("should delete one of them by ID only", func() {
+			first, _ := storage.AddEdge(fromID, toID, "purchase", nil)
+			second, _ := storage.AddEdge(fromID, toID, "purchase", nil)
+
+			Expect(storage.DeleteEdge(fromID, toID, "purchase")).To(MatchError(ports.ErrAmbiguousEdge))
+			Expect(storage.DeleteEdgeByID(first)).To(Succeed())
+			Expect(storage.DeleteEdgeByID(first)).NotTo(Succeed())
+
+			edges := storage.GetEdgesFrom(fromID)
+			Expect(edges).To(HaveLen(1))
+			Expect(edges[0].ID).To(Equal(second))
+			Expect(storage.DeleteEdge(fromID, toID, "purchase")).To(Succeed())
+		})
+
+		It("should merge into the single edge of a kind", func() {
+			id, err := storage.MergeEdge(fromID, toID, "reviewed", map[string]any{"stars": 3})
+			Expect(err).NotTo(HaveOccurred())
+			again, err := storage.MergeEdge(fromID, toID, "reviewed", map[string]any{"stars": 5})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(again).To(Equal(id))
+			edges := storage.GetEdgesFrom(fromID)
+			Expect(edges).To(HaveLen(1))
+			Expect(edges[0].Props["stars"]).To(Equal(5))
+		})
+	})
+
 	Describe("UpdateEdge", func() {
 		var fromID, toID, edgeID string
 
@@ -128,10 +222,8 @@ var _ = Describe("In-Memory Storage CRUD", func() {
 			toID, err = storage.AddNode("Skill", nil)
 			Expect(err).NotTo(HaveOccurred())
 
-			err = storage.AddEdge(fromID, toID, "has_skill", map[string]any{"level": 1})
+			edgeID, err = storage.AddEdge(fromID, toID, "has_skill", map[string]any{"level": 1})
 			Expect(err).NotTo(HaveOccurred())
-
-			edgeID = fromID + "->" + toID + "@has_skill"
 		})
 
 		It("should update edge properties", func() {
@@ -152,6 +244,88 @@ var _ = Describe("In-Memory Storage CRUD", func() {
 		})
 	})
 
+	Describe("PatchNode", func() {
+		var id string
+
+		BeforeEach(func() {
+			id, _ = storage.AddNode("User", map[string]any{"name": "Alice", "age": 40, "email": "a@x"})
+		})
+
+		It("should set and remove keys and keep the others", func() {
+			Expect(storage.PatchNode(id, map[string]any{"age": 41}, []string{"email", "missing"})).To(Succeed())
+
+			node, _ := storage.GetNode(id)
+			Expect(node.Props).To(Equal(map[string]any{"name": "Alice", "age": 41}))
+		})
+
+		It("should not lose concurrent patches of other keys", func() {
+			var wg sync.WaitGroup
+			for i := range 50 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_ = storage.PatchNode(id, map[string]any{fmt.Sprintf("k%d", i): i}, nil)
+				}()
+			}
+			wg.Wait()
+
+			node, _ := storage.GetNode(id)
+			Expect(node.Props).To(HaveLen(53))
+		})
+
+		It("should fail for a missing node", func() {
+			Expect(storage.PatchNode("missing", map[string]any{"x": 1}, nil)).NotTo(Succeed())
+		})
+	})
+
+	Describe("PatchEdge", func() {
+		It("should set and remove edge props", func() {
+			fromID, _ := storage.AddNode("User", nil)
+			toID, _ := storage.AddNode("Skill", nil)
+			edgeID, _ := storage.AddEdge(fromID, toID, "has_skill", map[string]any{"level": 1, "since": 2020})
+
+			Expect(storage.PatchEdge(edgeID, map[string]any{"level": 2}, []string{"since"})).To(Succeed())
+
+			edge, _ := storage.GetEdge(edgeID)
+			Expect(edge.Props).To(Equal(map[string]any{"level": 2}))
+		})
+	})
+
+	Describe("Labels", func() {
+		var id string
+
+		BeforeEach(func() {
+			id, _ = storage.AddNode("Employee", map[string]any{"name": "Alice"})
+		})
+
+		It("should replace all labels with SetLabel and keep the props", func() {
+			Expect(storage.AddLabel(id, "Mentor")).To(Succeed())
+			Expect(storage.SetLabel(id, "Admin")).To(Succeed())
+
+			node, _ := storage.GetNode(id)
+			Expect(node.Labels).To(Equal([]string{"Admin"}))
+			Expect(node.Props["name"]).To(Equal("Alice"))
+		})
+
+		It("should add and remove single labels", func() {
+			Expect(storage.AddLabel(id, "Mentor")).To(Succeed())
+			Expect(storage.AddLabel(id, "Mentor")).To(Succeed())
+
+			node, _ := storage.GetNode(id)
+			Expect(node.Labels).To(Equal([]string{"Employee", "Mentor"}))
+			Expect(node.HasLabel("Mentor")).To(BeTrue())
+
+			Expect(storage.RemoveLabel(id, "Employee")).To(Succeed())
+			Expect(storage.RemoveLabel(id, "Employee")).To(Succeed())
+			node, _ = storage.GetNode(id)
+			Expect(node.Labels).To(Equal([]string{"Mentor"}))
+		})
+
+		It("should keep the last label", func() {
+			Expect(storage.RemoveLabel(id, "Employee")).NotTo(Succeed())
+		})
+	})
+
 	Describe("DeleteNode", func() {
 		Context("when node exists", func() {
 			var nodeID string
@@ -186,9 +360,27 @@ var _ = Describe("In-Memory Storage CRUD", func() {
 				toID, err = storage.AddNode("B", nil)
 				Expect(err).NotTo(HaveOccurred())
 
-				err = storage.AddEdge(fromID, toID, "rel", nil)
+				_, err = storage.AddEdge(fromID, toID, "rel", nil)
 				Expect(err).NotTo(HaveOccurred())
 			})
+
+			It("should refuse to delete the node", func() {
+				err := storage.DeleteNode(toID)
+				Expect(err).To(MatchError(ports.ErrNodeHasEdges))
+
+				_, ok := storage.GetNode(toID)
+				Expect(ok).To(BeTrue())
+			})
+
+			It("should delete the node and its edges with DetachDeleteNode", func() {
+				Expect(storage.AddEdge(toID, toID, "self", nil)).Error().NotTo(HaveOccurred())
+				Expect(storage.DetachDeleteNode(toID)).To(Succeed())
+
+				_, ok := storage.GetNode(toID)
+				Expect(ok).To(BeFalse())
+				Expect(storage.GetAllEdges()).To(BeEmpty())
+				Expect(storage.DeleteNode(fromID)).To(Succeed())
+			})
 		})
 	})
 
@@ -202,7 +394,7 @@ var _ = Describe("In-Memory Storage CRUD", func() {
 			toID, err = storage.AddNode("Skill", nil)
 			Expect(err).NotTo(HaveOccurred())
 
-			err = storage.AddEdge(fromID, toID, "has_skill", nil)
+			_, err = storage.AddEdge(fromID, toID, "has_skill", nil)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
@@ -220,12 +412,97 @@ var _ = Describe("In-Memory Storage CRUD", func() {
 		})
 	})
 
+	Describe("AddEdgeWithID", func() {
+		var fromID, toID string
+
+		BeforeEach(func() {
+			fromID, _ = storage.AddNode("User", nil)
+			toID, _ = storage.AddNode("Skill", nil)
+		})
+
+		It("should put back a deleted edge under its ID", func() {
+			id, err := storage.AddEdge(fromID, toID, "has_skill", map[string]any{"level": 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(storage.DeleteEdgeByID(id)).To(Succeed())
+
+			Expect(storage.AddEdgeWithID(id, fromID, toID, "has_skill", map[string]any{"level": 1})).To(Succeed())
+			edge, ok := storage.GetEdge(id)
+			Expect(ok).To(BeTrue())
+			Expect(edge.From).To(Equal(fromID))
+			Expect(edge.Props["level"]).To(Equal(1))
+		})
+
+		It("should reject an ID in use or a missing end", func() {
+			id, _ := storage.AddEdge(fromID, toID, "has_skill", nil)
+			Expect(storage.AddEdgeWithID(id, fromID, toID, "has_skill", nil)).To(MatchError(ports.ErrEdgeExists))
+			Expect(storage.AddEdgeWithID("e99", fromID, "missing", "has_skill", nil)).To(MatchError("target node not found"))
+			Expect(storage.AddEdgeWithID("", fromID, toID, "has_skill", nil)).To(HaveOccurred())
+		})
+	})
+
+	Describe("Subgraphs", func() {
+		var aliceID, bobID string
+
+		BeforeEach(func() {
+			aliceID, _ = storage.AddNode("User", map[string]any{"name": "Alice"})
+			bobID, _ = storage.AddNode("User", map[string]any{"name": "Bob"})
+			Expect(storage.CreateSubgraph("org", "Org chart")).To(Succeed())
+		})
+
+		It("should register a subgraph once", func() {
+			Expect(storage.CreateSubgraph("org", "")).To(HaveOccurred())
+			Expect(storage.ListSubgraphs()).To(Equal([]*types.Subgraph{{Name: "org", Description: "Org chart", Mode: types.SubgraphInduced}}))
+		})
+
+		It("should add and remove nodes", func() {
+			Expect(storage.AddNodesToSubgraph("org", []string{aliceID, bobID})).To(Succeed())
+			Expect(storage.GetNodesIn("org")).To(HaveLen(2))
+
+			Expect(storage.RemoveNodesFromSubgraph("org", []string{bobID})).To(Succeed())
+			Expect(storage.GetNodesIn("org")).To(HaveLen(1))
+			alice, _ := storage.GetNode(aliceID)
+			Expect(alice.Subgraphs).To(Equal([]string{"org"}))
+		})
+
+		It("should add no node when one is missing", func() {
+			err := storage.AddNodesToSubgraph("org", []string{aliceID, "missing"})
+			Expect(err).To(HaveOccurred())
+			Expect(storage.GetNodesIn("org")).To(BeEmpty())
+		})
+
+		It("should fail for an unknown subgraph", func() {
+			Expect(storage.AddNodesToSubgraph("nope", []string{aliceID})).To(MatchError(ports.ErrSubgraphNotFound))
+			Expect(storage.DropSubgraph("nope")).To(MatchError(ports.ErrSubgraphNotFound))
+		})
+
+		It("should add edges explicitly", func() {
+			edgeID, _ := storage.AddEdge(aliceID, bobID, "knows", nil)
+			Expect(storage.AddEdgeToSubgraph("org", edgeID)).To(Succeed())
+			e, _ := storage.GetEdge(edgeID)
+			Expect(e.InSubgraph("org")).To(BeTrue())
+
+			Expect(storage.RemoveEdgeFromSubgraph("org", edgeID)).To(Succeed())
+			e, _ = storage.GetEdge(edgeID)
+			Expect(e.InSubgraph("org")).To(BeFalse())
+		})
+
+		It("should drop memberships but keep the nodes", func() {
+			Expect(storage.AddNodesToSubgraph("org", []string{aliceID})).To(Succeed())
+			Expect(storage.DropSubgraph("org")).To(Succeed())
+
+			Expect(storage.ListSubgraphs()).To(BeEmpty())
+			alice, ok := storage.GetNode(aliceID)
+			Expect(ok).To(BeTrue())
+			Expect(alice.Subgraphs).To(BeEmpty())
+		})
+	})
+
 	// Describe("Concurrency Safety", func() {
 	// 	It("should handle concurrent reads and writes", func(done Done) {
 	// 		// Add initial nodes
 	// 		aliceID, _ := storage.AddNode("User", map[string]any{"name": "Alice"})
 	// 		goID, _ := storage.AddNode("Skill", map[string]any{"name": "Go"})
-	// 		_ = storage.AddEdge(aliceID, goID, "has_skill", map[string]any{"level": 1})
+	// 		_, _ = storage.AddEdge(aliceID, goID, "has_skill", map[string]any{"level": 1})
 
 	// 		// Simulate concurrent operations
 	// 		doneChan := make(chan bool, 10)
@@ -237,7 +514,7 @@ var _ = Describe("In-Memory Storage CRUD", func() {
 	// 				// Read
 	// 				node, ok := storage.GetNode(aliceID)
 	// 				Expect(ok).To(BeTrue())
-	// 				Expect(node.Label).To(Equal("User"))
+	// 				Expect(node.Labels).To(Equal([]string{"User"}))
 
 	// 				// Update
 	// 				err := storage.UpdateNode(aliceID, map[string]any{"version": i})
@@ -0,0 +1,16 @@
+package inmem
+
+// VersionCount returns how many record versions the storage holds, live
+// or kept for open snapshots
+func (s *Storage) VersionCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, c := range s.nodes {
+		n += len(c)
+	}
+	for _, c := range s.edges {
+		n += len(c)
+	}
+	return n
+}
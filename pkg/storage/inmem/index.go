@@ -0,0 +1,162 @@
+package inmem
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// A property index maps each value of a property to the nodes of a label
+// having it in any of their kept versions. It is a superset of what one
+// version sees, so reads check each candidate against the record they
+// see. putNode and collect keep the indexes in step with the chains.
+
+// propIndex maps a value to the set of node IDs
+type propIndex map[any]map[string]bool
+
+// indexable reports whether a value can be a map key
+func indexable(v any) bool {
+	return v != nil && reflect.TypeOf(v).Comparable()
+}
+
+func sameValue(a, b any) bool {
+	return indexable(a) && indexable(b) && a == b
+}
+
+func (s *Storage) CreateIndex(label, prop string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	def := types.PropertyIndex{Label: label, Property: prop}
+	if _, exists := s.indexes[def]; exists {
+		return fmt.Errorf("index on %s already exists", def)
+	}
+	s.indexes[def] = make(propIndex)
+	for id, c := range s.nodes {
+		s.indexNode(id, c, def)
+	}
+	return nil
+}
+
+func (s *Storage) DropIndex(label, prop string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	def := types.PropertyIndex{Label: label, Property: prop}
+	if _, exists := s.indexes[def]; !exists {
+		return fmt.Errorf("no index on %s", def)
+	}
+	delete(s.indexes, def)
+	return nil
+}
+
+func (s *Storage) ListIndexes() []types.PropertyIndex {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.indexList()
+}
+
+// indexList returns the index definitions in order. The caller holds the
+// lock.
+func (s *Storage) indexList() []types.PropertyIndex {
+	list := make([]types.PropertyIndex, 0, len(s.indexes))
+	for def := range s.indexes {
+		list = append(list, def)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].String() < list[j].String() })
+	return list
+}
+
+// rebuildIndexes replaces the indexes with fresh ones over all chains.
+// The caller holds the write lock.
+func (s *Storage) rebuildIndexes(defs []types.PropertyIndex) {
+	s.indexes = make(map[types.PropertyIndex]propIndex, len(defs))
+	for _, def := range defs {
+		s.indexes[def] = make(propIndex)
+		for id, c := range s.nodes {
+			s.indexNode(id, c, def)
+		}
+	}
+}
+
+// index adds the versions of a node to every index, and unindex removes
+// them; a write unindexes the chain before changing it and indexes the
+// result. The caller holds the write lock.
+func (s *Storage) index(id string, c chain[*types.Node]) {
+	for def := range s.indexes {
+		s.indexNode(id, c, def)
+	}
+}
+
+func (s *Storage) unindex(id string, c chain[*types.Node]) {
+	for def, idx := range s.indexes {
+		for _, ver := range c {
+			v, ok := indexedValue(ver.rec, def)
+			if !ok {
+				continue
+			}
+			delete(idx[v], id)
+			if len(idx[v]) == 0 {
+				delete(idx, v)
+			}
+		}
+	}
+}
+
+func (s *Storage) indexNode(id string, c chain[*types.Node], def types.PropertyIndex) {
+	idx := s.indexes[def]
+	for _, ver := range c {
+		v, ok := indexedValue(ver.rec, def)
+		if !ok {
+			continue
+		}
+		if idx[v] == nil {
+			idx[v] = make(map[string]bool)
+		}
+		idx[v][id] = true
+	}
+}
+
+func indexedValue(n *types.Node, def types.PropertyIndex) (any, bool) {
+	if !n.HasLabel(def.Label) {
+		return nil, false
+	}
+	v, ok := n.Props[def.Property]
+	return v, ok && indexable(v)
+}
+
+// nodesByProp looks the value up in the index if there is one
+func (w view) nodesByProp(label, prop string, value any) []*types.Node {
+	match := func(n *types.Node) bool {
+		return n.HasLabel(label) && sameValue(n.Props[prop], value)
+	}
+
+	idx, ok := w.s.indexes[types.PropertyIndex{Label: label, Property: prop}]
+	if !ok || !indexable(value) {
+		var result []*types.Node
+		for _, n := range w.allNodes() {
+			if match(n) {
+				result = append(result, n)
+			}
+		}
+		return result
+	}
+
+	var result []*types.Node
+	for id := range idx[value] {
+		if _, pending := w.nodes[id]; pending {
+			continue
+		}
+		if n, ok := w.s.nodes[id].at(w.v); ok && match(n) {
+			result = append(result, n)
+		}
+	}
+	for _, n := range w.nodes {
+		if n != nil && match(n) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
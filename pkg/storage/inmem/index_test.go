@@ -0,0 +1,85 @@
+package inmem_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aprksy/knitknot/pkg/ports/types"
+	"github.com/aprksy/knitknot/pkg/storage/inmem"
+)
+
+var _ = Describe("Property indexes", func() {
+	var (
+		s              *inmem.Storage
+		aliceID, bobID string
+	)
+
+	BeforeEach(func() {
+		s = inmem.New()
+		aliceID, _ = s.AddNode("User", map[string]any{"email": "a@x"})
+		bobID, _ = s.AddNode("User", map[string]any{"email": "b@x"})
+		_, _ = s.AddNode("Team", map[string]any{"email": "a@x"})
+	})
+
+	nodeIDs := func(nodes []*types.Node) []string {
+		var ids []string
+		for _, n := range nodes {
+			ids = append(ids, n.ID)
+		}
+		return ids
+	}
+
+	It("should find nodes by property with or without an index", func() {
+		Expect(nodeIDs(s.GetNodesByProp("User", "email", "a@x"))).To(ConsistOf(aliceID))
+
+		Expect(s.CreateIndex("User", "email")).To(Succeed())
+		Expect(s.CreateIndex("User", "email")).To(HaveOccurred())
+		Expect(s.ListIndexes()).To(Equal([]types.PropertyIndex{{Label: "User", Property: "email"}}))
+		Expect(nodeIDs(s.GetNodesByProp("User", "email", "a@x"))).To(ConsistOf(aliceID))
+		Expect(s.GetNodesByProp("User", "email", "z@x")).To(BeEmpty())
+	})
+
+	It("should follow writes", func() {
+		Expect(s.CreateIndex("User", "email")).To(Succeed())
+
+		Expect(s.PatchNode(aliceID, map[string]any{"email": "c@x"}, nil)).To(Succeed())
+		Expect(s.GetNodesByProp("User", "email", "a@x")).To(BeEmpty())
+		Expect(nodeIDs(s.GetNodesByProp("User", "email", "c@x"))).To(ConsistOf(aliceID))
+
+		Expect(s.DeleteNode(bobID)).To(Succeed())
+		Expect(s.GetNodesByProp("User", "email", "b@x")).To(BeEmpty())
+	})
+
+	It("should answer for the version a reader sees", func() {
+		Expect(s.CreateIndex("User", "email")).To(Succeed())
+		snap := s.Snapshot()
+		defer snap.Release()
+
+		Expect(s.PatchNode(aliceID, map[string]any{"email": "c@x"}, nil)).To(Succeed())
+		Expect(nodeIDs(snap.GetNodesByProp("User", "email", "a@x"))).To(ConsistOf(aliceID))
+		Expect(snap.GetNodesByProp("User", "email", "c@x")).To(BeEmpty())
+	})
+
+	It("should include the pending writes of a transaction", func() {
+		Expect(s.CreateIndex("User", "email")).To(Succeed())
+		tx, err := s.Begin(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = tx.Rollback() }()
+
+		id, _ := tx.AddNode("User", map[string]any{"email": "d@x"})
+		Expect(tx.PatchNode(bobID, map[string]any{"email": "a@x"}, nil)).To(Succeed())
+		Expect(nodeIDs(tx.GetNodesByProp("User", "email", "d@x"))).To(ConsistOf(id))
+		Expect(nodeIDs(tx.GetNodesByProp("User", "email", "a@x"))).To(ConsistOf(aliceID, bobID))
+		Expect(tx.GetNodesByProp("User", "email", "b@x")).To(BeEmpty())
+		Expect(s.GetNodesByProp("User", "email", "d@x")).To(BeEmpty())
+	})
+
+	It("should compare values as stored", func() {
+		_, _ = s.AddNode("User", map[string]any{"age": 30})
+		Expect(s.CreateIndex("User", "age")).To(Succeed())
+		Expect(s.GetNodesByProp("User", "age", 30)).To(HaveLen(1))
+		Expect(s.GetNodesByProp("User", "age", 30.0)).To(BeEmpty())
+	})
+})
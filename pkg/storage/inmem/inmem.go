@@ -4,120 +4,292 @@ package inmem
 import (
 	"errors"
 	"fmt"
-	"math/rand"
+	"slices"
 	"sync"
 
+	"github.com/aprksy/knitknot/pkg/idgen"
 	"github.com/aprksy/knitknot/pkg/ports/storage"
 	"github.com/aprksy/knitknot/pkg/ports/types"
 )
 
-var _ storage.StorageEngine = (*Storage)(nil)
+var (
+	_ storage.StorageEngine = (*Storage)(nil)
+	_ storage.Persister     = (*Storage)(nil)
+	_ storage.NodeScanner   = (*Storage)(nil)
+)
 
+// Storage keeps versioned nodes and edges in memory (see mvcc.go). Records
+// are never modified once stored, so returned pointers stay valid and
+// unchanged; a write stores a new version instead.
 type Storage struct {
 	mu    sync.RWMutex
-	nodes map[string]*types.Node
-	edges map[string]*types.Edge
+	nodes map[string]chain[*types.Node]
+	edges map[string]chain[*types.Edge]
+
+	clock   uint64         // version of the last write
+	readers map[uint64]int // open snapshots per version
+	stale   bool           // some chain holds ended versions
+
+	ids     storage.IDGenerator // node IDs
+	edgeIDs storage.IDGenerator
+
+	subgraphs map[string]*types.Subgraph        // registry; see subgraph.go
+	indexes   map[types.PropertyIndex]propIndex // see index.go
+	meta      types.Metadata                    // see metadata.go
 }
 
+// maxIDAttempts bounds how many generated IDs AddNode and AddEdge try
+// before giving up because they are all taken
+const maxIDAttempts = 100
+
 func New() *Storage {
 	return &Storage{
-		nodes: make(map[string]*types.Node),
-		edges: make(map[string]*types.Edge),
+		nodes:   make(map[string]chain[*types.Node]),
+		edges:   make(map[string]chain[*types.Edge]),
+		readers: make(map[uint64]int),
+		ids:     idgen.NewCounter("n"),
+		edgeIDs: idgen.NewCounter("e"),
+
+		subgraphs: make(map[string]*types.Subgraph),
+		indexes:   make(map[types.PropertyIndex]propIndex),
 	}
 }
 
-func (s *Storage) AddNode(label string, props map[string]any) (string, error) {
-	id := generateID()
-	node := &types.Node{
-		ID:        id,
-		Label:     label,
-		Props:     copyMap(props),
-		Subgraphs: map[string]*types.Subgraph{},
+// WithIDGenerator replaces the generator of node IDs (a counter by default)
+func (s *Storage) WithIDGenerator(g storage.IDGenerator) *Storage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids = g
+	return s
+}
+
+// IDGenerator returns the generator of node IDs
+func (s *Storage) IDGenerator() storage.IDGenerator {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ids
+}
+
+// newID returns a generated ID not used in w. IDs taken by natural keys or
+// by an older graph are skipped.
+func (s *Storage) newID(w view) (string, error) {
+	for range maxIDAttempts {
+		id := s.ids.NewID()
+		if _, exists := w.node(id); !exists {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no free ID after %d attempts: %w", maxIDAttempts, storage.ErrNodeExists)
+}
+
+// newEdgeID is newID for edges
+func (s *Storage) newEdgeID(w view) (string, error) {
+	for range maxIDAttempts {
+		id := s.edgeIDs.NewID()
+		if _, exists := w.edge(id); !exists {
+			return id, nil
+		}
 	}
+	return "", fmt.Errorf("no free edge ID after %d attempts", maxIDAttempts)
+}
+
+// latest reads the current records. The caller holds the lock.
+func (s *Storage) latest() view {
+	return view{s: s, v: s.clock}
+}
+
+// tick starts a write at a new version. The caller holds the write lock.
+func (s *Storage) tick() uint64 {
+	s.clock++
+	return s.clock
+}
 
+func (s *Storage) AddNode(label string, props map[string]any) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.nodes[id]; exists {
-		return "", errors.New("node already exists")
+	id, err := s.newID(s.latest())
+	if err != nil {
+		return "", err
 	}
-	s.nodes[id] = node
+	s.putNode(id, newNode(id, label, props), s.tick())
 	return id, nil
 }
 
-func (s *Storage) AddToSubgraph(n *types.Node, sgName, sgDesc string) {
-	subgraph := &types.Subgraph{
-		Name:        sgName,
-		Description: sgDesc,
+func (s *Storage) AddNodeWithID(id, label string, props map[string]any) error {
+	if id == "" {
+		return errors.New("empty node ID")
 	}
-	n.Subgraphs[subgraph.Name] = subgraph
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.latest().node(id); exists {
+		return fmt.Errorf("%s: %w", id, storage.ErrNodeExists)
+	}
+	s.putNode(id, newNode(id, label, props), s.tick())
+	return nil
 }
 
-func (s *Storage) RemoveFromSubgraph(n *types.Node, sgName string) {
-	delete(n.Subgraphs, sgName)
+func newNode(id, label string, props map[string]any) *types.Node {
+	return &types.Node{
+		ID:     id,
+		Labels: []string{label},
+		Props:  copyMap(props),
+	}
 }
 
-func (s *Storage) AddEdge(from, to, kind string, props map[string]any) error {
-	s.mu.RLock()
-	_, fromOk := s.nodes[from]
-	_, toOk := s.nodes[to]
-	s.mu.RUnlock()
+func (s *Storage) AddEdge(from, to, kind string, props map[string]any) (string, error) {
+	// Check and insert under one lock, so a concurrent DeleteNode cannot
+	// leave the edge dangling
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if !fromOk {
-		return errors.New("source node not found")
-	}
-	if !toOk {
-		return errors.New("target node not found")
+	edge, err := newEdge(s.latest(), from, to, kind, props)
+	if err != nil {
+		return "", err
 	}
+	s.putEdge(edge.ID, edge, s.tick())
+	return edge.ID, nil
+}
+
+func (s *Storage) AddEdgeWithID(id, from, to, kind string, props map[string]any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	id := fmt.Sprintf("%s->%s@%s", from, to, kind)
-	edge := &types.Edge{
-		ID:        id,
-		From:      from,
-		To:        to,
-		Kind:      kind,
-		Props:     copyMap(props),
-		Subgraphs: map[string]*types.Subgraph{},
+	edge, err := edgeWithID(s.latest(), id, from, to, kind, props)
+	if err != nil {
+		return err
 	}
+	s.putEdge(id, edge, s.tick())
+	return nil
+}
 
+func (s *Storage) MergeEdge(from, to, kind string, props map[string]any) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.edges[id] = edge
+
+	edge, err := mergeEdge(s.latest(), from, to, kind, props)
+	if err != nil {
+		return "", err
+	}
+	s.putEdge(edge.ID, edge, s.tick())
+	return edge.ID, nil
+}
+
+// newEdge validates the ends of a new edge and gives it a generated ID
+func newEdge(w view, from, to, kind string, props map[string]any) (*types.Edge, error) {
+	if err := checkEnds(w, from, to); err != nil {
+		return nil, err
+	}
+
+	id, err := w.s.newEdgeID(w)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Edge{
+		ID:    id,
+		From:  from,
+		To:    to,
+		Kind:  kind,
+		Props: copyMap(props),
+	}, nil
+}
+
+// edgeWithID validates a new edge under a caller-supplied ID
+func edgeWithID(w view, id, from, to, kind string, props map[string]any) (*types.Edge, error) {
+	if id == "" {
+		return nil, errors.New("empty edge ID")
+	}
+	if _, exists := w.edge(id); exists {
+		return nil, fmt.Errorf("%s: %w", id, storage.ErrEdgeExists)
+	}
+	if err := checkEnds(w, from, to); err != nil {
+		return nil, err
+	}
+	return &types.Edge{
+		ID:    id,
+		From:  from,
+		To:    to,
+		Kind:  kind,
+		Props: copyMap(props),
+	}, nil
+}
+
+func checkEnds(w view, from, to string) error {
+	if _, ok := w.node(from); !ok {
+		return errors.New("source node not found")
+	}
+	if _, ok := w.node(to); !ok {
+		return errors.New("target node not found")
+	}
 	return nil
 }
 
+// mergeEdge returns the existing edge of a kind between two nodes with its
+// props replaced, or a new one
+func mergeEdge(w view, from, to, kind string, props map[string]any) (*types.Edge, error) {
+	edge, err := findEdge(w, from, to, kind)
+	if errors.Is(err, errEdgeNotFound) {
+		return newEdge(w, from, to, kind, props)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updated := copyEdge(edge)
+	updated.Props = copyMap(props)
+	return updated, nil
+}
+
+var errEdgeNotFound = errors.New("edge not found")
+
+// findEdge returns the only edge of a kind between two nodes
+func findEdge(w view, from, to, kind string) (*types.Edge, error) {
+	matches := w.findEdges(func(e *types.Edge) bool {
+		return e.From == from && e.To == to && e.Kind == kind
+	})
+	switch len(matches) {
+	case 0:
+		return nil, errEdgeNotFound
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("%d %s edges from %s to %s: %w", len(matches), kind, from, to, storage.ErrAmbiguousEdge)
+}
+
 func (s *Storage) GetNode(id string) (*types.Node, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	n, ok := s.nodes[id]
-	return n, ok
+	return s.latest().node(id)
 }
 
 func (s *Storage) GetEdge(id string) (*types.Edge, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	e, ok := s.edges[id]
-	return e, ok
+	return s.latest().edge(id)
 }
 
 func (s *Storage) GetAllNodes() []*types.Node {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	list := make([]*types.Node, 0, len(s.nodes))
-	for _, n := range s.nodes {
-		list = append(list, n)
+	return s.latest().allNodes()
+}
+
+func (s *Storage) ScanNodes() storage.NodeCursor {
+	read := func() (view, func()) {
+		s.mu.RLock()
+		return s.latest(), s.mu.RUnlock
 	}
-	return list
+	w, unlock := read()
+	defer unlock()
+	return &nodeCursor{ids: w.nodeIDs(), read: read}
 }
 
 func (s *Storage) GetAllEdges() []*types.Edge {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	list := make([]*types.Edge, 0, len(s.edges))
-	for _, e := range s.edges {
-		list = append(list, e)
-	}
-	return list
+	return s.latest().allEdges()
 }
 
 func (s *Storage) GetEdgesFrom(from string) []*types.Edge {
@@ -136,12 +308,14 @@ func (s *Storage) UpdateNode(id string, props map[string]any) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	node, ok := s.nodes[id]
+	node, ok := s.latest().node(id)
 	if !ok {
 		return fmt.Errorf("node not found")
 	}
 
-	node.Props = copyMap(props)
+	updated := copyNode(node)
+	updated.Props = copyMap(props)
+	s.putNode(id, updated, s.tick())
 	return nil
 }
 
@@ -149,89 +323,187 @@ func (s *Storage) UpdateEdge(id string, props map[string]any) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	edge, ok := s.edges[id]
+	edge, ok := s.latest().edge(id)
+	if !ok {
+		return errEdgeNotFound
+	}
+
+	updated := copyEdge(edge)
+	updated.Props = copyMap(props)
+	s.putEdge(id, updated, s.tick())
+	return nil
+}
+
+func (s *Storage) PatchNode(id string, set map[string]any, unset []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.latest().node(id)
 	if !ok {
 		return fmt.Errorf("node not found")
 	}
 
-	edge.Props = copyMap(props)
+	updated := copyNode(node)
+	updated.Props = patchProps(node.Props, set, unset)
+	s.putNode(id, updated, s.tick())
 	return nil
 }
 
+func (s *Storage) PatchEdge(id string, set map[string]any, unset []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	edge, ok := s.latest().edge(id)
+	if !ok {
+		return errEdgeNotFound
+	}
+
+	updated := copyEdge(edge)
+	updated.Props = patchProps(edge.Props, set, unset)
+	s.putEdge(id, updated, s.tick())
+	return nil
+}
+
+func (s *Storage) SetLabel(id, label string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.latest().node(id)
+	if !ok {
+		return fmt.Errorf("node not found")
+	}
+
+	updated := copyNode(node)
+	updated.Labels = []string{label}
+	s.putNode(id, updated, s.tick())
+	return nil
+}
+
+func (s *Storage) AddLabel(id, label string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.latest().node(id)
+	if !ok {
+		return fmt.Errorf("node not found")
+	}
+	if node.HasLabel(label) {
+		return nil
+	}
+
+	updated := copyNode(node)
+	updated.Labels = append(updated.Labels, label)
+	s.putNode(id, updated, s.tick())
+	return nil
+}
+
+func (s *Storage) RemoveLabel(id, label string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.latest().node(id)
+	if !ok {
+		return fmt.Errorf("node not found")
+	}
+	updated, err := withoutLabel(node, label)
+	if updated == nil || err != nil {
+		return err
+	}
+	s.putNode(id, updated, s.tick())
+	return nil
+}
+
+// withoutLabel returns a copy of n without the label, or nil if n does
+// not have it
+func withoutLabel(n *types.Node, label string) (*types.Node, error) {
+	if !n.HasLabel(label) {
+		return nil, nil
+	}
+	if len(n.Labels) == 1 {
+		return nil, fmt.Errorf("cannot remove the only label of node %s", n.ID)
+	}
+
+	updated := copyNode(n)
+	updated.Labels = slices.DeleteFunc(updated.Labels, func(l string) bool { return l == label })
+	return updated, nil
+}
+
 func (s *Storage) findEdges(match func(*types.Edge) bool) []*types.Edge {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	var result []*types.Edge
-	for _, e := range s.edges {
-		if match(e) {
-			result = append(result, e)
-		}
-	}
-	return result
+	return s.latest().findEdges(match)
 }
 
 func (s *Storage) GetNodesIn(subgraph string) []*types.Node {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-
-	var result []*types.Node
-	for _, n := range s.nodes {
-		if _, exists := n.Subgraphs[subgraph]; exists {
-			result = append(result, n)
-		}
-	}
-	return result
+	return s.latest().nodesIn(subgraph)
 }
 
 func (s *Storage) GetEdgesIn(subgraph string) []*types.Edge {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.latest().edgesIn(subgraph)
+}
 
-	var result []*types.Edge
-	for _, e := range s.edges {
-		// Edge belongs to subgraph if both ends do AND edge hasn't been removed
-		fromNode, ok1 := s.nodes[e.From]
-		toNode, ok2 := s.nodes[e.To]
-		if !ok1 || !ok2 {
-			continue
-		}
-		sgInstance, fromNodeExists := fromNode.Subgraphs[subgraph]
-		_, toNodeExists := toNode.Subgraphs[subgraph]
-
-		if fromNodeExists && toNodeExists {
-			// Optionally: ensure edge itself includes subgraph
-			if _, exists := e.Subgraphs[subgraph]; exists {
-				result = append(result, e)
-			} else {
-				// Auto-inherit
-				cp := *e
-				cp.Subgraphs[subgraph] = sgInstance
-				result = append(result, &cp)
-			}
-		}
-	}
-	return result
+func (s *Storage) GetNodesByProp(label, prop string, value any) []*types.Node {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.latest().nodesByProp(label, prop, value)
 }
 
 func (s *Storage) DeleteNode(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.nodes[id]; !ok {
+	if _, ok := s.latest().node(id); !ok {
 		return fmt.Errorf("node not found")
 	}
-	delete(s.nodes, id)
-	// Optionally remove edges too
+	if n := len(incident(s.latest(), id)); n > 0 {
+		return fmt.Errorf("node %s has %d edge(s): %w", id, n, storage.ErrNodeHasEdges)
+	}
+	s.putNode(id, nil, s.tick())
 	return nil
 }
 
+func (s *Storage) DetachDeleteNode(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.latest().node(id); !ok {
+		return fmt.Errorf("node not found")
+	}
+
+	// One version for the node and its edges, so no reader sees a half
+	v := s.tick()
+	for _, e := range incident(s.latest(), id) {
+		s.putEdge(e.ID, nil, v)
+	}
+	s.putNode(id, nil, v)
+	return nil
+}
+
+// incident returns the edges from or to a node
+func incident(w view, id string) []*types.Edge {
+	return w.findEdges(func(e *types.Edge) bool { return e.From == id || e.To == id })
+}
+
 func (s *Storage) DeleteEdge(from, to, kind string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	id := fmt.Sprintf("%s->%s@%s", from, to, kind)
-	if _, ok := s.edges[id]; !ok {
-		return fmt.Errorf("edge not found")
+	edge, err := findEdge(s.latest(), from, to, kind)
+	if err != nil {
+		return err
+	}
+	s.putEdge(edge.ID, nil, s.tick())
+	return nil
+}
+
+func (s *Storage) DeleteEdgeByID(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.latest().edge(id); !ok {
+		return errEdgeNotFound
 	}
-	delete(s.edges, id)
+	s.putEdge(id, nil, s.tick())
 	return nil
 }
 
@@ -247,7 +519,33 @@ func copyMap(m map[string]any) map[string]any {
 	return cp
 }
 
-func generateID() string {
-	// Reuse your ID generator
-	return fmt.Sprintf("n%d", rand.Intn(1000000)) // simplify for now
+// patchProps returns a copy of props without the unset keys and with set
+// applied
+func patchProps(props, set map[string]any, unset []string) map[string]any {
+	cp := make(map[string]any, len(props)+len(set))
+	for k, v := range props {
+		cp[k] = v
+	}
+	for _, k := range unset {
+		delete(cp, k)
+	}
+	for k, v := range set {
+		cp[k] = v
+	}
+	return cp
+}
+
+func copyNode(n *types.Node) *types.Node {
+	cp := *n
+	cp.Labels = slices.Clone(n.Labels)
+	cp.Props = copyMap(n.Props)
+	cp.Subgraphs = slices.Clone(n.Subgraphs)
+	return &cp
+}
+
+func copyEdge(e *types.Edge) *types.Edge {
+	cp := *e
+	cp.Props = copyMap(e.Props)
+	cp.Subgraphs = slices.Clone(e.Subgraphs)
+	return &cp
 }
@@ -1,13 +1,14 @@
 package inmem_test
 
 import (
+	"encoding/gob"
 	"os"
 	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
-	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/idgen"
 	"github.com/aprksy/knitknot/pkg/ports/types"
 	"github.com/aprksy/knitknot/pkg/storage/inmem"
 )
@@ -17,7 +18,6 @@ var _ = Describe("In-Memory Storage Persistence", func() {
 		storage  *inmem.Storage
 		tmpDir   string
 		filename string
-		engine   *graph.GraphEngine
 		n1, n2   string
 	)
 
@@ -28,20 +28,18 @@ var _ = Describe("In-Memory Storage Persistence", func() {
 
 		filename = filepath.Join(tmpDir, "test.gob")
 		storage = inmem.New()
-		engine = graph.NewGraphEngine(storage)
 
 		// Add test data
 		n1, _ = storage.AddNode("User", map[string]any{"name": "Alice"})
-		node1, _ := storage.GetNode(n1)
-		storage.AddToSubgraph(node1, "common-subgraph", "")
-		storage.AddToSubgraph(node1, "node1-only", "")
-
 		n2, _ = storage.AddNode("Skill", map[string]any{"name": "Go"})
-		node2, _ := storage.GetNode(n2)
-		storage.AddToSubgraph(node2, "common-subgraph", "")
-		storage.AddToSubgraph(node2, "node2-only", "")
+		for _, name := range []string{"common-subgraph", "node1-only", "node2-only"} {
+			Expect(storage.CreateSubgraph(name, "")).To(Succeed())
+		}
+		Expect(storage.AddNodesToSubgraph("common-subgraph", []string{n1, n2})).To(Succeed())
+		Expect(storage.AddNodesToSubgraph("node1-only", []string{n1})).To(Succeed())
+		Expect(storage.AddNodesToSubgraph("node2-only", []string{n2})).To(Succeed())
 
-		_ = storage.AddEdge(n1, n2, "has_skill", map[string]any{"level": 4})
+		_, _ = storage.AddEdge(n1, n2, "has_skill", map[string]any{"level": 4})
 
 	})
 
@@ -52,12 +50,12 @@ var _ = Describe("In-Memory Storage Persistence", func() {
 	Describe("Save and Load", func() {
 		It("should survive roundtrip", func() {
 			// Save
-			err := storage.Save(filename, engine)
+			err := storage.Save(filename)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Load into new storage
 			newStorage := inmem.New()
-			err = newStorage.Load(filename, nil) // no engine → skip verbs
+			err = newStorage.Load(filename)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(len(newStorage.GetAllNodes())).To(Equal(2))
@@ -66,12 +64,12 @@ var _ = Describe("In-Memory Storage Persistence", func() {
 			// Verify nodes
 			node1, ok := newStorage.GetNode(n1)
 			Expect(ok).To(BeTrue())
-			Expect(node1.Label).To(Equal("User"))
+			Expect(node1.Labels).To(Equal([]string{"User"}))
 			Expect(node1.Props["name"]).To(Equal("Alice"))
 
 			node2, ok := newStorage.GetNode(n2)
 			Expect(ok).To(BeTrue())
-			Expect(node2.Label).To(Equal("Skill"))
+			Expect(node2.Labels).To(Equal([]string{"Skill"}))
 
 			// Verify edges
 			edges := newStorage.GetEdgesFrom(n1)
@@ -81,43 +79,138 @@ var _ = Describe("In-Memory Storage Persistence", func() {
 			Expect(e.Props["level"]).To(Equal(4))
 		})
 
-		It("should preserve verb registry when loaded with engine", func() {
-			// Setup engine with verbs
-			engine := graph.NewGraphEngine(storage)
-			engine.RegisterVerb("has_skill", types.Verb{
-				TargetLabel: "Skill",
-				MatchOn:     "name",
-			})
+		It("should keep the metadata", func() {
+			meta := types.Metadata{
+				Verbs:           map[string]types.Verb{"has_skill": {TargetLabel: "Skill", MatchOn: "name"}},
+				Schemas:         map[string]types.LabelSchema{"User": {Label: "User"}},
+				Constraints:     []types.Constraint{{Name: "user_name_unique", Kind: types.ConstraintUnique, Label: "User", Properties: []string{"name"}}},
+				DefaultSubgraph: "common-subgraph",
+			}
+			storage.SetMetadata(meta)
+			Expect(storage.Save(filename)).To(Succeed())
 
-			// Save
-			Expect(storage.Save(filename, engine)).To(Succeed())
+			// Changing what was set does not change the storage
+			meta.Verbs["knows"] = types.Verb{}
+			Expect(storage.Metadata().Verbs).To(HaveLen(1))
+
+			newStorage := inmem.New()
+			Expect(newStorage.Load(filename)).To(Succeed())
+			Expect(newStorage.Metadata()).To(Equal(storage.Metadata()))
+
+			Expect(len(newStorage.GetNodesIn("common-subgraph"))).To(Equal(2))
+			Expect(len(newStorage.GetNodesIn("node1-only"))).To(Equal(1))
+			Expect(len(newStorage.GetNodesIn("node2-only"))).To(Equal(1))
+			Expect(len(newStorage.GetEdgesIn("common-subgraph"))).To(Equal(1))
+		})
+
+		It("should keep the ID scheme and continue the counter", func() {
+			Expect(storage.Save(filename)).To(Succeed())
+
+			newStorage := inmem.New().WithIDGenerator(idgen.NewULID())
+			Expect(newStorage.Load(filename)).To(Succeed())
+			Expect(newStorage.IDGenerator().Scheme()).To(Equal("counter"))
+
+			id, err := newStorage.AddNode("User", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal("n3"))
+
+			node, ok := newStorage.GetNode(n1)
+			Expect(ok).To(BeTrue())
+			Expect(node.ID).To(Equal(n1))
+		})
+
+		It("should continue the edge counter", func() {
+			deleted, _ := storage.AddEdge(n1, n2, "has_skill", nil)
+			Expect(storage.DeleteEdgeByID(deleted)).To(Succeed())
+			Expect(storage.Save(filename)).To(Succeed())
 
-			// Load with engine
 			newStorage := inmem.New()
-			newEngine := graph.NewGraphEngine(newStorage)
-			Expect(newStorage.Load(filename, newEngine)).To(Succeed())
+			Expect(newStorage.Load(filename)).To(Succeed())
 
-			// Check verbs
-			verbs := newEngine.Verbs().All()
-			verb, ok := verbs["has_skill"]
+			id, err := newStorage.AddEdge(n1, n2, "has_skill", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal("e3"))
+			Expect(newStorage.GetEdgesFrom(n1)).To(HaveLen(2))
+		})
+
+		It("should migrate single-label nodes of v0.1 files", func() {
+			type v01Node struct {
+				ID    string
+				Label string
+				Props map[string]any
+			}
+			type v01Graph struct {
+				Version string
+				Nodes   map[string]*v01Node
+			}
+			old := v01Graph{
+				Version: "knitknot/v0.1",
+				Nodes:   map[string]*v01Node{"n1": {ID: "n1", Label: "User", Props: map[string]any{"name": "Alice"}}},
+			}
+
+			f, err := os.Create(filename)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gob.NewEncoder(f).Encode(old)).To(Succeed())
+			Expect(f.Close()).To(Succeed())
+
+			newStorage := inmem.New()
+			Expect(newStorage.Load(filename)).To(Succeed())
+			node, ok := newStorage.GetNode("n1")
 			Expect(ok).To(BeTrue())
-			Expect(verb.TargetLabel).To(Equal("Skill"))
-			Expect(verb.MatchOn).To(Equal("name"))
+			Expect(node.Labels).To(Equal([]string{"User"}))
+			Expect(node.Props["name"]).To(Equal("Alice"))
+		})
 
-			Expect(len(storage.GetNodesIn("common-subgraph"))).To(Equal(2))
-			Expect(len(storage.GetNodesIn("node1-only"))).To(Equal(1))
-			Expect(len(storage.GetNodesIn("node2-only"))).To(Equal(1))
-			Expect(len(storage.GetEdgesIn("common-subgraph"))).To(Equal(1))
+		It("should keep the subgraph registry and memberships", func() {
+			Expect(storage.CreateSubgraph("org", "Org chart")).To(Succeed())
+			Expect(storage.AddNodesToSubgraph("org", []string{n1})).To(Succeed())
+			Expect(storage.Save(filename)).To(Succeed())
+
+			newStorage := inmem.New()
+			Expect(newStorage.Load(filename)).To(Succeed())
+			Expect(newStorage.ListSubgraphs()).To(ContainElement(&types.Subgraph{Name: "org", Description: "Org chart", Mode: types.SubgraphInduced}))
+			Expect(newStorage.GetNodesIn("org")).To(HaveLen(1))
+			Expect(newStorage.GetNodesIn("common-subgraph")).To(HaveLen(2))
+		})
+
+		It("should move per-node subgraph copies of v0.2 files to the registry", func() {
+			type v02Node struct {
+				ID        string
+				Labels    []string
+				Subgraphs map[string]*types.Subgraph
+			}
+			type v02Graph struct {
+				Version string
+				Nodes   map[string]*v02Node
+			}
+			old := v02Graph{
+				Version: "knitknot/v0.2",
+				Nodes: map[string]*v02Node{"n1": {
+					ID:        "n1",
+					Labels:    []string{"User"},
+					Subgraphs: map[string]*types.Subgraph{"org": {Name: "org", Description: "Org chart"}},
+				}},
+			}
+
+			f, err := os.Create(filename)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gob.NewEncoder(f).Encode(old)).To(Succeed())
+			Expect(f.Close()).To(Succeed())
+
+			newStorage := inmem.New()
+			Expect(newStorage.Load(filename)).To(Succeed())
+			Expect(newStorage.ListSubgraphs()).To(Equal([]*types.Subgraph{{Name: "org", Description: "Org chart"}}))
+			Expect(newStorage.GetNodesIn("org")).To(HaveLen(1))
 		})
 
 		It("should handle missing file gracefully", func() {
-			err := (&inmem.Storage{}).Load("not-there.gob", nil)
+			err := (&inmem.Storage{}).Load("not-there.gob")
 			Expect(err).To(HaveOccurred())
 		})
 
 		It("should create dir if needed", func() {
 			deepFile := filepath.Join(tmpDir, "subdir", "deep.gob")
-			err := storage.Save(deepFile, engine)
+			err := storage.Save(deepFile)
 			Expect(err).NotTo(HaveOccurred())
 
 			info, err := os.Stat(deepFile)
@@ -0,0 +1,32 @@
+package inmem
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// The metadata is kept as set, unversioned, and saved with the graph
+
+func (s *Storage) Metadata() types.Metadata {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneMetadata(s.meta)
+}
+
+func (s *Storage) SetMetadata(meta types.Metadata) {
+	meta = cloneMetadata(meta)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta = meta
+}
+
+// cloneMetadata copies the maps and slices of meta, so that neither the
+// caller nor the storage sees the other's changes
+func cloneMetadata(meta types.Metadata) types.Metadata {
+	meta.Verbs = maps.Clone(meta.Verbs)
+	meta.Schemas = maps.Clone(meta.Schemas)
+	meta.Constraints = slices.Clone(meta.Constraints)
+	return meta
+}
@@ -0,0 +1,384 @@
+package inmem
+
+import (
+	"math"
+
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// Records are versioned: every write happens at a new version of the
+// storage and ends the record's previous version instead of modifying it.
+// A Snapshot reads the records that were current at its version, so it
+// never sees later writes. An ended version is kept only while an open
+// snapshot can still see it.
+
+// live is the end of a version that is still current
+const live = math.MaxUint64
+
+// version is one state of a record, visible to reads at from <= v < to
+type version[T any] struct {
+	rec      T
+	from, to uint64
+}
+
+// chain holds the versions of one record, oldest first; only the last can
+// be live
+type chain[T any] []*version[T]
+
+// at returns the record visible at version v
+func (c chain[T]) at(v uint64) (T, bool) {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].from <= v && v < c[i].to {
+			return c[i].rec, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// changedSince reports whether the record was written after version v
+func (c chain[T]) changedSince(v uint64) bool {
+	if len(c) == 0 {
+		return false
+	}
+	last := c[len(c)-1]
+	return last.from > v || (last.to != live && last.to > v)
+}
+
+// put ends the live version at v and, unless deleted, appends rec as the
+// new live one
+func (c chain[T]) put(rec T, deleted bool, v uint64) chain[T] {
+	if n := len(c); n > 0 && c[n-1].to == live {
+		c[n-1].to = v
+	}
+	if !deleted {
+		c = append(c, &version[T]{rec: rec, from: v, to: live})
+	}
+	return c
+}
+
+// trim drops the ended versions no reader can see, and reports whether
+// any ended version is left
+func (c chain[T]) trim(readers map[uint64]int) (chain[T], bool) {
+	kept := c[:0]
+	ended := false
+	for _, ver := range c {
+		if ver.to == live {
+			kept = append(kept, ver)
+			continue
+		}
+		for r := range readers {
+			if ver.from <= r && r < ver.to {
+				kept = append(kept, ver)
+				ended = true
+				break
+			}
+		}
+	}
+	return kept, ended
+}
+
+// putNode writes a node (nil deletes it) at version v. The caller holds
+// the write lock.
+func (s *Storage) putNode(id string, n *types.Node, v uint64) {
+	s.unindex(id, s.nodes[id])
+	c, ended := s.nodes[id].put(n, n == nil, v).trim(s.readers)
+	if len(c) == 0 {
+		delete(s.nodes, id)
+		return
+	}
+	s.nodes[id] = c
+	s.index(id, c)
+	s.stale = s.stale || ended
+}
+
+func (s *Storage) putEdge(id string, e *types.Edge, v uint64) {
+	c, ended := s.edges[id].put(e, e == nil, v).trim(s.readers)
+	if len(c) == 0 {
+		delete(s.edges, id)
+		return
+	}
+	s.edges[id] = c
+	s.stale = s.stale || ended
+}
+
+// collect drops the versions no reader can see. The caller holds the
+// write lock.
+func (s *Storage) collect() {
+	s.stale = false
+	for id, c := range s.nodes {
+		s.unindex(id, c)
+		c, ended := c.trim(s.readers)
+		if len(c) == 0 {
+			delete(s.nodes, id)
+			continue
+		}
+		s.nodes[id] = c
+		s.index(id, c)
+		s.stale = s.stale || ended
+	}
+	for id, c := range s.edges {
+		c, ended := c.trim(s.readers)
+		if len(c) == 0 {
+			delete(s.edges, id)
+			continue
+		}
+		s.edges[id] = c
+		s.stale = s.stale || ended
+	}
+}
+
+var (
+	_ storage.Snapshot    = (*Snapshot)(nil)
+	_ storage.NodeScanner = (*Snapshot)(nil)
+)
+
+// Snapshot is a read-only view of the storage at one version. Release it
+// when done so the versions it pins can be collected.
+type Snapshot struct {
+	s        *Storage
+	v        uint64
+	released bool
+}
+
+// Snapshot opens a read view of the current state
+func (s *Storage) Snapshot() storage.Snapshot {
+	return s.snapshot()
+}
+
+func (s *Storage) snapshot() *Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readers[s.clock]++
+	return &Snapshot{s: s, v: s.clock}
+}
+
+// Release ends the snapshot; it is safe to call more than once
+func (sn *Snapshot) Release() {
+	s := sn.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sn.released {
+		return
+	}
+	sn.released = true
+
+	if s.readers[sn.v]--; s.readers[sn.v] == 0 {
+		delete(s.readers, sn.v)
+	}
+	if s.stale {
+		s.collect()
+	}
+}
+
+func (sn *Snapshot) read() (view, func()) {
+	sn.s.mu.RLock()
+	return view{s: sn.s, v: sn.v}, sn.s.mu.RUnlock
+}
+
+func (sn *Snapshot) GetNode(id string) (*types.Node, bool) {
+	w, unlock := sn.read()
+	defer unlock()
+	return w.node(id)
+}
+
+func (sn *Snapshot) GetEdge(id string) (*types.Edge, bool) {
+	w, unlock := sn.read()
+	defer unlock()
+	return w.edge(id)
+}
+
+func (sn *Snapshot) GetAllNodes() []*types.Node {
+	w, unlock := sn.read()
+	defer unlock()
+	return w.allNodes()
+}
+
+func (sn *Snapshot) ScanNodes() storage.NodeCursor {
+	w, unlock := sn.read()
+	defer unlock()
+	return &nodeCursor{ids: w.nodeIDs(), read: sn.read}
+}
+
+func (sn *Snapshot) GetAllEdges() []*types.Edge {
+	w, unlock := sn.read()
+	defer unlock()
+	return w.allEdges()
+}
+
+func (sn *Snapshot) GetEdgesFrom(from string) []*types.Edge {
+	w, unlock := sn.read()
+	defer unlock()
+	return w.findEdges(func(e *types.Edge) bool { return e.From == from })
+}
+
+func (sn *Snapshot) GetEdgesTo(to string) []*types.Edge {
+	w, unlock := sn.read()
+	defer unlock()
+	return w.findEdges(func(e *types.Edge) bool { return e.To == to })
+}
+
+func (sn *Snapshot) GetEdgesByKind(kind string) []*types.Edge {
+	w, unlock := sn.read()
+	defer unlock()
+	return w.findEdges(func(e *types.Edge) bool { return e.Kind == kind })
+}
+
+func (sn *Snapshot) GetNodesIn(subgraph string) []*types.Node {
+	w, unlock := sn.read()
+	defer unlock()
+	return w.nodesIn(subgraph)
+}
+
+func (sn *Snapshot) GetEdgesIn(subgraph string) []*types.Edge {
+	w, unlock := sn.read()
+	defer unlock()
+	return w.edgesIn(subgraph)
+}
+
+func (sn *Snapshot) GetNodesByProp(label, prop string, value any) []*types.Node {
+	w, unlock := sn.read()
+	defer unlock()
+	return w.nodesByProp(label, prop, value)
+}
+
+// view reads the records visible at version v, overlaid with the pending
+// writes of a transaction (a nil record is a pending delete). The caller
+// holds the read lock.
+type view struct {
+	s     *Storage
+	v     uint64
+	nodes map[string]*types.Node
+	edges map[string]*types.Edge
+}
+
+func (w view) node(id string) (*types.Node, bool) {
+	if n, ok := w.nodes[id]; ok {
+		return n, n != nil
+	}
+	return w.s.nodes[id].at(w.v)
+}
+
+func (w view) edge(id string) (*types.Edge, bool) {
+	if e, ok := w.edges[id]; ok {
+		return e, e != nil
+	}
+	return w.s.edges[id].at(w.v)
+}
+
+func (w view) allNodes() []*types.Node {
+	list := make([]*types.Node, 0, len(w.s.nodes))
+	for id, c := range w.s.nodes {
+		if _, pending := w.nodes[id]; pending {
+			continue
+		}
+		if n, ok := c.at(w.v); ok {
+			list = append(list, n)
+		}
+	}
+	for _, n := range w.nodes {
+		if n != nil {
+			list = append(list, n)
+		}
+	}
+	return list
+}
+
+// nodeIDs lists the IDs of the nodes the view may see, without reading
+// the nodes
+func (w view) nodeIDs() []string {
+	ids := make([]string, 0, len(w.s.nodes)+len(w.nodes))
+	for id := range w.s.nodes {
+		if _, pending := w.nodes[id]; !pending {
+			ids = append(ids, id)
+		}
+	}
+	for id := range w.nodes {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// nodeCursor lists the node IDs of a view up front and reads each node
+// only when it gets to it, taking the read lock for that one node
+type nodeCursor struct {
+	ids  []string
+	read func() (view, func())
+}
+
+func (c *nodeCursor) Next() (*types.Node, bool) {
+	for len(c.ids) > 0 {
+		id := c.ids[0]
+		c.ids = c.ids[1:]
+		w, unlock := c.read()
+		n, ok := w.node(id)
+		unlock()
+		if ok {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+func (w view) allEdges() []*types.Edge {
+	list := make([]*types.Edge, 0, len(w.s.edges))
+	for id, c := range w.s.edges {
+		if _, pending := w.edges[id]; pending {
+			continue
+		}
+		if e, ok := c.at(w.v); ok {
+			list = append(list, e)
+		}
+	}
+	for _, e := range w.edges {
+		if e != nil {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+func (w view) findEdges(match func(*types.Edge) bool) []*types.Edge {
+	var result []*types.Edge
+	for _, e := range w.allEdges() {
+		if match(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func (w view) nodesIn(subgraph string) []*types.Node {
+	var result []*types.Node
+	for _, n := range w.allNodes() {
+		if n.InSubgraph(subgraph) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// edgesIn returns the edges added to the subgraph and, if it is induced,
+// the edges between two of its nodes
+func (w view) edgesIn(subgraph string) []*types.Edge {
+	sg, ok := w.s.subgraphs[subgraph]
+	induced := ok && sg.Induced()
+
+	var result []*types.Edge
+	for _, e := range w.allEdges() {
+		if e.InSubgraph(subgraph) {
+			result = append(result, e)
+			continue
+		}
+		if !induced {
+			continue
+		}
+		fromNode, ok1 := w.node(e.From)
+		toNode, ok2 := w.node(e.To)
+		if ok1 && ok2 && fromNode.InSubgraph(subgraph) && toNode.InSubgraph(subgraph) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
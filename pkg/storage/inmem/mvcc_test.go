@@ -0,0 +1,136 @@
+package inmem_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/storage/inmem"
+)
+
+var _ = Describe("In-Memory Storage Snapshots", func() {
+	var s *inmem.Storage
+
+	BeforeEach(func() {
+		s = inmem.New()
+	})
+
+	It("should not see writes made after it was taken", func() {
+		aliceID, _ := s.AddNode("User", map[string]any{"name": "Alice"})
+		bobID, _ := s.AddNode("User", map[string]any{"name": "Bob"})
+
+		snap := s.Snapshot()
+		defer snap.Release()
+
+		Expect(s.UpdateNode(aliceID, map[string]any{"name": "Carol"})).To(Succeed())
+		Expect(s.DeleteNode(bobID)).To(Succeed())
+		_, _ = s.AddNode("User", map[string]any{"name": "Dave"})
+
+		alice, ok := snap.GetNode(aliceID)
+		Expect(ok).To(BeTrue())
+		Expect(alice.Props["name"]).To(Equal("Alice"))
+		_, ok = snap.GetNode(bobID)
+		Expect(ok).To(BeTrue())
+		Expect(snap.GetAllNodes()).To(HaveLen(2))
+
+		Expect(s.GetAllNodes()).To(HaveLen(2))
+		current, _ := s.GetNode(aliceID)
+		Expect(current.Props["name"]).To(Equal("Carol"))
+	})
+
+	It("should scan the nodes of its version even as they are written", func() {
+		aliceID, _ := s.AddNode("User", map[string]any{"name": "Alice"})
+		bobID, _ := s.AddNode("User", map[string]any{"name": "Bob"})
+
+		snap := s.Snapshot()
+		defer snap.Release()
+		cursor := snap.(storage.NodeScanner).ScanNodes()
+
+		Expect(s.UpdateNode(aliceID, map[string]any{"name": "Carol"})).To(Succeed())
+		Expect(s.DeleteNode(bobID)).To(Succeed())
+		_, _ = s.AddNode("User", map[string]any{"name": "Dave"})
+
+		var names []any
+		for n, ok := cursor.Next(); ok; n, ok = cursor.Next() {
+			names = append(names, n.Props["name"])
+		}
+		Expect(names).To(ConsistOf("Alice", "Bob"))
+	})
+
+	It("should not modify returned nodes in place", func() {
+		id, _ := s.AddNode("User", nil)
+		node, _ := s.GetNode(id)
+
+		Expect(s.CreateSubgraph("org", "")).To(Succeed())
+		Expect(s.AddNodesToSubgraph("org", []string{id})).To(Succeed())
+
+		Expect(node.Subgraphs).To(BeEmpty())
+		Expect(s.GetNodesIn("org")).To(HaveLen(1))
+	})
+
+	Describe("garbage collection", func() {
+		It("should keep only live versions without open snapshots", func() {
+			id, _ := s.AddNode("User", map[string]any{"n": 0})
+			for i := 1; i <= 10; i++ {
+				Expect(s.UpdateNode(id, map[string]any{"n": i})).To(Succeed())
+			}
+			Expect(s.VersionCount()).To(Equal(1))
+		})
+
+		It("should drop versions pinned by a snapshot once released", func() {
+			id, _ := s.AddNode("User", map[string]any{"n": 0})
+			tmpID, _ := s.AddNode("Temp", nil)
+
+			snap := s.Snapshot()
+			for i := 1; i <= 10; i++ {
+				Expect(s.UpdateNode(id, map[string]any{"n": i})).To(Succeed())
+			}
+			Expect(s.DeleteNode(tmpID)).To(Succeed())
+			Expect(s.VersionCount()).To(Equal(3))
+
+			snap.Release()
+			Expect(s.VersionCount()).To(Equal(1))
+		})
+	})
+
+	It("should give a consistent view while writers run", func() {
+		ids := make([]string, 10)
+		for i := range ids {
+			ids[i], _ = s.AddNode("Counter", map[string]any{"v": 0})
+		}
+
+		// Each round bumps every counter in one transaction, so any
+		// snapshot must see them all equal
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer GinkgoRecover()
+			for round := 1; round <= 50; round++ {
+				tx, err := s.Begin(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				for _, id := range ids {
+					Expect(tx.UpdateNode(id, map[string]any{"v": round})).To(Succeed())
+				}
+				Expect(tx.Commit()).To(Succeed())
+			}
+		}()
+
+		for i := 0; i < 50; i++ {
+			snap := s.Snapshot()
+			seen := map[string]bool{}
+			for _, id := range ids {
+				n, ok := snap.GetNode(id)
+				Expect(ok).To(BeTrue())
+				seen[fmt.Sprint(n.Props["v"])] = true
+			}
+			snap.Release()
+			Expect(seen).To(HaveLen(1))
+		}
+		wg.Wait()
+	})
+})
@@ -6,13 +6,14 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/aprksy/knitknot/pkg/graph"
+	"github.com/aprksy/knitknot/pkg/idgen"
+	"github.com/aprksy/knitknot/pkg/ports/storage"
 	"github.com/aprksy/knitknot/pkg/ports/types"
 	"github.com/aprksy/knitknot/pkg/storage/file"
 )
 
-// Save writes the current graph state to disk
-func (s *Storage) Save(filename string, engine *graph.GraphEngine) error {
+// Save writes the current graph state, metadata included, to disk
+func (s *Storage) Save(filename string) error {
 	// Ensure dir exists
 	_ = os.MkdirAll(filepath.Dir(filename), 0755)
 
@@ -32,30 +33,39 @@ func (s *Storage) Save(filename string, engine *graph.GraphEngine) error {
 
 	saved := &file.SavedGraph{
 		Version: file.CurrentVersion,
-		Nodes:   make(map[string]*types.Node),
-		Edges:   make(map[string]*types.Edge),
-		Verbs:   make(map[string]types.Verb),
+		Nodes:   make(map[string]*file.Node),
+		Edges:   make(map[string]*file.Edge),
 	}
 
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	// Copy nodes and edges
-	for id, n := range s.nodes {
-		saved.Nodes[id] = n
+	for _, n := range s.latest().allNodes() {
+		saved.Nodes[n.ID] = file.NewNode(n)
 	}
-	for id, e := range s.edges {
-		saved.Edges[id] = e
+	for _, e := range s.latest().allEdges() {
+		saved.Edges[e.ID] = file.NewEdge(e)
 	}
+	saved.Subgraphs = s.subgraphs
+	saved.Indexes = s.indexList()
 
-	saved.Verbs = engine.Verbs().All()
+	saved.Verbs = s.meta.Verbs
+	saved.Schemas = s.meta.Schemas
+	saved.Constraints = s.meta.Constraints
+	saved.DefaultSubgraph = s.meta.DefaultSubgraph
+
+	saved.IDs = generatorState(s.ids)
+	saved.EdgeIDs = generatorState(s.edgeIDs)
 
 	encoder := gob.NewEncoder(f)
 	return encoder.Encode(saved)
 }
 
-// Load populates the storage from a file
-func (s *Storage) Load(filename string, engine *graph.GraphEngine) error {
+// Load replaces the graph, metadata included, with the one saved in a
+// file. An engine on the storage takes over the loaded definitions with
+// GraphEngine.LoadMetadata.
+func (s *Storage) Load(filename string) error {
 	f, err := os.Open(filename)
 	if err != nil {
 		return err
@@ -76,29 +86,92 @@ func (s *Storage) Load(filename string, engine *graph.GraphEngine) error {
 		return err
 	}
 
-	if saved.Version != file.CurrentVersion {
-		return fmt.Errorf("unsupported version: %s (expected %s)", saved.Version, file.CurrentVersion)
+	if err := saved.Migrate(); err != nil {
+		return err
 	}
+	return s.restore(&saved)
+}
 
+// restore replaces the storage's records, subgraphs, indexes and metadata
+// with the saved ones
+func (s *Storage) restore(saved *file.SavedGraph) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Clear existing
-	s.nodes = make(map[string]*types.Node)
-	s.edges = make(map[string]*types.Edge)
+	if s.nodes == nil { // zero Storage
+		s.nodes = make(map[string]chain[*types.Node])
+		s.edges = make(map[string]chain[*types.Edge])
+		s.readers = make(map[uint64]int)
+		s.ids = idgen.NewCounter("n")
+		s.edgeIDs = idgen.NewCounter("e")
+	}
+	s.subgraphs = saved.Subgraphs
+	if s.subgraphs == nil {
+		s.subgraphs = make(map[string]*types.Subgraph)
+	}
+	s.meta = types.Metadata{
+		Verbs:           saved.Verbs,
+		Schemas:         saved.Schemas,
+		Constraints:     saved.Constraints,
+		DefaultSubgraph: saved.DefaultSubgraph,
+	}
+
+	if err := s.restoreIDs(saved.IDs); err != nil {
+		return err
+	}
+	if err := restoreState(s.edgeIDs, saved.EdgeIDs); err != nil {
+		return err
+	}
 
-	// Restore
+	// Replace everything in one new version, so open snapshots keep
+	// reading the old graph
+	v := s.tick()
+	for _, n := range s.latest().allNodes() {
+		s.putNode(n.ID, nil, v)
+	}
+	for _, e := range s.latest().allEdges() {
+		s.putEdge(e.ID, nil, v)
+	}
 	for id, n := range saved.Nodes {
-		s.nodes[id] = n
+		s.putNode(id, n.ToNode(), v)
 	}
 	for id, e := range saved.Edges {
-		s.edges[id] = e
+		s.putEdge(id, e.ToEdge(), v)
+	}
+	s.rebuildIndexes(saved.Indexes)
+	return nil
+}
+
+// restoreIDs switches to the generator the graph was saved with, so new
+// IDs keep its scheme. Graphs saved before schemes were recorded keep the
+// current generator. The caller holds the write lock.
+func (s *Storage) restoreIDs(saved file.IDGenState) error {
+	if saved.Scheme == "" {
+		return nil
+	}
+
+	if saved.Scheme != s.ids.Scheme() {
+		g, err := idgen.New(saved.Scheme)
+		if err != nil {
+			return err
+		}
+		s.ids = g
 	}
 
-	// After restoring nodes/edges
-	for name, verb := range saved.Verbs {
-		engine.RegisterVerb(name, verb) // assuming engine is passed in
+	return restoreState(s.ids, saved)
+}
+
+func generatorState(g storage.IDGenerator) file.IDGenState {
+	saved := file.IDGenState{Scheme: g.Scheme()}
+	if st, ok := g.(storage.IDGeneratorState); ok {
+		saved.State = st.State()
 	}
+	return saved
+}
 
+func restoreState(g storage.IDGenerator, saved file.IDGenState) error {
+	if st, ok := g.(storage.IDGeneratorState); ok && saved.State != "" {
+		return st.Restore(saved.State)
+	}
 	return nil
 }
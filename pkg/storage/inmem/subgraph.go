@@ -0,0 +1,180 @@
+package inmem
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+// Subgraphs are registered once in Storage.subgraphs; a node or edge is
+// added to one by listing its name in Subgraphs. The registry is not
+// versioned, but memberships are, like the rest of a record. Reads never
+// modify records: the edges an induced subgraph gets from its nodes are
+// worked out by edgesIn on each call.
+
+func (s *Storage) CreateSubgraph(name, description string) error {
+	return s.register(&types.Subgraph{Name: name, Description: description, Mode: types.SubgraphInduced})
+}
+
+func (s *Storage) CreateView(name, query string) error {
+	if query == "" {
+		return errors.New("empty view query")
+	}
+	return s.register(&types.Subgraph{Name: name, Query: query, Mode: types.SubgraphInduced})
+}
+
+func (s *Storage) register(sg *types.Subgraph) error {
+	if sg.Name == "" {
+		return errors.New("empty subgraph name")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.subgraphs[sg.Name]; exists {
+		return fmt.Errorf("subgraph %s already exists", sg.Name)
+	}
+	s.subgraphs[sg.Name] = sg
+	return nil
+}
+
+func (s *Storage) DropSubgraph(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.subgraphs[name]; !exists {
+		return fmt.Errorf("%s: %w", name, storage.ErrSubgraphNotFound)
+	}
+	delete(s.subgraphs, name)
+
+	w := s.latest()
+	v := s.tick()
+	for _, n := range w.nodesIn(name) {
+		s.putNode(n.ID, withoutSubgraph(copyNode(n), name), v)
+	}
+	for _, e := range w.findEdges(func(e *types.Edge) bool { return e.InSubgraph(name) }) {
+		updated := copyEdge(e)
+		updated.Subgraphs = slices.DeleteFunc(updated.Subgraphs, func(sg string) bool { return sg == name })
+		s.putEdge(e.ID, updated, v)
+	}
+	return nil
+}
+
+// ListSubgraphs returns the registered subgraphs sorted by name
+func (s *Storage) ListSubgraphs() []*types.Subgraph {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]*types.Subgraph, 0, len(s.subgraphs))
+	for _, sg := range s.subgraphs {
+		cp := *sg
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (s *Storage) SetSubgraphMode(name string, mode types.SubgraphMode) error {
+	if _, err := types.ParseSubgraphMode(string(mode)); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sg, exists := s.subgraphs[name]
+	if !exists {
+		return fmt.Errorf("%s: %w", name, storage.ErrSubgraphNotFound)
+	}
+	sg.Mode = mode
+	return nil
+}
+
+func (s *Storage) AddNodesToSubgraph(name string, ids []string) error {
+	return s.changeNodes(name, ids, func(n *types.Node) *types.Node {
+		if n.InSubgraph(name) {
+			return nil
+		}
+		updated := copyNode(n)
+		updated.Subgraphs = append(updated.Subgraphs, name)
+		return updated
+	})
+}
+
+func (s *Storage) RemoveNodesFromSubgraph(name string, ids []string) error {
+	return s.changeNodes(name, ids, func(n *types.Node) *types.Node {
+		if !n.InSubgraph(name) {
+			return nil
+		}
+		return withoutSubgraph(copyNode(n), name)
+	})
+}
+
+// changeNodes applies change to each node of a subgraph operation at one
+// version; change returns nil to leave a node as it is
+func (s *Storage) changeNodes(name string, ids []string, change func(*types.Node) *types.Node) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.subgraphs[name]; !exists {
+		return fmt.Errorf("%s: %w", name, storage.ErrSubgraphNotFound)
+	}
+
+	w := s.latest()
+	var updated []*types.Node
+	for _, id := range ids {
+		n, ok := w.node(id)
+		if !ok {
+			return fmt.Errorf("node %s not found", id)
+		}
+		if u := change(n); u != nil {
+			updated = append(updated, u)
+		}
+	}
+
+	if len(updated) == 0 {
+		return nil
+	}
+	v := s.tick()
+	for _, n := range updated {
+		s.putNode(n.ID, n, v)
+	}
+	return nil
+}
+
+func (s *Storage) AddEdgeToSubgraph(name, edgeID string) error {
+	return s.changeEdge(name, edgeID, func(e *types.Edge) {
+		if !e.InSubgraph(name) {
+			e.Subgraphs = append(e.Subgraphs, name)
+		}
+	})
+}
+
+func (s *Storage) RemoveEdgeFromSubgraph(name, edgeID string) error {
+	return s.changeEdge(name, edgeID, func(e *types.Edge) {
+		e.Subgraphs = slices.DeleteFunc(e.Subgraphs, func(sg string) bool { return sg == name })
+	})
+}
+
+// changeEdge applies change to a copy of the edge and stores it
+func (s *Storage) changeEdge(name, edgeID string, change func(*types.Edge)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.subgraphs[name]; !exists {
+		return fmt.Errorf("%s: %w", name, storage.ErrSubgraphNotFound)
+	}
+
+	e, ok := s.latest().edge(edgeID)
+	if !ok {
+		return errEdgeNotFound
+	}
+	updated := copyEdge(e)
+	change(updated)
+	s.putEdge(edgeID, updated, s.tick())
+	return nil
+}
+
+func withoutSubgraph(n *types.Node, name string) *types.Node {
+	n.Subgraphs = slices.DeleteFunc(n.Subgraphs, func(sg string) bool { return sg == name })
+	return n
+}
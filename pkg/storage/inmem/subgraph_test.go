@@ -0,0 +1,109 @@
+package inmem_test
+
+import (
+	"fmt"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aprksy/knitknot/pkg/ports/types"
+	"github.com/aprksy/knitknot/pkg/storage/inmem"
+)
+
+var _ = Describe("Subgraph membership", func() {
+	var (
+		s                       *inmem.Storage
+		aliceID, bobID, carolID string
+		knows, likes            string
+	)
+
+	BeforeEach(func() {
+		s = inmem.New()
+		aliceID, _ = s.AddNode("User", map[string]any{"name": "Alice"})
+		bobID, _ = s.AddNode("User", map[string]any{"name": "Bob"})
+		carolID, _ = s.AddNode("User", map[string]any{"name": "Carol"})
+		knows, _ = s.AddEdge(aliceID, bobID, "knows", nil)
+		likes, _ = s.AddEdge(aliceID, carolID, "likes", nil)
+
+		Expect(s.CreateSubgraph("team", "")).To(Succeed())
+		Expect(s.AddNodesToSubgraph("team", []string{aliceID, bobID})).To(Succeed())
+	})
+
+	edgeIDs := func(edges []*types.Edge) []string {
+		var ids []string
+		for _, e := range edges {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	It("should be induced by default", func() {
+		Expect(s.ListSubgraphs()[0].Mode).To(Equal(types.SubgraphInduced))
+		Expect(edgeIDs(s.GetEdgesIn("team"))).To(ConsistOf(knows))
+	})
+
+	It("should include explicit edges in both modes", func() {
+		Expect(s.AddEdgeToSubgraph("team", likes)).To(Succeed())
+		Expect(edgeIDs(s.GetEdgesIn("team"))).To(ConsistOf(knows, likes))
+
+		Expect(s.SetSubgraphMode("team", types.SubgraphExplicit)).To(Succeed())
+		Expect(edgeIDs(s.GetEdgesIn("team"))).To(ConsistOf(likes))
+	})
+
+	It("should reject unknown modes", func() {
+		Expect(s.SetSubgraphMode("team", "partial")).To(HaveOccurred())
+		_, err := types.ParseSubgraphMode("Explicit")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should not mark induced edges as members", func() {
+		Expect(s.GetEdgesIn("team")).To(HaveLen(1))
+
+		e, _ := s.GetEdge(knows)
+		Expect(e.Subgraphs).To(BeEmpty())
+		Expect(s.VersionCount()).To(Equal(5))
+	})
+
+	It("should be safe to read while memberships change", func() {
+		const workers = 8
+		var wg sync.WaitGroup
+
+		for i := 0; i < workers; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				defer GinkgoRecover()
+				for j := 0; j < 20; j++ {
+					id, err := s.AddNode("User", map[string]any{"n": fmt.Sprint(i, j)})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(s.AddNodesToSubgraph("team", []string{id})).To(Succeed())
+					_, err = s.AddEdge(aliceID, id, "knows", nil)
+					Expect(err).NotTo(HaveOccurred())
+					if j%5 == 0 {
+						Expect(s.RemoveNodesFromSubgraph("team", []string{id})).To(Succeed())
+					}
+				}
+			}(i)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				for j := 0; j < 20; j++ {
+					for _, e := range s.GetEdgesIn("team") {
+						Expect(e.Subgraphs).To(BeEmpty())
+					}
+					snap := s.Snapshot()
+					_ = snap.GetEdgesIn("team")
+					_ = snap.GetNodesIn("team")
+					snap.Release()
+					_ = s.ListSubgraphs()
+				}
+			}()
+		}
+		wg.Wait()
+
+		// 16 of every 20 added nodes stay, plus Alice and Bob
+		Expect(s.GetNodesIn("team")).To(HaveLen(workers*16 + 2))
+		Expect(s.GetEdgesIn("team")).To(HaveLen(workers*16 + 1))
+	})
+})
@@ -0,0 +1,486 @@
+package inmem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/ports/types"
+)
+
+var (
+	_ storage.Tx          = (*Tx)(nil)
+	_ storage.NodeScanner = (*Tx)(nil)
+)
+
+// Tx is a transaction on an in-memory Storage. It reads from a snapshot
+// taken at Begin, overlaid with its own pending writes, and applies those
+// writes as one new version on Commit.
+type Tx struct {
+	s    *Storage
+	ctx  context.Context
+	snap *Snapshot
+
+	// Pending writes; a nil record is a delete
+	nodes map[string]*types.Node
+	edges map[string]*types.Edge
+
+	// Ends and kind of edges written by MergeEdge, which must still be
+	// single at commit
+	merged map[edgeKey]bool
+
+	done bool
+}
+
+type edgeKey struct{ from, to, kind string }
+
+// Begin starts a transaction
+func (s *Storage) Begin(ctx context.Context) (storage.Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return &Tx{
+		s:      s,
+		ctx:    ctx,
+		snap:   s.snapshot(),
+		nodes:  make(map[string]*types.Node),
+		edges:  make(map[string]*types.Edge),
+		merged: make(map[edgeKey]bool),
+	}, nil
+}
+
+// Commit applies the transaction's writes under the storage lock. It fails,
+// leaving the storage untouched, if the context is done, if a written
+// record was changed by someone else since Begin, if an edge would be
+// left pointing at a deleted node, or if a merged edge was added
+// concurrently.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+	tx.done = true
+	defer tx.snap.Release()
+
+	if err := tx.ctx.Err(); err != nil {
+		return err
+	}
+
+	s := tx.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range tx.nodes {
+		if s.nodes[id].changedSince(tx.snap.v) {
+			return fmt.Errorf("node %s: %w", id, storage.ErrConflict)
+		}
+	}
+	for id := range tx.edges {
+		if s.edges[id].changedSince(tx.snap.v) {
+			return fmt.Errorf("edge %s: %w", id, storage.ErrConflict)
+		}
+	}
+
+	// Nodes not written by the transaction may have been deleted meanwhile,
+	// and nodes it deletes may have been connected meanwhile
+	final := view{s: s, v: s.clock, nodes: tx.nodes, edges: tx.edges}
+	for id, e := range tx.edges {
+		if e == nil {
+			continue
+		}
+		_, fromOk := final.node(e.From)
+		_, toOk := final.node(e.To)
+		if !fromOk || !toOk {
+			return fmt.Errorf("edge %s: endpoint node not found", id)
+		}
+	}
+	for id, n := range tx.nodes {
+		if n == nil && len(incident(final, id)) > 0 {
+			return fmt.Errorf("node %s: %w", id, storage.ErrNodeHasEdges)
+		}
+	}
+
+	for k := range tx.merged {
+		if _, err := findEdge(final, k.from, k.to, k.kind); errors.Is(err, storage.ErrAmbiguousEdge) {
+			return fmt.Errorf("%w: %w", err, storage.ErrConflict)
+		}
+	}
+
+	v := s.tick()
+	for id, n := range tx.nodes {
+		s.putNode(id, n, v)
+	}
+	for id, e := range tx.edges {
+		s.putEdge(id, e, v)
+	}
+	return nil
+}
+
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+	tx.done = true
+	tx.snap.Release()
+	return nil
+}
+
+// read returns the transaction's view. The caller must unlock.
+func (tx *Tx) read() (view, func()) {
+	tx.s.mu.RLock()
+	return view{s: tx.s, v: tx.snap.v, nodes: tx.nodes, edges: tx.edges}, tx.s.mu.RUnlock
+}
+
+func (tx *Tx) AddNode(label string, props map[string]any) (string, error) {
+	if tx.done {
+		return "", storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	id, err := tx.s.newID(w)
+	if err != nil {
+		return "", err
+	}
+	tx.nodes[id] = newNode(id, label, props)
+	return id, nil
+}
+
+func (tx *Tx) AddNodeWithID(id, label string, props map[string]any) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+	if id == "" {
+		return errors.New("empty node ID")
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	if _, exists := w.node(id); exists {
+		return fmt.Errorf("%s: %w", id, storage.ErrNodeExists)
+	}
+	tx.nodes[id] = newNode(id, label, props)
+	return nil
+}
+
+func (tx *Tx) AddEdge(from, to, kind string, props map[string]any) (string, error) {
+	if tx.done {
+		return "", storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	edge, err := newEdge(w, from, to, kind, props)
+	if err != nil {
+		return "", err
+	}
+	tx.edges[edge.ID] = edge
+	return edge.ID, nil
+}
+
+func (tx *Tx) AddEdgeWithID(id, from, to, kind string, props map[string]any) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	edge, err := edgeWithID(w, id, from, to, kind, props)
+	if err != nil {
+		return err
+	}
+	tx.edges[id] = edge
+	return nil
+}
+
+func (tx *Tx) MergeEdge(from, to, kind string, props map[string]any) (string, error) {
+	if tx.done {
+		return "", storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	edge, err := mergeEdge(w, from, to, kind, props)
+	if err != nil {
+		return "", err
+	}
+	tx.edges[edge.ID] = edge
+	tx.merged[edgeKey{from, to, kind}] = true
+	return edge.ID, nil
+}
+
+func (tx *Tx) UpdateNode(id string, props map[string]any) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	node, ok := w.node(id)
+	if !ok {
+		return fmt.Errorf("node not found")
+	}
+
+	updated := copyNode(node)
+	updated.Props = copyMap(props)
+	tx.nodes[id] = updated
+	return nil
+}
+
+func (tx *Tx) UpdateEdge(id string, props map[string]any) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	edge, ok := w.edge(id)
+	if !ok {
+		return errEdgeNotFound
+	}
+
+	updated := copyEdge(edge)
+	updated.Props = copyMap(props)
+	tx.edges[id] = updated
+	return nil
+}
+
+func (tx *Tx) PatchNode(id string, set map[string]any, unset []string) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	node, ok := w.node(id)
+	if !ok {
+		return fmt.Errorf("node not found")
+	}
+
+	updated := copyNode(node)
+	updated.Props = patchProps(node.Props, set, unset)
+	tx.nodes[id] = updated
+	return nil
+}
+
+func (tx *Tx) PatchEdge(id string, set map[string]any, unset []string) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	edge, ok := w.edge(id)
+	if !ok {
+		return errEdgeNotFound
+	}
+
+	updated := copyEdge(edge)
+	updated.Props = patchProps(edge.Props, set, unset)
+	tx.edges[id] = updated
+	return nil
+}
+
+func (tx *Tx) SetLabel(id, label string) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	node, ok := w.node(id)
+	if !ok {
+		return fmt.Errorf("node not found")
+	}
+
+	updated := copyNode(node)
+	updated.Labels = []string{label}
+	tx.nodes[id] = updated
+	return nil
+}
+
+func (tx *Tx) AddLabel(id, label string) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	node, ok := w.node(id)
+	if !ok {
+		return fmt.Errorf("node not found")
+	}
+	if node.HasLabel(label) {
+		return nil
+	}
+
+	updated := copyNode(node)
+	updated.Labels = append(updated.Labels, label)
+	tx.nodes[id] = updated
+	return nil
+}
+
+func (tx *Tx) RemoveLabel(id, label string) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	node, ok := w.node(id)
+	if !ok {
+		return fmt.Errorf("node not found")
+	}
+	updated, err := withoutLabel(node, label)
+	if updated == nil || err != nil {
+		return err
+	}
+	tx.nodes[id] = updated
+	return nil
+}
+
+func (tx *Tx) DeleteNode(id string) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	if _, ok := w.node(id); !ok {
+		return fmt.Errorf("node not found")
+	}
+	if n := len(incident(w, id)); n > 0 {
+		return fmt.Errorf("node %s has %d edge(s): %w", id, n, storage.ErrNodeHasEdges)
+	}
+	tx.nodes[id] = nil
+	return nil
+}
+
+func (tx *Tx) DetachDeleteNode(id string) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	if _, ok := w.node(id); !ok {
+		return fmt.Errorf("node not found")
+	}
+	for _, e := range incident(w, id) {
+		tx.edges[e.ID] = nil
+	}
+	tx.nodes[id] = nil
+	return nil
+}
+
+func (tx *Tx) DeleteEdge(from, to, kind string) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	edge, err := findEdge(w, from, to, kind)
+	if err != nil {
+		return err
+	}
+	tx.edges[edge.ID] = nil
+	return nil
+}
+
+func (tx *Tx) DeleteEdgeByID(id string) error {
+	if tx.done {
+		return storage.ErrTxDone
+	}
+
+	w, unlock := tx.read()
+	defer unlock()
+
+	if _, ok := w.edge(id); !ok {
+		return errEdgeNotFound
+	}
+	tx.edges[id] = nil
+	return nil
+}
+
+func (tx *Tx) GetNode(id string) (*types.Node, bool) {
+	w, unlock := tx.read()
+	defer unlock()
+	return w.node(id)
+}
+
+func (tx *Tx) GetEdge(id string) (*types.Edge, bool) {
+	w, unlock := tx.read()
+	defer unlock()
+	return w.edge(id)
+}
+
+func (tx *Tx) GetAllNodes() []*types.Node {
+	w, unlock := tx.read()
+	defer unlock()
+	return w.allNodes()
+}
+
+func (tx *Tx) ScanNodes() storage.NodeCursor {
+	w, unlock := tx.read()
+	defer unlock()
+	return &nodeCursor{ids: w.nodeIDs(), read: tx.read}
+}
+
+func (tx *Tx) GetAllEdges() []*types.Edge {
+	w, unlock := tx.read()
+	defer unlock()
+	return w.allEdges()
+}
+
+func (tx *Tx) GetEdgesFrom(from string) []*types.Edge {
+	w, unlock := tx.read()
+	defer unlock()
+	return w.findEdges(func(e *types.Edge) bool { return e.From == from })
+}
+
+func (tx *Tx) GetEdgesTo(to string) []*types.Edge {
+	w, unlock := tx.read()
+	defer unlock()
+	return w.findEdges(func(e *types.Edge) bool { return e.To == to })
+}
+
+func (tx *Tx) GetEdgesByKind(kind string) []*types.Edge {
+	w, unlock := tx.read()
+	defer unlock()
+	return w.findEdges(func(e *types.Edge) bool { return e.Kind == kind })
+}
+
+func (tx *Tx) GetNodesIn(subgraph string) []*types.Node {
+	w, unlock := tx.read()
+	defer unlock()
+	return w.nodesIn(subgraph)
+}
+
+func (tx *Tx) GetEdgesIn(subgraph string) []*types.Edge {
+	w, unlock := tx.read()
+	defer unlock()
+	return w.edgesIn(subgraph)
+}
+
+func (tx *Tx) GetNodesByProp(label, prop string, value any) []*types.Node {
+	w, unlock := tx.read()
+	defer unlock()
+	return w.nodesByProp(label, prop, value)
+}
@@ -0,0 +1,177 @@
+package inmem_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aprksy/knitknot/pkg/ports/storage"
+	"github.com/aprksy/knitknot/pkg/storage/inmem"
+)
+
+var _ = Describe("In-Memory Storage Transactions", func() {
+	var (
+		s   *inmem.Storage
+		ctx context.Context
+	)
+
+	BeforeEach(func() {
+		s = inmem.New()
+		ctx = context.Background()
+	})
+
+	Describe("Commit", func() {
+		It("should make writes visible only after commit", func() {
+			tx, err := s.Begin(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			aliceID, err := tx.AddNode("User", map[string]any{"name": "Alice"})
+			Expect(err).NotTo(HaveOccurred())
+			goID, err := tx.AddNode("Skill", map[string]any{"name": "Go"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tx.AddEdge(aliceID, goID, "has_skill", nil)).Error().NotTo(HaveOccurred())
+
+			_, ok := tx.GetNode(aliceID)
+			Expect(ok).To(BeTrue())
+			_, ok = s.GetNode(aliceID)
+			Expect(ok).To(BeFalse())
+
+			Expect(tx.Commit()).To(Succeed())
+			Expect(s.GetAllNodes()).To(HaveLen(2))
+			Expect(s.GetEdgesFrom(aliceID)).To(HaveLen(1))
+		})
+
+		It("should fail once the context is done", func() {
+			cctx, cancel := context.WithCancel(ctx)
+			tx, err := s.Begin(cctx)
+			Expect(err).NotTo(HaveOccurred())
+			_, _ = tx.AddNode("User", nil)
+
+			cancel()
+			Expect(tx.Commit()).To(MatchError(context.Canceled))
+			Expect(s.GetAllNodes()).To(BeEmpty())
+		})
+	})
+
+	Describe("Rollback", func() {
+		It("should discard writes", func() {
+			id, _ := s.AddNode("User", map[string]any{"name": "Alice"})
+
+			tx, _ := s.Begin(ctx)
+			Expect(tx.UpdateNode(id, map[string]any{"name": "Bob"})).To(Succeed())
+			_, _ = tx.AddNode("User", nil)
+			Expect(tx.Rollback()).To(Succeed())
+
+			n, _ := s.GetNode(id)
+			Expect(n.Props["name"]).To(Equal("Alice"))
+			Expect(s.GetAllNodes()).To(HaveLen(1))
+		})
+
+		It("should discard patches and relabels", func() {
+			id, _ := s.AddNode("User", map[string]any{"name": "Alice", "age": 40})
+
+			tx, _ := s.Begin(ctx)
+			Expect(tx.PatchNode(id, map[string]any{"age": 41}, []string{"name"})).To(Succeed())
+			Expect(tx.SetLabel(id, "Admin")).To(Succeed())
+			n, _ := tx.GetNode(id)
+			Expect(n.Props).To(Equal(map[string]any{"age": 41}))
+			Expect(tx.Rollback()).To(Succeed())
+
+			n, _ = s.GetNode(id)
+			Expect(n.Labels).To(Equal([]string{"User"}))
+			Expect(n.Props).To(Equal(map[string]any{"name": "Alice", "age": 40}))
+		})
+
+		It("should return ErrTxDone after commit", func() {
+			tx, _ := s.Begin(ctx)
+			Expect(tx.Commit()).To(Succeed())
+			Expect(tx.Rollback()).To(MatchError(storage.ErrTxDone))
+
+			_, err := tx.AddNode("User", nil)
+			Expect(err).To(MatchError(storage.ErrTxDone))
+		})
+	})
+
+	Describe("Isolation", func() {
+		It("should not see writes committed after Begin", func() {
+			id, _ := s.AddNode("User", map[string]any{"name": "Alice"})
+
+			tx, _ := s.Begin(ctx)
+			Expect(s.UpdateNode(id, map[string]any{"name": "Bob"})).To(Succeed())
+			_, _ = s.AddNode("User", nil)
+
+			n, _ := tx.GetNode(id)
+			Expect(n.Props["name"]).To(Equal("Alice"))
+			Expect(tx.GetAllNodes()).To(HaveLen(1))
+		})
+
+		It("should scan its own writes over those as of Begin", func() {
+			aliceID, _ := s.AddNode("User", map[string]any{"name": "Alice"})
+			bobID, _ := s.AddNode("User", map[string]any{"name": "Bob"})
+
+			tx, _ := s.Begin(ctx)
+			defer func() { _ = tx.Rollback() }()
+			Expect(tx.UpdateNode(aliceID, map[string]any{"name": "Carol"})).To(Succeed())
+			Expect(tx.DeleteNode(bobID)).To(Succeed())
+			_, _ = tx.AddNode("User", map[string]any{"name": "Dave"})
+			_, _ = s.AddNode("User", map[string]any{"name": "Eve"})
+
+			var names []any
+			cursor := tx.(storage.NodeScanner).ScanNodes()
+			for n, ok := cursor.Next(); ok; n, ok = cursor.Next() {
+				names = append(names, n.Props["name"])
+			}
+			Expect(names).To(ConsistOf("Carol", "Dave"))
+		})
+
+		It("should reject a commit that overwrites a concurrent write", func() {
+			id, _ := s.AddNode("User", map[string]any{"name": "Alice"})
+
+			tx, _ := s.Begin(ctx)
+			Expect(tx.UpdateNode(id, map[string]any{"name": "Carol"})).To(Succeed())
+			Expect(s.UpdateNode(id, map[string]any{"name": "Bob"})).To(Succeed())
+
+			Expect(tx.Commit()).To(MatchError(storage.ErrConflict))
+			n, _ := s.GetNode(id)
+			Expect(n.Props["name"]).To(Equal("Bob"))
+		})
+
+		It("should not delete a node connected concurrently", func() {
+			fromID, _ := s.AddNode("User", nil)
+			toID, _ := s.AddNode("Skill", nil)
+
+			tx, _ := s.Begin(ctx)
+			Expect(tx.DeleteNode(toID)).To(Succeed())
+			Expect(s.AddEdge(fromID, toID, "has_skill", nil)).Error().NotTo(HaveOccurred())
+
+			Expect(tx.Commit()).To(MatchError(storage.ErrNodeHasEdges))
+			_, ok := s.GetNode(toID)
+			Expect(ok).To(BeTrue())
+		})
+
+		It("should not leave an edge to a node deleted concurrently", func() {
+			fromID, _ := s.AddNode("User", nil)
+			toID, _ := s.AddNode("Skill", nil)
+
+			tx, _ := s.Begin(ctx)
+			Expect(tx.AddEdge(fromID, toID, "has_skill", nil)).Error().NotTo(HaveOccurred())
+			Expect(s.DeleteNode(toID)).To(Succeed())
+
+			Expect(tx.Commit()).To(HaveOccurred())
+			Expect(s.GetAllEdges()).To(BeEmpty())
+		})
+
+		It("should reject merging an edge added concurrently", func() {
+			fromID, _ := s.AddNode("User", nil)
+			toID, _ := s.AddNode("User", nil)
+
+			tx, _ := s.Begin(ctx)
+			Expect(tx.MergeEdge(fromID, toID, "reports_to", nil)).Error().NotTo(HaveOccurred())
+			Expect(s.MergeEdge(fromID, toID, "reports_to", nil)).Error().NotTo(HaveOccurred())
+
+			Expect(tx.Commit()).To(MatchError(storage.ErrConflict))
+			Expect(s.GetEdgesFrom(fromID)).To(HaveLen(1))
+		})
+	})
+})